@@ -1,31 +1,215 @@
+// Copyright © 2018 Bodie Solomon <bodie@synapsegarden.net>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
 package cmd
 
 import (
-	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"text/tabwriter"
+
+	"github.com/phoenix-engine/phx/dep"
 
+	"github.com/pkg/errors"
 	"github.com/spf13/cobra"
 )
 
+var (
+	depLocal    string
+	depBranch   string
+	depRevision string
+	depUpdate   bool
+	depForce    bool
+)
+
 var depCmd = &cobra.Command{
 	Use:   "dep",
 	Short: "Manage lib dependencies",
-	Long:  ``,
+	Long: `Dep manages the Git repositories the project depends on, such as the
+LZ4 library the lz4 runtime is built with.  They are declared in the
+deps section of the config file, which is ./.phx.yaml unless --config
+is given, and checked out relative to the directory it is in:
+
+  deps:
+    lz4:
+      remote: https://github.com/lz4/lz4
+      local: gen/lz4
+      revision: v1.8.3
+
+Each is locked to the commit it was resolved to in phx.lock, next to
+the config file, which should be committed so that everyone building
+the project checks out the same sources with "phx dep sync".
+
+In a Git repo, deps are added as submodules.  Otherwise, they are
+cloned.`,
+	Args: cobra.NoArgs,
 	RunE: func(cmd *cobra.Command, args []string) error {
-		return errors.New("dep not implemented")
+		return listDeps()
 	},
 }
 
-func init() {
-	// TODO: Enable.
-	// rootCmd.AddCommand(depCmd)
+var depAddCmd = &cobra.Command{
+	Use:   "add NAME REMOTE",
+	Short: "Add a dependency and lock it",
+	Args:  cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return depProject().Add(args[0], dep.Dep{
+			Remote:   args[1],
+			Local:    depLocal,
+			Branch:   depBranch,
+			Revision: depRevision,
+		})
+	},
+}
 
-	// Here you will define your flags and configuration settings.
+var depRemoveCmd = &cobra.Command{
+	Use:   "remove NAME",
+	Short: "Remove a dependency and its checkout",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return depProject().Remove(args[0])
+	},
+}
+
+var depListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List the dependencies and how their checkouts drifted from their locked commits",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return listDeps()
+	},
+}
+
+var depSyncCmd = &cobra.Command{
+	Use:   "sync [NAME...]",
+	Short: "Check out each dependency at the commit it is locked to",
+	Long: `Sync checks out each dependency at the commit it is locked to in
+phx.lock.  Dependencies which aren't locked yet, or whose remote or
+revision changed, are locked to the commit their revision resolves to.
+
+With --update, the named dependencies, or all of them if none are
+named, are resolved again, such as to update them to the head of their
+branch.
+
+Each dependency which had drifted from its locked commit is listed,
+with how it had drifted.  With --overwrite, local modifications of the
+checkouts are discarded.  Otherwise, a checkout with modifications is
+left as it is if it is at its locked commit, and is an error if not.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		p := depProject()
+		p.Overwrite = depForce
+		if len(args) > 0 && !depUpdate {
+			return errors.New("dependencies are only named with --update")
+		}
+		if len(args) == 0 && depUpdate {
+			deps, err := p.Deps()
+			if err != nil {
+				return err
+			}
+			args = deps.Names()
+		}
+
+		sts, err := p.Sync(args...)
+		if err != nil {
+			return err
+		}
+		for _, st := range sts {
+			if st.Drift != 0 {
+				fmt.Printf("%s: %s, now at %s\n",
+					st.Name, st.Drift, short(st.Commit))
+			}
+		}
+		return nil
+	},
+}
+
+// depProject returns the dep.Project of the config file, whose root is
+// the directory it is in.
+func depProject() dep.Project {
+	if cfgFile == "" {
+		return dep.Project{Root: "."}
+	}
+	return dep.Project{Root: filepath.Dir(cfgFile), Config: cfgFile}
+}
+
+func listDeps() error {
+	p := depProject()
+	deps, err := p.Deps()
+	if err != nil {
+		return err
+	}
+	sts, err := p.Check()
+	if err != nil {
+		return err
+	}
+
+	tw := new(tabwriter.Writer)
+	tw.Init(os.Stdout, 0, 8, 2, ' ', 0)
+
+	fmt.Fprintln(tw, "NAME\tLOCAL\tREMOTE\tREVISION\tCOMMIT\tDRIFT")
+	for _, st := range sts {
+		d := deps[st.Name]
+		rev := d.Revision
+		if rev == "" {
+			rev = "-"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\n",
+			st.Name, d.Local, d.Remote, rev, short(st.Commit), st.Drift)
+	}
+	return tw.Flush()
+}
+
+// short returns the abbreviated form of a commit ID, or "-" if it is
+// empty.
+func short(commit string) string {
+	switch {
+	case commit == "":
+		return "-"
+	case len(commit) > 12:
+		return commit[:12]
+	}
+	return commit
+}
+
+func init() {
+	rootCmd.AddCommand(depCmd)
+	depCmd.AddCommand(depAddCmd)
+	depCmd.AddCommand(depRemoveCmd)
+	depCmd.AddCommand(depListCmd)
+	depCmd.AddCommand(depSyncCmd)
 
-	// Cobra supports Persistent Flags which will work for this command
-	// and all subcommands, e.g.:
-	// depCmd.PersistentFlags().String("foo", "", "A help for foo")
+	depAddCmd.Flags().StringVar(
+		&depLocal, "local", "",
+		"Path to check out the dependency into (default deps/NAME)",
+	)
+	depAddCmd.Flags().StringVar(
+		&depBranch, "branch", "",
+		"Branch for a submodule of the dependency to track",
+	)
+	depAddCmd.Flags().StringVar(
+		&depRevision, "revision", "",
+		"Tag, commit or branch to lock the dependency to (default the branch, or the remote's HEAD)",
+	)
 
-	// Cobra supports local flags which will only run when this command
-	// is called directly, e.g.:
-	// depCmd.Flags().BoolP("toggle", "t", false, "Help message for toggle")
+	depSyncCmd.Flags().BoolVar(
+		&depForce, "overwrite", false,
+		"Discard local modifications of the checkouts of the dependencies",
+	)
+	depSyncCmd.Flags().BoolVar(
+		&depUpdate, "update", false,
+		"Resolve the named dependencies again, or all of them if none are named",
+	)
 }
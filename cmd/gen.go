@@ -16,35 +16,100 @@
 package cmd
 
 import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
 	"github.com/phoenix-engine/phx/fs"
 	"github.com/phoenix-engine/phx/gen"
 	"github.com/phoenix-engine/phx/gen/compress"
+	"github.com/phoenix-engine/phx/gen/cpp"
 	"github.com/phoenix-engine/phx/path"
 
 	"github.com/pkg/errors"
 	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"github.com/spf13/viper"
 )
 
 var (
 	from string
 	to   string
+	kind string
+	arch string
+	enc  string
+
+	format    cpp.Format
+	naming    cpp.Naming
+	templates string
+	chunkSize int64
 
 	match Regexp
 
 	skipFinalize bool
+	force        bool
+	noPrune      bool
+	disambiguate bool
+
+	stageOnDisk    bool
+	stageThreshold int64
 
-	level int
+	graph string
+
+	level    int
+	codec    string
+	maxRatio float64
 )
 
 // genCmd represents the gen command
 var genCmd = &cobra.Command{
 	Use:   "gen",
 	Short: "Generate build deps",
-	Long:  ``,
+	Long: `Gen generates a C++ library from the resources in the --from tree.
+Flags which aren't given are read from the gen section of the config
+file, if they are set there, such as "codec: deflate".`,
+	PersistentPreRunE: applyGenConfig,
 	RunE: func(cmd *cobra.Command, args []string) error {
-		pipeline := gen.Gen{
+		if graph != "" {
+			gens, err := makeGraph()
+			if err != nil {
+				return err
+			}
+			return errors.Wrap(gen.OperateGraph(gens),
+				"operating gen graph")
+		}
+
+		g, err := makeGen()
+		if err != nil {
+			return err
+		}
+
+		if err := g.Operate(); err != nil {
+			return errors.Wrap(err, "operating gen pipeline")
+		}
+
+		// TODO: Trigger dep update
+
+		return nil
+	},
+}
+
+// makeGen creates a Gen pipeline from the gen flags.
+func makeGen() (gen.Gen, error) {
+	c, err := compress.Lookup(codec)
+	if err != nil {
+		return gen.Gen{}, errors.Wrap(err, "checking --codec")
+	}
+
+	var tmps fs.FS
+	if templates != "" {
+		tmps = fs.Real{Where: templates}
+	}
+
+	return gen.Gen{
+		Sources: []gen.Source{{
 			From: fs.Real{Where: from},
-			To:   fs.Real{Where: to},
 
 			Matcher: func() path.Matcher {
 				if match.Regexp == nil {
@@ -53,60 +118,233 @@ var genCmd = &cobra.Command{
 				return match
 			}(),
 
-			SkipFinalize: skipFinalize,
-
-			Level: func() compress.Level {
-				switch level {
-				case 0:
-					return compress.Fastest
-				case 1:
-					return compress.Medium
-				case 2, 3:
-					return compress.High
-				case 9:
-					return compress.LZ4HC
-				default:
-					return compress.Medium
-				}
-			}(),
-		}
+			Maker:    c.Maker(compress.LevelFromInt(level)),
+			MaxRatio: maxRatio,
+		}},
+		To:        fs.Real{Where: to},
+		Kind:      kind,
+		Arch:      arch,
+		Encoding:  enc,
+		Format:    format,
+		Naming:    naming,
+		Templates: tmps,
+		ChunkSize: chunkSize,
 
-		if err := pipeline.Operate(); err != nil {
-			return errors.Wrap(err, "operating gen pipeline")
-		}
+		Disambiguate: disambiguate,
 
-		// TODO: Trigger dep update
+		SkipFinalize: skipFinalize,
+		Force:        force,
+		NoPrune:      noPrune,
 
-		return nil
-	},
+		StageOnDisk:    stageOnDisk,
+		StageThreshold: stageThreshold,
+	}, nil
 }
 
-func init() {
-	rootCmd.AddCommand(genCmd)
+// makeGraph creates the Gens described by the graph file, with the gen
+// flags which apply to all of them.  Paths in the graph file are
+// relative to its directory.
+func makeGraph() ([]gen.Gen, error) {
+	f, err := os.Open(graph)
+	if err != nil {
+		return nil, errors.Wrapf(err, "opening %s", graph)
+	}
+	defer f.Close()
+
+	g, err := gen.ReadGraph(f)
+	if err != nil {
+		return nil, errors.Wrapf(err, "reading %s", graph)
+	}
+
+	gens, err := g.Gens(filepath.Dir(graph))
+	if err != nil {
+		return nil, errors.Wrapf(err, "checking %s", graph)
+	}
+
+	for i := range gens {
+		gens[i].SkipFinalize = skipFinalize
+		gens[i].Force = force
+		gens[i].NoPrune = noPrune
+		gens[i].StageOnDisk = stageOnDisk
+		gens[i].StageThreshold = stageThreshold
+	}
+
+	return gens, nil
+}
+
+// applyGenConfig sets each flag of the command which wasn't given to
+// the setting of the same name in the gen section of the config file,
+// if it is set there.
+func applyGenConfig(cmd *cobra.Command, args []string) error {
+	var err error
+	cmd.Flags().VisitAll(func(f *pflag.Flag) {
+		key := "gen." + f.Name
+		if err != nil || f.Changed || !viper.IsSet(key) {
+			return
+		}
+		if serr := f.Value.Set(viper.GetString(key)); serr != nil {
+			err = errors.Wrapf(serr, "setting --%s from %s",
+				f.Name, viper.ConfigFileUsed())
+		}
+	})
+	return err
+}
 
-	genCmd.PersistentFlags().Var(
+// addGenFlags adds the flags used by makeGen and makeGraph to the given
+// FlagSet.
+func addGenFlags(flags *pflag.FlagSet) {
+	flags.Var(
 		&match, "match", "",
 	)
 
-	genCmd.PersistentFlags().StringVar(
+	flags.StringVar(
 		&from, "from",
 		"res",
 		"Where to read static resources",
 	)
-	genCmd.PersistentFlags().StringVar(
+	flags.StringVar(
 		&to, "to",
 		"gen",
 		"Where to write generated resources",
 	)
+	flags.StringVar(
+		&kind, "kind",
+		gen.KindCpp,
+		"What to generate: C++ arrays ("+gen.KindCpp+
+			"), C++ with .incbin assembly ("+gen.KindIncbin+
+			"), ELF objects ("+gen.KindELF+
+			"), or a resource pack ("+gen.KindPack+")",
+	)
+	flags.StringVar(
+		&arch, "arch",
+		"",
+		"The architecture of "+gen.KindELF+
+			" objects (x86-64, aarch64; default: this machine's)",
+	)
+	flags.StringVar(
+		&enc, "encoding",
+		cpp.EncodingHex.String(),
+		"How "+gen.KindCpp+" arrays are written ("+
+			strings.Join(cpp.Encodings(), ", ")+
+			"; raw only applies to uncompressed resources)",
+	)
+	flags.Int64Var(
+		&chunkSize, "chunk-size",
+		0,
+		"Split "+gen.KindCpp+" arrays into chunks of this many bytes (at least "+
+			strconv.Itoa(cpp.MinChunkSize)+"; 0 disables)",
+	)
+	flags.IntVar(
+		&format.Width, "width",
+		0,
+		"The maximum width of array lines (default "+
+			strconv.Itoa(cpp.MaxWidth)+")",
+	)
+	flags.IntVar(
+		&format.PerLine, "per-line",
+		0,
+		"The number of bytes per line of hex arrays (default as many as fit)",
+	)
+	flags.BoolVar(
+		&format.NoComment, "no-comment",
+		false,
+		"Leave out the ASCII comments of hex arrays",
+	)
+	flags.BoolVar(
+		&format.CRLF, "crlf",
+		false,
+		"End lines of generated source with CRLF",
+	)
+
+	flags.StringVar(
+		&naming.Style, "naming",
+		"",
+		"The style of resource IDs ("+
+			strings.Join(cpp.Styles(), ", ")+"; default "+
+			cpp.StyleSnake+")",
+	)
+	flags.BoolVar(
+		&naming.StripExt, "strip-ext",
+		false,
+		"Leave file extensions out of resource IDs",
+	)
+	flags.StringVar(
+		&naming.StripPrefix, "strip-prefix",
+		"",
+		"Leave this prefix of resource paths or file names out of resource IDs",
+	)
+	flags.StringVar(
+		&naming.Namespace, "namespace",
+		"",
+		"The root C++ namespace, such as game::res (default "+
+			cpp.DefaultNamespace+")",
+	)
+	flags.BoolVar(
+		&naming.Nested, "nested",
+		false,
+		"Declare the IDs of each subdirectory in a nested namespace",
+	)
+	flags.StringVar(
+		&templates, "templates",
+		"",
+		"A directory of templates overriding the built-in C++ templates",
+	)
 
-	genCmd.PersistentFlags().IntVarP(
+	flags.IntVarP(
 		&level, "level", "l",
 		0,
 		"The compression level to use (0, 1, 2, 3, 9)",
 	)
+	flags.StringVar(
+		&codec, "codec",
+		compress.DefaultCodec,
+		"The compression codec to use ("+
+			strings.Join(compress.Codecs(), ", ")+")",
+	)
+	flags.Float64Var(
+		&maxRatio, "max-ratio",
+		gen.DefaultMaxRatio,
+		"Store resources uncompressed unless compressed under this fraction of their size (0 disables)",
+	)
 
-	genCmd.PersistentFlags().BoolVar(
+	flags.BoolVar(
+		&disambiguate, "disambiguate", false,
+		"Rename resources whose C++ names collide or are keywords, instead of failing",
+	)
+
+	flags.BoolVar(
 		&skipFinalize, "skip-finalize", false,
 		"Don't finalize generated files",
 	)
+
+	flags.BoolVar(
+		&force, "force", false,
+		"Regenerate all resources, even if they are unchanged",
+	)
+
+	flags.BoolVar(
+		&noPrune, "no-prune", false,
+		"Keep previously generated files which are no longer generated",
+	)
+
+	flags.BoolVar(
+		&stageOnDisk, "stage-on-disk", false,
+		"Stage generated files in a temporary directory instead of memory",
+	)
+	flags.Int64Var(
+		&stageThreshold, "stage-threshold", gen.DefaultStageThreshold,
+		"Total resource size in bytes above which to stage on disk",
+	)
+
+	flags.StringVar(
+		&graph, "graph", "",
+		"A graph file describing pipelines (overrides --from, --to, --match, and "+
+			"the settings of pipelines and targets, such as --codec and --kind)",
+	)
+}
+
+func init() {
+	rootCmd.AddCommand(genCmd)
+
+	addGenFlags(genCmd.PersistentFlags())
 }
@@ -1,51 +1,99 @@
-// Copyright © 2018 NAME HERE <EMAIL ADDRESS>
+// Copyright © 2018 Bodie Solomon <bodie@synapsegarden.net>
 //
-// Licensed under the Apache License, Version 2.0 (the "License");
-// you may not use this file except in compliance with the License.
-// You may obtain a copy of the License at
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
 //
-//     http://www.apache.org/licenses/LICENSE-2.0
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
 //
-// Unless required by applicable law or agreed to in writing, software
-// distributed under the License is distributed on an "AS IS" BASIS,
-// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
-// See the License for the specific language governing permissions and
-// limitations under the License.
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
 
 package cmd
 
 import (
 	"fmt"
+	"path/filepath"
+	"strings"
 
+	"github.com/phoenix-engine/phx/fs"
+	"github.com/phoenix-engine/phx/gen/compress"
+	"github.com/phoenix-engine/phx/project"
+
+	"github.com/pkg/errors"
 	"github.com/spf13/cobra"
 )
 
-// newCmd represents the new command
+var (
+	newTemplate  string
+	newCodec     string
+	newLZ4Remote string
+	newNoGit     bool
+)
+
+// newCmd creates a new project.
 var newCmd = &cobra.Command{
-	Use:   "new",
-	Short: "A brief description of your command",
-	Long: `A longer description that spans multiple lines and likely contains examples
-and usage of using your command. For example:
-
-Cobra is a CLI library for Go that empowers applications.
-This application is a tool to generate the needed files
-to quickly create a Cobra application.`,
-	Run: func(cmd *cobra.Command, args []string) {
-		fmt.Println("new called")
+	Use:   "new NAME",
+	Short: "Create a new C++ project",
+	Long: `Create a new C++ project in the directory NAME, which must be empty
+if it exists.
+
+The project has a res directory of resources, which "phx gen" generates
+a Resource library from, into its gen directory, using the settings in
+its .phx.yaml.  Its CMakeLists.txt builds an executable using it.
+
+Unless --no-git is given, the project is made a Git repo, and the LZ4
+library which the lz4 runtime builds is added as a submodule in gen/lz4.
+
+With --template, the files of the project are copied from a directory
+instead.  Files ending in .tmpl are executed as Go templates, with the
+.Name of the project, a C++ identifier .Ident derived from it, and its
+.Codec, and created without the extension.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		p := project.Project{
+			Name:      filepath.Base(args[0]),
+			Codec:     newCodec,
+			LZ4Remote: newLZ4Remote,
+			NoGit:     newNoGit,
+		}
+		if newTemplate != "" {
+			p.Template = fs.Real{Where: newTemplate}
+		}
+
+		if err := p.Create(args[0]); err != nil {
+			return errors.Wrapf(err, "creating project %s", args[0])
+		}
+
+		fmt.Printf("created project %s in %s\n", p.Name, args[0])
+		return nil
 	},
 }
 
 func init() {
-	// TODO: Enable.
-	// rootCmd.AddCommand(newCmd)
-
-	// Here you will define your flags and configuration settings.
-
-	// Cobra supports Persistent Flags which will work for this command
-	// and all subcommands, e.g.:
-	// newCmd.PersistentFlags().String("foo", "", "A help for foo")
+	rootCmd.AddCommand(newCmd)
 
-	// Cobra supports local flags which will only run when this command
-	// is called directly, e.g.:
-	// newCmd.Flags().BoolP("toggle", "t", false, "Help message for toggle")
+	newCmd.Flags().StringVar(
+		&newTemplate, "template", "",
+		"A directory of files to create the project from, instead of the built-in template",
+	)
+	newCmd.Flags().StringVar(
+		&newCodec, "codec",
+		compress.DefaultCodec,
+		"The compression codec of the project's resources ("+
+			strings.Join(compress.Codecs(), ", ")+")",
+	)
+	newCmd.Flags().StringVar(
+		&newLZ4Remote, "lz4-remote",
+		project.DefaultLZ4Remote,
+		"The Git remote of the LZ4 library",
+	)
+	newCmd.Flags().BoolVar(
+		&newNoGit, "no-git", false,
+		"Don't create a Git repo, or add dependencies to it",
+	)
 }
@@ -0,0 +1,179 @@
+// Copyright © 2018 Bodie Solomon <bodie@synapsegarden.net>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"text/tabwriter"
+
+	"github.com/phoenix-engine/phx/fs"
+	"github.com/phoenix-engine/phx/gen/cpp"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+var (
+	overwrite     bool
+	exportRuntime bool
+)
+
+// templatesCmd lists the built-in templates.
+var templatesCmd = &cobra.Command{
+	Use:   "templates",
+	Short: "List, export and diff the built-in C++ templates",
+	Long: `The C++ source generated by "phx gen" is created from templates,
+which a directory of templates passed with --templates can override.
+
+"phx gen templates export" writes the built-in templates into a new
+directory, to customize them.  After upgrading phx, "phx gen templates
+diff" shows how the templates in that directory differ from the new
+built-in templates, so changes to them can be merged.
+
+The sources of the runtime (mapper.cxx, resource.hpp and resource.cxx)
+are those of the runtime for --codec.  They are only exported with
+--runtime, since overriding them replaces the runtime of every codec.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return listTemplates(os.Stdout)
+	},
+}
+
+var templatesListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List the built-in templates and the files they create",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return listTemplates(os.Stdout)
+	},
+}
+
+var templatesExportCmd = &cobra.Command{
+	Use:   "export DIR",
+	Short: "Write the built-in templates into DIR",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return errors.Wrap(exportTemplates(args[0]), "exporting templates")
+	},
+}
+
+var templatesDiffCmd = &cobra.Command{
+	Use:   "diff [DIR]",
+	Short: "Show how the templates in DIR, or --templates, differ from the built-in templates",
+	Args:  cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		dir := templates
+		if len(args) > 0 {
+			dir = args[0]
+		}
+		if dir == "" {
+			return errors.New("no template directory given")
+		}
+
+		changed, err := cpp.Diff(os.Stdout, fs.Real{Where: dir}, codec)
+		if err != nil {
+			return errors.Wrapf(err, "diffing %s", dir)
+		}
+		if len(changed) == 0 {
+			fmt.Printf("the templates in %s match the built-in templates\n", dir)
+		}
+		return nil
+	},
+}
+
+func listTemplates(w io.Writer) error {
+	tw := new(tabwriter.Writer)
+	tw.Init(w, 0, 8, 2, ' ', 0)
+
+	fmt.Fprintln(tw, "TEMPLATE\tCREATES")
+	for _, id := range cpp.TemplateIDs() {
+		fmt.Fprintf(tw, "%s\t%s\n", id.File(), id.Output())
+	}
+	return tw.Flush()
+}
+
+// exportTemplates writes the built-in templates into the directory,
+// which is created if it doesn't exist.  The sources of the runtime are
+// only written with --runtime, and existing templates are only replaced
+// with --overwrite.
+func exportTemplates(dir string) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return errors.Wrapf(err, "creating %s", dir)
+	}
+
+	var (
+		ids []cpp.TemplateID
+		to  = fs.Real{Where: dir}
+	)
+	for _, id := range cpp.TemplateIDs() {
+		if exportRuntime || !id.Runtime() {
+			ids = append(ids, id)
+		}
+	}
+	if !overwrite {
+		for _, id := range ids {
+			_, err := os.Lstat(filepath.Join(dir, id.File()))
+			switch {
+			case err == nil:
+				return errors.Errorf("%s already exists (use --overwrite to replace it)",
+					filepath.Join(dir, id.File()))
+			case !os.IsNotExist(err):
+				return errors.Wrapf(err, "checking %s", id.File())
+			}
+		}
+	}
+
+	for _, id := range ids {
+		tmp, err := cpp.Builtin(id, codec)
+		if err != nil {
+			return err
+		}
+
+		f, err := to.Create(id.File())
+		if err != nil {
+			return errors.Wrapf(err, "creating %s", id.File())
+		}
+		if _, err := io.WriteString(f, tmp); err != nil {
+			f.Close()
+			return errors.Wrapf(err, "writing %s", id.File())
+		}
+		if err := f.Close(); err != nil {
+			return errors.Wrapf(err, "closing %s", id.File())
+		}
+	}
+
+	fmt.Printf("exported %d templates into %s\n", len(ids), dir)
+	return nil
+}
+
+func init() {
+	genCmd.AddCommand(templatesCmd)
+	templatesCmd.AddCommand(templatesListCmd)
+	templatesCmd.AddCommand(templatesExportCmd)
+	templatesCmd.AddCommand(templatesDiffCmd)
+
+	templatesExportCmd.Flags().BoolVar(
+		&overwrite, "overwrite", false,
+		"Replace templates which already exist in DIR",
+	)
+	templatesExportCmd.Flags().BoolVar(
+		&exportRuntime, "runtime", false,
+		"Also export the sources of the runtime for --codec",
+	)
+}
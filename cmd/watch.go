@@ -15,37 +15,62 @@
 package cmd
 
 import (
-	"fmt"
+	"os"
+	"os/signal"
+	"time"
 
+	"github.com/phoenix-engine/phx/gen"
+
+	"github.com/pkg/errors"
 	"github.com/spf13/cobra"
 )
 
+var debounce time.Duration
+
 // watchCmd represents the watch command
 var watchCmd = &cobra.Command{
 	Use:   "watch",
-	Short: "A brief description of your command",
-	Long: `A longer description that spans multiple lines and likely contains examples
-and usage of using your command. For example:
-
-Cobra is a CLI library for Go that empowers applications.
-This application is a tool to generate the needed files
-to quickly create a Cobra application.`,
-	Run: func(cmd *cobra.Command, args []string) {
-		fmt.Println("watch called")
+	Short: "Regenerate build deps when resources change",
+	Long: `Watch runs gen, and then runs it again whenever a file in the
+--from tree changes, or in the from tree of any pipeline of the --graph.
+Only changed resources are processed again.  It accepts the same flags
+as gen, and the same config.`,
+	PersistentPreRunE: applyGenConfig,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		stop := make(chan struct{})
+		sigs := make(chan os.Signal, 1)
+		signal.Notify(sigs, os.Interrupt)
+		go func() {
+			<-sigs
+			close(stop)
+		}()
+
+		w := gen.Watch{Debounce: debounce}
+		if graph != "" {
+			gens, err := makeGraph()
+			if err != nil {
+				return err
+			}
+			w.Graph = gens
+			return errors.Wrap(w.Run(stop), "watching gen graph")
+		}
+
+		g, err := makeGen()
+		if err != nil {
+			return err
+		}
+		w.Gen = g
+		return errors.Wrap(w.Run(stop), "watching gen pipeline")
 	},
 }
 
 func init() {
-	// TODO: Enable.
-	// rootCmd.AddCommand(watchCmd)
-
-	// Here you will define your flags and configuration settings.
+	rootCmd.AddCommand(watchCmd)
 
-	// Cobra supports Persistent Flags which will work for this command
-	// and all subcommands, e.g.:
-	// watchCmd.PersistentFlags().String("foo", "", "A help for foo")
+	addGenFlags(watchCmd.PersistentFlags())
 
-	// Cobra supports local flags which will only run when this command
-	// is called directly, e.g.:
-	// watchCmd.Flags().BoolP("toggle", "t", false, "Help message for toggle")
+	watchCmd.PersistentFlags().DurationVar(
+		&debounce, "debounce", gen.DefaultDebounce,
+		"How long to wait for further changes before regenerating",
+	)
 }
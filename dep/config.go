@@ -0,0 +1,130 @@
+package dep
+
+import (
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/pkg/errors"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// ConfigKey is the section of the config file which declares the Deps.
+const ConfigKey = "deps"
+
+type config struct {
+	Deps Deps `yaml:"deps"`
+}
+
+// ReadConfig reads the Deps in the deps section of the named config
+// file.  A config file which doesn't exist declares no Deps.
+func ReadConfig(name string) (Deps, error) {
+	bs, err := ioutil.ReadFile(name)
+	switch {
+	case os.IsNotExist(err):
+		return make(Deps), nil
+	case err != nil:
+		return nil, errors.Wrapf(err, "reading %s", name)
+	}
+
+	var c config
+	if err := yaml.Unmarshal(bs, &c); err != nil {
+		return nil, errors.Wrapf(err, "parsing %s", name)
+	}
+	if c.Deps == nil {
+		c.Deps = make(Deps)
+	}
+	return c.Deps, nil
+}
+
+// WriteConfig replaces the deps section of the named config file with
+// the given Deps, or removes it if there are none.  The rest of the file,
+// including its comments and line endings, is kept as it is.  Comments
+// at the top level just before the next setting are kept with it.  The
+// file is created if it doesn't exist.
+func WriteConfig(name string, deps Deps) error {
+	bs, err := ioutil.ReadFile(name)
+	if err != nil && !os.IsNotExist(err) {
+		return errors.Wrapf(err, "reading %s", name)
+	}
+
+	// The file is parsed to make sure the section can be found by
+	// its lines.
+	var settings yaml.MapSlice
+	if err := yaml.Unmarshal(bs, &settings); err != nil {
+		return errors.Wrapf(err, "parsing %s", name)
+	}
+	var declared bool
+	for _, s := range settings {
+		declared = declared || s.Key == ConfigKey
+	}
+
+	eol := "\n"
+	if strings.Contains(string(bs), "\r\n") {
+		eol = "\r\n"
+	}
+
+	var section []string
+	if len(deps) > 0 {
+		out, err := yaml.Marshal(config{deps})
+		if err != nil {
+			return errors.Wrapf(err, "encoding %s", ConfigKey)
+		}
+		section = lines(string(out))
+	}
+
+	ls := lines(string(bs))
+	start, end := findSection(ls)
+	if declared != (start < len(ls)) {
+		return errors.Errorf("finding the %s section of %s", ConfigKey, name)
+	}
+
+	ls = append(ls[:start], append(section, ls[end:]...)...)
+	var content string
+	if len(ls) > 0 {
+		content = strings.Join(ls, eol) + eol
+	}
+	return errors.Wrapf(ioutil.WriteFile(name, []byte(content), 0644),
+		"writing %s", name)
+}
+
+// findSection returns the range of the given lines holding the deps
+// section, which is empty at their end if there is none.  The section
+// runs from its key to the next line at the top level, other than
+// comments, and then blank lines and comments at its end are left out.
+func findSection(ls []string) (start, end int) {
+	start, end = len(ls), len(ls)
+	for i, l := range ls {
+		if l == ConfigKey+":" || strings.HasPrefix(l, ConfigKey+": ") ||
+			strings.HasPrefix(l, ConfigKey+":\t") {
+			start, end = i, i+1
+			break
+		}
+	}
+
+	topLevel := func(l string) bool {
+		return l != "" && !strings.HasPrefix(l, " ") &&
+			!strings.HasPrefix(l, "\t") && !strings.HasPrefix(l, "#")
+	}
+	for end < len(ls) && !topLevel(ls[end]) {
+		end++
+	}
+	for end > start+1 && !strings.HasPrefix(ls[end-1], " ") &&
+		!strings.HasPrefix(ls[end-1], "\t") {
+		end--
+	}
+	return start, end
+}
+
+// lines splits s into lines, without their line endings.
+func lines(s string) []string {
+	if s == "" {
+		return nil
+	}
+	s = strings.TrimSuffix(strings.TrimSuffix(s, "\n"), "\r")
+	ls := strings.Split(s, "\n")
+	for i, l := range ls {
+		ls[i] = strings.TrimSuffix(l, "\r")
+	}
+	return ls
+}
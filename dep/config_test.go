@@ -0,0 +1,132 @@
+package dep_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/phoenix-engine/phx/dep"
+	pt "github.com/phoenix-engine/phx/testing"
+)
+
+func TestWriteConfig(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "phx-dep-test")
+	if err != nil {
+		t.Fatalf("expected nil error, got %#v", err)
+	}
+	defer os.RemoveAll(tmp)
+
+	lz4 := dep.Deps{"lz4": {Remote: "r", Local: "gen/lz4"}}
+
+	for i, test := range []struct {
+		should string
+
+		given string
+		deps  dep.Deps
+
+		expect    string
+		expectErr string
+	}{{
+		should: "create the config",
+		deps:   lz4,
+
+		expect: "deps:\n  lz4:\n    remote: r\n    local: gen/lz4\n",
+	}, {
+		should: "keep an empty config empty",
+		given:  "",
+		deps:   dep.Deps{},
+	}, {
+		should: "append the deps, keeping the comments",
+		given:  "# Settings.\n\n# More.\ngen:\n  to: gen # Where.\n",
+		deps:   lz4,
+
+		expect: "# Settings.\n\n# More.\ngen:\n  to: gen # Where.\n" +
+			"deps:\n  lz4:\n    remote: r\n    local: gen/lz4\n",
+	}, {
+		should: "replace the deps in place",
+		given: "gen:\n  to: gen\n" +
+			"deps:\n  # Old.\n  x:\n    remote: x\n\n" +
+			"# Other.\nother: 1\n",
+		deps: dep.Deps{"lz4": {
+			Remote: "r", Local: "l", Revision: "v1",
+		}},
+
+		expect: "gen:\n  to: gen\n" +
+			"deps:\n  lz4:\n    remote: r\n    local: l\n    revision: v1\n" +
+			"\n# Other.\nother: 1\n",
+	}, {
+		should: "replace deps with comments at the top level",
+		given: "deps:\n  a:\n    remote: a\n# Column 0.\n  b:\n    remote: b\n" +
+			"gen:\n  to: gen\n",
+		deps: dep.Deps{"b": {Remote: "b2"}},
+
+		expect: "deps:\n  b:\n    remote: b2\n    local: \"\"\ngen:\n  to: gen\n",
+	}, {
+		should: "remove deps with comments at the top level",
+		given:  "deps:\n  a:\n    remote: a\n# Column 0.\n  b:\n    remote: b\n",
+		deps:   dep.Deps{},
+	}, {
+		should: "replace deps in flow style",
+		given:  "gen: {to: gen} # Flow.\ndeps: {}\n",
+		deps:   lz4,
+
+		expect: "gen: {to: gen} # Flow.\n" +
+			"deps:\n  lz4:\n    remote: r\n    local: gen/lz4\n",
+	}, {
+		should: "keep CRLF line endings",
+		given:  "# Settings.\r\ndeps:\r\n  x:\r\n    remote: x\r\ngen:\r\n  to: gen\r\n",
+		deps:   lz4,
+
+		expect: "# Settings.\r\n" +
+			"deps:\r\n  lz4:\r\n    remote: r\r\n    local: gen/lz4\r\n" +
+			"gen:\r\n  to: gen\r\n",
+	}, {
+		should: "remove the deps if there are none",
+		given:  "deps:\n  x:\n    remote: x\ngen:\n  to: gen\n",
+		deps:   dep.Deps{},
+
+		expect: "gen:\n  to: gen\n",
+	}, {
+		should:    "reject a config which isn't YAML",
+		given:     "deps: [\n",
+		deps:      lz4,
+		expectErr: "parsing .*config.yaml",
+	}, {
+		should:    "reject deps which can't be found by their lines",
+		given:     "\"deps\": {}\n",
+		deps:      lz4,
+		expectErr: "finding the deps section of .*config.yaml",
+	}} {
+		t.Logf("test %d: should %s", i, test.should)
+
+		name := filepath.Join(tmp, "config.yaml")
+		os.Remove(name)
+		if test.given != "" {
+			err := ioutil.WriteFile(name, []byte(test.given), 0644)
+			if err != nil {
+				t.Fatalf("expected nil error, got %#v", err)
+			}
+		}
+
+		err := dep.WriteConfig(name, test.deps)
+		if !pt.CheckErrMatches(t, err, test.expectErr) || err != nil {
+			continue
+		}
+		bs, err := ioutil.ReadFile(name)
+		if !pt.CheckErrMatches(t, err, "") {
+			continue
+		}
+		pt.CheckEq(t, string(bs), test.expect)
+
+		// The deps read back as they were written.
+		deps, err := dep.ReadConfig(name)
+		if !pt.CheckErrMatches(t, err, "") {
+			continue
+		}
+		pt.CheckEq(t, len(deps), len(test.deps))
+		for name, d := range test.deps {
+			pt.CheckEq(t, deps[name], d)
+		}
+	}
+}
@@ -0,0 +1,297 @@
+// Package dep manages the Git repositories a project depends on, which
+// are declared in the deps section of its config file, and locked to
+// the commits they were resolved to in its LockFile, so that every
+// checkout of the project builds the same sources.
+//
+//	deps:
+//	  lz4:
+//	    remote: https://github.com/lz4/lz4
+//	    local: gen/lz4
+//	    revision: v1.8.3
+package dep
+
+import (
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+
+	"github.com/phoenix-engine/phx/gen"
+
+	"github.com/pkg/errors"
+)
+
+// ConfigName is the name of the config file of a project, in its root.
+const ConfigName = ".phx.yaml"
+
+// Dep is a Git repository which a project depends on.
+type Dep struct {
+	// Remote is the Git remote of the Dep, and Local is the path it
+	// is checked out into, relative to the root of the project.
+	Remote string `yaml:"remote"`
+	Local  string `yaml:"local"`
+
+	// Branch, if set, is the branch a submodule of the Dep tracks.
+	// Revision, if set, is the tag, commit or branch which the Dep
+	// is locked to, instead of the Branch or the head of the Remote.
+	Branch   string `yaml:"branch,omitempty"`
+	Revision string `yaml:"revision,omitempty"`
+}
+
+// Module returns the GitModule which checks out the Dep.
+func (d Dep) Module() gen.GitModule {
+	return gen.GitModule{Remote: d.Remote, Local: d.Local, Branch: d.Branch}
+}
+
+// Deps are the Deps of a project, by name.
+type Deps map[string]Dep
+
+// Names returns the names of the Deps, in order.
+func (d Deps) Names() []string {
+	names := make([]string, 0, len(d))
+	for name := range d {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+var validName = regexp.MustCompile(`^[\w.-]+$`)
+
+func (d Deps) check() error {
+	locals := make(map[string]string)
+	for _, name := range d.Names() {
+		dep := d[name]
+		switch {
+		case !validName.MatchString(name):
+			return errors.Errorf("invalid dep name %q", name)
+		case dep.Remote == "":
+			return errors.Errorf("dep %s has no remote", name)
+		case dep.Local == "":
+			return errors.Errorf("dep %s has no local path", name)
+		}
+
+		local := filepath.Clean(dep.Local)
+		if other, ok := locals[local]; ok {
+			return errors.Errorf("deps %s and %s are both in %s",
+				other, name, dep.Local)
+		}
+		locals[local] = name
+	}
+	return nil
+}
+
+// Project is a project whose Deps are declared in its Config file, and
+// locked in the LockFile in its Root.
+type Project struct {
+	// Root is the root directory of the project, which the Local path
+	// of each Dep is relative to.
+	Root string
+
+	// Config is the path of the config file of the project.  If it is
+	// empty, ConfigName in the Root is used.
+	Config string
+
+	// Overwrite discards local modifications of the checkouts of the
+	// Deps when they are synced, as in gen.GitModule.
+	Overwrite bool
+}
+
+func (p Project) config() string {
+	if p.Config != "" {
+		return p.Config
+	}
+	return filepath.Join(p.Root, ConfigName)
+}
+
+func (p Project) lock() string {
+	return filepath.Join(p.Root, LockFile)
+}
+
+// Deps returns the Deps declared in the Project's Config.
+func (p Project) Deps() (Deps, error) {
+	return ReadConfig(p.config())
+}
+
+// Lock returns the Lock of the Project.
+func (p Project) Lock() (Lock, error) {
+	return ReadLock(p.lock())
+}
+
+// Add declares the named Dep in the Project's Config, replacing any Dep
+// of the same name, and syncs it.  If its Local path is empty, it is
+// checked out into "deps/<name>".
+func (p Project) Add(name string, dep Dep) error {
+	deps, err := p.Deps()
+	if err != nil {
+		return err
+	}
+
+	if dep.Local == "" {
+		dep.Local = path.Join("deps", name)
+	}
+	deps[name] = dep
+	if err := deps.check(); err != nil {
+		return err
+	}
+
+	if err := WriteConfig(p.config(), deps); err != nil {
+		return err
+	}
+	_, err = p.Sync(name)
+	return err
+}
+
+// Remove removes the named Dep from the Project's Config and Lock, and
+// removes its checkout.
+func (p Project) Remove(name string) error {
+	deps, err := p.Deps()
+	if err != nil {
+		return err
+	}
+	dep, ok := deps[name]
+	if !ok {
+		return errors.Errorf("no dep %s in %s", name, p.config())
+	}
+
+	lock, err := p.Lock()
+	if err != nil {
+		return err
+	}
+
+	if err := dep.Module().Remove(p.Root); err != nil {
+		return errors.Wrapf(err, "removing dep %s", name)
+	}
+
+	delete(deps, name)
+	if err := WriteConfig(p.config(), deps); err != nil {
+		return err
+	}
+	delete(lock, name)
+	return lock.Write(p.lock())
+}
+
+// Status is the status of the checkout of the named Dep.
+type Status struct {
+	Name string
+	gen.ModuleStatus
+}
+
+// Check returns the Status of the checkout of each Dep, as compared to
+// the commit it is locked to, without changing it.  The Expected commit
+// of a Dep which isn't locked is that of its Revision.
+func (p Project) Check() ([]Status, error) {
+	deps, err := p.Deps()
+	if err != nil {
+		return nil, err
+	}
+	lock, err := p.Lock()
+	if err != nil {
+		return nil, err
+	}
+
+	var sts []Status
+	for _, name := range deps.Names() {
+		dep := deps[name]
+		m := dep.Module()
+		if l := lock[name]; l.matches(dep) {
+			m.Revision = l.Commit
+		}
+
+		st, err := m.Check(p.Root)
+		if err != nil {
+			return nil, errors.Wrapf(err, "checking dep %s", name)
+		}
+		sts = append(sts, Status{name, st})
+	}
+	return sts, nil
+}
+
+// Sync checks out each Dep of the Project at the commit it is locked to,
+// and updates the Lock.  A Dep which isn't locked, or whose Remote or
+// Revision differ from those it was locked with, is locked to the commit
+// its Revision resolves to.  The named Deps are resolved again even if
+// they are locked, to update them.  Deps which are no longer declared
+// are dropped from the Lock, which is only written once every Dep is
+// synced.
+//
+// It returns the Status of each Dep as it was found.  A checkout with
+// local modifications is an error, unless it is at the locked commit or
+// Overwrite is set.
+func (p Project) Sync(update ...string) ([]Status, error) {
+	deps, err := p.Deps()
+	if err != nil {
+		return nil, err
+	}
+	if err := deps.check(); err != nil {
+		return nil, err
+	}
+
+	lock, err := p.Lock()
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range update {
+		if _, ok := deps[name]; !ok {
+			return nil, errors.Errorf("no dep %s in %s", name, p.config())
+		}
+		delete(lock, name)
+	}
+
+	var (
+		sts    []Status
+		synced = make(Lock)
+	)
+	for _, name := range deps.Names() {
+		st, locked, err := p.sync(deps[name], lock[name])
+		if err != nil {
+			return nil, errors.Wrapf(err, "syncing dep %s", name)
+		}
+		sts = append(sts, Status{name, st})
+		synced[name] = locked
+	}
+
+	return sts, synced.Write(p.lock())
+}
+
+func (p Project) sync(dep Dep, locked Locked) (gen.ModuleStatus, Locked, error) {
+	root, m := p.Root, dep.Module()
+	m.Overwrite = p.Overwrite
+	if locked.matches(dep) {
+		m.Revision = locked.Commit
+		st, err := m.Operate(root)
+		return st, locked, err
+	}
+
+	// Check out the Dep, to resolve its Revision in, and then lock it
+	// to that commit.
+	m.Revision = ""
+	st, err := m.Operate(root)
+	if err != nil {
+		return st, Locked{}, err
+	}
+	commit, err := m.Resolve(root, dep.Revision)
+	if err != nil {
+		return st, Locked{}, err
+	}
+
+	m.Revision = commit
+	after, err := m.Operate(root)
+	if err != nil {
+		return st, Locked{}, err
+	}
+	// A Dep which was checked out already drifted from the commit if
+	// it was at another one.
+	st.Drift |= after.Drift &^ gen.DriftCommit
+	if st.Drift&(gen.DriftMissing|gen.DriftUninitialized) == 0 &&
+		st.Commit != commit {
+		st.Drift |= gen.DriftCommit
+	}
+	st.Commit, st.Expected = after.Commit, commit
+
+	return st, Locked{
+		Remote:   dep.Remote,
+		Revision: dep.Revision,
+		Commit:   commit,
+	}, nil
+}
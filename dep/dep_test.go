@@ -0,0 +1,201 @@
+package dep_test
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/phoenix-engine/phx/dep"
+	"github.com/phoenix-engine/phx/gen"
+	pt "github.com/phoenix-engine/phx/testing"
+)
+
+// git runs git in the given directory, allowing local remotes to be
+// used for submodules.
+func git(t *testing.T, dir string, args ...string) string {
+	t.Helper()
+
+	cmd := exec.Command("git", append([]string{
+		"-c", "protocol.file.allow=always",
+		"-c", "user.name=phx", "-c", "user.email=phx@example.com",
+	}, args...)...)
+	cmd.Dir = dir
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("git %s: %v\n%s", strings.Join(args, " "), err, out)
+	}
+	return strings.TrimSpace(string(out))
+}
+
+// makeRemote creates a bare Git repo in dir with a commit for each of
+// the given contents of a file, each tagged with the content, and
+// returns the commits.
+func makeRemote(t *testing.T, dir string, contents ...string) []string {
+	t.Helper()
+
+	bare, work := filepath.Join(dir, "lib.git"), filepath.Join(dir, "work")
+	git(t, dir, "init", "--quiet", "--bare", bare)
+	git(t, dir, "clone", "--quiet", bare, work)
+
+	var commits []string
+	for _, c := range contents {
+		err := ioutil.WriteFile(filepath.Join(work, "f"), []byte(c), 0644)
+		if err != nil {
+			t.Fatalf("expected nil error, got %#v", err)
+		}
+		git(t, work, "add", "f")
+		git(t, work, "commit", "--quiet", "-m", c)
+		git(t, work, "tag", c)
+		commits = append(commits, git(t, work, "rev-parse", "HEAD"))
+	}
+	git(t, work, "push", "--quiet", "--tags", "origin", "HEAD")
+
+	return commits
+}
+
+func TestProject(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+
+	// Submodules of local remotes are only allowed by config.
+	for k, v := range map[string]string{
+		"GIT_CONFIG_COUNT":   "1",
+		"GIT_CONFIG_KEY_0":   "protocol.file.allow",
+		"GIT_CONFIG_VALUE_0": "always",
+	} {
+		defer os.Setenv(k, os.Getenv(k))
+		os.Setenv(k, v)
+	}
+
+	tmp, err := ioutil.TempDir("", "phx-dep-test")
+	if err != nil {
+		t.Fatalf("expected nil error, got %#v", err)
+	}
+	defer os.RemoveAll(tmp)
+
+	commits := makeRemote(t, tmp, "v1", "v2")
+	remote := filepath.Join(tmp, "lib.git")
+
+	for _, inRepo := range []bool{false, true} {
+		root := filepath.Join(tmp, "clone")
+		if inRepo {
+			root = filepath.Join(tmp, "submodule")
+		}
+		if err := os.Mkdir(root, 0755); err != nil {
+			t.Fatalf("expected nil error, got %#v", err)
+		}
+		if inRepo {
+			git(t, root, "init", "--quiet")
+		}
+
+		var (
+			p = dep.Project{Root: root}
+
+			checkFile = func(expect string) {
+				t.Helper()
+				bs, err := ioutil.ReadFile(filepath.Join(root, "deps", "lib", "f"))
+				pt.CheckErrMatches(t, err, "")
+				pt.CheckEq(t, string(bs), expect)
+			}
+			checkSync = func(p dep.Project, expect map[string]gen.Drift, match string) {
+				t.Helper()
+				sts, err := p.Sync()
+				if !pt.CheckErrMatches(t, err, match) || err != nil {
+					return
+				}
+				// Deps without drift are expected to have none.
+				pt.CheckEq(t, len(sts), 2)
+				for _, st := range sts {
+					pt.CheckEq(t, st.Drift, expect[st.Name])
+					pt.CheckEq(t, st.Commit, st.Expected)
+				}
+			}
+			checkLock = func(name string, expect dep.Locked) {
+				t.Helper()
+				lock, err := p.Lock()
+				pt.CheckErrMatches(t, err, "")
+				pt.CheckEq(t, lock[name], expect)
+			}
+		)
+
+		t.Logf("in a Git repo: %t", inRepo)
+
+		// A Dep is locked to the commit of its Revision.
+		err := p.Add("lib", dep.Dep{Remote: remote, Revision: "v1"})
+		pt.CheckErrMatches(t, err, "")
+		checkFile("v1")
+		checkLock("lib", dep.Locked{
+			Remote: remote, Revision: "v1", Commit: commits[0],
+		})
+
+		deps, err := p.Deps()
+		pt.CheckErrMatches(t, err, "")
+		pt.CheckEq(t, deps["lib"], dep.Dep{
+			Remote: remote, Local: "deps/lib", Revision: "v1",
+		})
+
+		// A Dep without a Revision is locked to the head of its
+		// remote, and stays there when it is synced again.
+		err = p.Add("head", dep.Dep{Remote: remote, Local: "head"})
+		pt.CheckErrMatches(t, err, "")
+		checkLock("head", dep.Locked{Remote: remote, Commit: commits[1]})
+
+		// Sync checks out the locked commit, and reports the drift.
+		lib := filepath.Join(root, "deps", "lib")
+		checkSync(p, map[string]gen.Drift{}, "")
+		git(t, lib, "checkout", "--quiet", "v2")
+		checkSync(p, map[string]gen.Drift{"lib": gen.DriftCommit}, "")
+		checkFile("v1")
+
+		// Local modifications are kept at the locked commit.
+		err = ioutil.WriteFile(filepath.Join(lib, "f"), []byte("mod"), 0644)
+		pt.CheckErrMatches(t, err, "")
+		checkSync(p, map[string]gen.Drift{"lib": gen.DriftModified}, "")
+		checkFile("mod")
+
+		// A changed Revision is resolved again, but a modified
+		// checkout is only moved with Overwrite.
+		deps["lib"] = dep.Dep{Remote: remote, Local: "deps/lib", Revision: "v2"}
+		deps["head"] = dep.Dep{Remote: remote, Local: "head"}
+		pt.CheckErrMatches(t, dep.WriteConfig(filepath.Join(root, dep.ConfigName), deps), "")
+		checkSync(p, nil, `^syncing dep lib: deps/lib has local modifications`)
+		checkFile("mod")
+		checkLock("lib", dep.Locked{
+			Remote: remote, Revision: "v1", Commit: commits[0],
+		})
+
+		over := p
+		over.Overwrite = true
+		checkSync(over, map[string]gen.Drift{
+			"lib": gen.DriftCommit | gen.DriftModified,
+		}, "")
+		checkFile("v2")
+		checkLock("lib", dep.Locked{
+			Remote: remote, Revision: "v2", Commit: commits[1],
+		})
+
+		_, err = p.Sync("nope")
+		pt.CheckErrMatches(t, err, `^no dep nope in `)
+		pt.CheckErrMatches(t, p.Add("bad name", dep.Dep{Remote: remote}),
+			`^invalid dep name "bad name"$`)
+		pt.CheckErrMatches(t, p.Add("other", dep.Dep{Remote: remote, Local: "head"}),
+			`^deps head and other are both in head$`)
+		pt.CheckErrMatches(t, p.Add("missing", dep.Dep{
+			Remote: remote, Revision: "v3",
+		}), `^syncing dep missing: no revision v3 in `)
+		pt.CheckErrMatches(t, p.Remove("missing"), "")
+
+		// Removing a Dep removes its checkout and its lock.
+		pt.CheckErrMatches(t, p.Remove("lib"), "")
+		pt.CheckErrMatches(t, p.Remove("lib"), `^no dep lib in `)
+		if _, err := os.Stat(filepath.Join(root, "deps", "lib")); !os.IsNotExist(err) {
+			t.Errorf("expected deps/lib to be removed, got %#v", err)
+		}
+		checkLock("lib", dep.Locked{})
+		checkLock("head", dep.Locked{Remote: remote, Commit: commits[1]})
+	}
+}
@@ -0,0 +1,75 @@
+package dep
+
+import (
+	"io/ioutil"
+	"os"
+
+	"github.com/pkg/errors"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// LockFile is the name of the file in the root of a project which locks
+// its Deps to the commits they were resolved to.  It should be committed
+// with the project.
+const LockFile = "phx.lock"
+
+// lockHeader is written at the top of the LockFile.
+const lockHeader = "# Generated by \"phx dep\".  Do not edit.\n"
+
+// Locked is the commit a Dep is locked to, with the Remote and Revision
+// of the Dep it was resolved for.
+type Locked struct {
+	Remote   string `yaml:"remote"`
+	Revision string `yaml:"revision,omitempty"`
+	Commit   string `yaml:"commit"`
+}
+
+// matches returns true if the Locked commit was resolved for the Dep.
+func (l Locked) matches(dep Dep) bool {
+	return l.Commit != "" && l.Remote == dep.Remote &&
+		l.Revision == dep.Revision
+}
+
+// Lock is the Locked commit of each Dep of a project, by name.
+type Lock map[string]Locked
+
+type lockFile struct {
+	Deps Lock `yaml:"deps"`
+}
+
+// ReadLock reads the named LockFile.  A LockFile which doesn't exist
+// locks no Deps.
+func ReadLock(name string) (Lock, error) {
+	bs, err := ioutil.ReadFile(name)
+	switch {
+	case os.IsNotExist(err):
+		return make(Lock), nil
+	case err != nil:
+		return nil, errors.Wrapf(err, "reading %s", name)
+	}
+
+	var l lockFile
+	if err := yaml.Unmarshal(bs, &l); err != nil {
+		return nil, errors.Wrapf(err, "parsing %s", name)
+	}
+	if l.Deps == nil {
+		l.Deps = make(Lock)
+	}
+	return l.Deps, nil
+}
+
+// Write writes the Lock into the named file, with its Deps in order so
+// that it only changes when they do.
+func (l Lock) Write(name string) error {
+	if l == nil {
+		l = make(Lock)
+	}
+	bs, err := yaml.Marshal(lockFile{l})
+	if err != nil {
+		return errors.Wrapf(err, "encoding %s", name)
+	}
+
+	return errors.Wrapf(ioutil.WriteFile(name,
+		append([]byte(lockHeader), bs...), 0644,
+	), "writing %s", name)
+}
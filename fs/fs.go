@@ -1,11 +1,13 @@
 package fs
 
 import (
+	"bytes"
 	"io"
 	"io/ioutil"
 	"os"
 	"path/filepath"
 	"reflect"
+	"syscall"
 
 	kfs "github.com/kr/fs"
 	"github.com/pkg/errors"
@@ -17,6 +19,7 @@ type FS interface {
 	Open(string) (io.ReadCloser, error)
 	Create(string) (io.WriteCloser, error)
 	Move(from, to string) error
+	Remove(string) error
 	Split(path string) (parent, rest string)
 }
 
@@ -68,8 +71,21 @@ func (r Real) Open(name string) (io.ReadCloser, error) {
 	return os.Open(r.Join(r.Where, name))
 }
 
+// Create creates the named file, and any parent directories it needs.
 func (r Real) Create(name string) (io.WriteCloser, error) {
-	return os.Create(r.Join(r.Where, name))
+	f, err := os.Create(r.Join(r.Where, name))
+	if os.IsNotExist(err) {
+		// The parent directory didn't exist.
+		parent, _ := r.Split(name)
+		if err := r.Mkdir(0755, parent); err != nil {
+			return nil, errors.Wrapf(err, "creating %s", parent)
+		}
+		f, err = os.Create(r.Join(r.Where, name))
+	}
+	if err != nil {
+		return nil, err
+	}
+	return f, nil
 }
 
 func (r Real) Move(from, to string) error {
@@ -79,6 +95,10 @@ func (r Real) Move(from, to string) error {
 	)
 }
 
+func (r Real) Remove(name string) error {
+	return os.Remove(r.Join(r.Where, name))
+}
+
 func (r Real) Mkdir(perm os.FileMode, path ...string) error {
 	return os.MkdirAll(
 		r.Join(append([]string{r.Where}, path...)...),
@@ -86,12 +106,72 @@ func (r Real) Mkdir(perm os.FileMode, path ...string) error {
 	)
 }
 
+// Files walks the given FS from the given root, and returns the
+// slash-separated paths of all non-directory entries it finds, in
+// lexical order.  The paths are relative to the root of the FS, not to
+// the given root.
+func Files(f FS, root string) ([]string, error) {
+	var names []string
+
+	w := kfs.WalkFS(root, f)
+	for w.Step() {
+		if err := w.Err(); err != nil {
+			return nil, errors.Wrapf(err, "walking %s", w.Path())
+		}
+
+		if w.Stat().IsDir() {
+			continue
+		}
+
+		names = append(names, filepath.ToSlash(w.Path()))
+	}
+
+	return names, nil
+}
+
+// Same returns true if the file pA in FS a has the same contents as the
+// file pB in FS b.  If pB does not exist, Same returns false.
+func Same(a, b FS, pA, pB string) (bool, error) {
+	fB, err := b.Open(pB)
+	switch {
+	case os.IsNotExist(err):
+		return false, nil
+	case err != nil:
+		return false, errors.Wrapf(err, "opening %s", pB)
+	}
+	defer fB.Close()
+
+	fA, err := a.Open(pA)
+	if err != nil {
+		return false, errors.Wrapf(err, "opening %s", pA)
+	}
+	defer fA.Close()
+
+	bA, bB := make([]byte, 4096), make([]byte, 4096)
+	for {
+		nA, eA := io.ReadFull(fA, bA)
+		nB, eB := io.ReadFull(fB, bB)
+
+		switch {
+		case nA != nB, !bytes.Equal(bA[:nA], bB[:nB]):
+			return false, nil
+		case eA != nil && eA != io.ErrUnexpectedEOF && eA != io.EOF:
+			return false, errors.Wrapf(eA, "reading %s", pA)
+		case eB != nil && eB != io.ErrUnexpectedEOF && eB != io.EOF:
+			return false, errors.Wrapf(eB, "reading %s", pB)
+		case eA != nil || eB != nil:
+			// Both reached the end at the same offset.
+			return eA != nil && eB != nil, nil
+		}
+	}
+}
+
 // Move is not concurrency-safe.
 func Move(from, to FS, pFrom, pTo string) error {
 	tFrom, tTo := reflect.TypeOf(from), reflect.TypeOf(to)
-	kf := KindOf(tFrom)
+	kf, known := kinds[tFrom]
 	switch {
-	case tFrom != tTo:
+	case tFrom != tTo, !known:
 		// We don't have the same type, so we can't move.
 
 	case kf == KindReal:
@@ -120,11 +200,17 @@ func Move(from, to FS, pFrom, pTo string) error {
 					"creating %s",
 					parentTo)
 			}
+			err = os.Rename(
+				filepath.Join(fromReal.Where, pFrom),
+				filepath.Join(toReal.Where, pTo),
+			)
 		}
-		return os.Rename(
-			filepath.Join(fromReal.Where, pFrom),
-			filepath.Join(toReal.Where, pTo),
-		)
+		if le, ok := err.(*os.LinkError); !ok || le.Err != syscall.EXDEV {
+			return err
+		}
+
+		// The prefixes are on different devices, so fall back
+		// to copying.
 
 	case kf == KindMem:
 		if from == to {
@@ -1,8 +1,46 @@
 package fs_test
 
 import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
 	"github.com/phoenix-engine/phx/fs"
 )
 
 var _ = fs.FS(fs.Real{})
 var _ = fs.FS(fs.Mem{})
+
+func TestFiles(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "phx-fs-test")
+	if err != nil {
+		t.Fatalf("expected nil error, got %#v", err)
+	}
+	defer os.RemoveAll(tmp)
+
+	for _, name := range []string{
+		"b.txt",
+		"a/c.txt",
+		"a/b/d.txt",
+	} {
+		p := filepath.Join(tmp, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatalf("expected nil error, got %#v", err)
+		}
+		if err := ioutil.WriteFile(p, nil, 0644); err != nil {
+			t.Fatalf("expected nil error, got %#v", err)
+		}
+	}
+
+	got, err := fs.Files(fs.Real{Where: tmp}, "")
+	if err != nil {
+		t.Fatalf("expected nil error, got %#v", err)
+	}
+
+	expect := []string{"a/b/d.txt", "a/c.txt", "b.txt"}
+	if !reflect.DeepEqual(got, expect) {
+		t.Errorf("expected %#v, got %#v", expect, got)
+	}
+}
@@ -0,0 +1,31 @@
+//go:build !windows
+// +build !windows
+
+package fs
+
+import (
+	"os"
+	"syscall"
+
+	"github.com/pkg/errors"
+)
+
+// Lock takes an exclusive lock on the file at the given path, creating
+// it if needed, and waits until the lock is available.  The returned
+// func releases the lock.  The lock file is not removed.
+func Lock(path string) (func() error, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return nil, errors.Wrapf(err, "opening lock %s", path)
+	}
+
+	if err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX); err != nil {
+		f.Close()
+		return nil, errors.Wrapf(err, "locking %s", path)
+	}
+
+	return func() error {
+		// Closing the file releases the lock.
+		return errors.Wrapf(f.Close(), "unlocking %s", path)
+	}, nil
+}
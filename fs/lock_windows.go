@@ -0,0 +1,32 @@
+package fs
+
+import (
+	"os"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Lock takes an exclusive lock by creating the file at the given path,
+// and waits until the lock is available.  The returned func releases
+// the lock by removing the file.
+//
+// TODO: Use LockFileEx so a crashed process doesn't leave a stale lock.
+func Lock(path string) (func() error, error) {
+	for {
+		f, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_RDWR, 0644)
+		switch {
+		case err == nil:
+			f.Close()
+			return func() error {
+				return errors.Wrapf(os.Remove(path), "unlocking %s", path)
+			}, nil
+
+		case os.IsExist(err):
+			time.Sleep(100 * time.Millisecond)
+
+		default:
+			return nil, errors.Wrapf(err, "locking %s", path)
+		}
+	}
+}
@@ -3,9 +3,11 @@ package fs
 import (
 	"bytes"
 	"io"
+	"io/ioutil"
 	"os"
 	"sort"
 	"sync"
+	"time"
 
 	kfs "github.com/kr/fs"
 )
@@ -20,13 +22,24 @@ type Mem struct {
 	bufs map[string]BufCloser
 }
 
+// MemInfo implements os.FileInfo for a buffer in a Mem.  The root of a
+// Mem, "", is its only directory.
 type MemInfo struct {
-	os.FileInfo
 	name string
+	size int64
+	dir  bool
 }
 
-func (m MemInfo) Name() string {
-	return m.name
+func (m MemInfo) Name() string       { return m.name }
+func (m MemInfo) Size() int64        { return m.size }
+func (m MemInfo) IsDir() bool        { return m.dir }
+func (m MemInfo) ModTime() time.Time { return time.Time{} }
+func (m MemInfo) Sys() interface{}   { return nil }
+func (m MemInfo) Mode() os.FileMode {
+	if m.dir {
+		return os.ModeDir | 0755
+	}
+	return 0644
 }
 
 type SyncMem struct {
@@ -42,6 +55,8 @@ func MakeSyncMem() SyncMem {
 	}
 }
 
+// ReadDir returns a MemInfo for every buffer in the Mem, named by its
+// full path.
 func (m Mem) ReadDir(some string) (infos []os.FileInfo, err error) {
 	var names []string
 	for k := range m.bufs {
@@ -49,12 +64,27 @@ func (m Mem) ReadDir(some string) (infos []os.FileInfo, err error) {
 	}
 	sort.Strings(names)
 	for _, name := range names {
-		infos = append(infos, MemInfo{name: name})
+		infos = append(infos, MemInfo{
+			name: name,
+			size: int64(m.bufs[name].Len()),
+		})
 	}
 
 	return
 }
 
+// Lstat returns a MemInfo for the buffer at path, if it exists, or for
+// the root of the Mem.
+func (m Mem) Lstat(path string) (os.FileInfo, error) {
+	if path == "" {
+		return MemInfo{dir: true}, nil
+	}
+	if buf, ok := m.bufs[path]; ok {
+		return MemInfo{name: path, size: int64(buf.Len())}, nil
+	}
+	return nil, os.ErrNotExist
+}
+
 func (m Mem) Join(subs ...string) string {
 	return Real{}.Join(subs...)
 }
@@ -63,9 +93,11 @@ func (m Mem) Split(some string) (parent, rest string) {
 	return Real{}.Split(some)
 }
 
+// Open returns a reader over the contents of the buffer at path.
+// Reading from it does not consume the buffer.
 func (m Mem) Open(path string) (io.ReadCloser, error) {
 	if buf, ok := m.bufs[path]; ok {
-		return buf, nil
+		return ioutil.NopCloser(bytes.NewReader(buf.Bytes())), nil
 	}
 	return nil, os.ErrNotExist
 }
@@ -97,12 +129,32 @@ func (m Mem) Move(from, to string) error {
 	return nil
 }
 
+func (m Mem) Remove(path string) error {
+	if _, ok := m.bufs[path]; !ok {
+		return os.ErrNotExist
+	}
+	delete(m.bufs, path)
+	return nil
+}
+
 func (s SyncMem) Open(which string) (io.ReadCloser, error) {
 	s.RLock()
 	defer s.RUnlock()
 	return s.Mem.Open(which)
 }
 
+func (s SyncMem) ReadDir(which string) ([]os.FileInfo, error) {
+	s.RLock()
+	defer s.RUnlock()
+	return s.Mem.ReadDir(which)
+}
+
+func (s SyncMem) Lstat(which string) (os.FileInfo, error) {
+	s.RLock()
+	defer s.RUnlock()
+	return s.Mem.Lstat(which)
+}
+
 func (s SyncMem) Create(which string) (io.WriteCloser, error) {
 	s.Lock()
 	defer s.Unlock()
@@ -114,3 +166,9 @@ func (s SyncMem) Move(from, to string) error {
 	defer s.Unlock()
 	return s.Mem.Move(from, to)
 }
+
+func (s SyncMem) Remove(which string) error {
+	s.Lock()
+	defer s.Unlock()
+	return s.Mem.Remove(which)
+}
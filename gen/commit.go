@@ -0,0 +1,311 @@
+package gen
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/phoenix-engine/phx/fs"
+
+	"github.com/pkg/errors"
+)
+
+// lock takes an exclusive lock on g.To, if it is an fs.Real, using a
+// lock file next to it.  The returned func releases the lock.
+func (g Gen) lock() (func() error, error) {
+	to, ok := g.To.(fs.Real)
+	if !ok {
+		return func() error { return nil }, nil
+	}
+
+	dir := filepath.Clean(to.Where)
+	parent, base := filepath.Split(dir)
+	if parent == "" {
+		parent = "."
+	}
+	if err := os.MkdirAll(parent, 0755); err != nil {
+		return nil, errors.Wrapf(err, "creating %s", parent)
+	}
+
+	return fs.Lock(filepath.Join(parent, "."+base+".lock"))
+}
+
+// commit moves the staged files into g.To.  Staged files which are not
+// in encoded, and which are already present in g.To with the same
+// contents, are left alone so their modification times don't trigger
+// needless rebuilds.
+//
+// If g.To is an fs.Real, the commit either completes or is rolled back:
+// the files to be placed are first moved into a commit directory next
+// to g.To.  Then each file which is replaced or removed is moved aside
+// into the commit directory, and each new file is renamed into its
+// place.  If that fails, the commit is rolled back, and if it is
+// interrupted, the next Gen to lock g.To rolls it back.  Files which
+// are neither placed nor removed, such as a checkout of a dependency,
+// are never touched.  Otherwise, the files are moved one by one.
+//
+// Only each rename is atomic, not the commit as a whole, so anything
+// reading g.To while it is committed, such as a build, may see some new
+// files beside old ones, or miss a file which is about to be replaced.
+//
+// The stale files are removed from g.To, along with any directories
+// left empty by their removal.
+func (g Gen) commit(
+	stage fs.FS,
+	staged []string,
+	encoded map[string]bool,
+	stale []string,
+) error {
+	var place []string
+	for _, name := range staged {
+		if !encoded[name] {
+			same, err := fs.Same(stage, g.To, name, name)
+			if err != nil {
+				return errors.Wrapf(err, "comparing %s", name)
+			} else if same {
+				continue
+			}
+		}
+		place = append(place, name)
+	}
+
+	to, ok := g.To.(fs.Real)
+	if !ok {
+		for _, name := range place {
+			// Replace any previous version of the file.
+			err := g.To.Remove(name)
+			if err != nil && !os.IsNotExist(errors.Cause(err)) {
+				return errors.Wrapf(err, "replacing %s", name)
+			}
+			if err := fs.Move(stage, g.To, name, name); err != nil {
+				return errors.Wrapf(err, "finalizing %s", name)
+			}
+		}
+		for _, name := range stale {
+			err := g.To.Remove(name)
+			if err != nil && !os.IsNotExist(errors.Cause(err)) {
+				return errors.Wrapf(err, "removing %s", name)
+			}
+		}
+		return nil
+	}
+
+	dir := filepath.Clean(to.Where)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return errors.Wrapf(err, "creating %s", dir)
+	}
+	c, err := ioutil.TempDir(filepath.Dir(dir), commitPrefix(dir))
+	if err != nil {
+		return errors.Wrap(err, "creating temporary directory")
+	}
+
+	// Until the journal is written, nothing in dir has changed.
+	err = moveAll(stage, fs.Real{Where: filepath.Join(c, "next")}, place)
+	if err == nil {
+		err = writeJournal(c, place)
+	}
+	if err != nil {
+		os.RemoveAll(c)
+		return err
+	}
+
+	if err := apply(c, dir, place, stale); err != nil {
+		if rerr := rollback(c, dir); rerr != nil {
+			return errors.Wrapf(err,
+				"committing %s (and rolling back from %s: %s)",
+				dir, c, rerr)
+		}
+		os.RemoveAll(c)
+		return errors.Wrapf(err, "committing %s", dir)
+	}
+
+	if err := os.RemoveAll(c); err != nil {
+		return errors.Wrapf(err, "removing %s", c)
+	}
+	return pruneDirs(dir, stale)
+}
+
+// A commit directory of a Gen's output holds, in next, the files to be
+// placed into the output, and in prev, the files they replaced and the
+// stale files which were removed.  Its journal lists the files to be
+// placed, once they are all in next.
+const journalName = "placed"
+
+// commitPrefix returns the prefix of the names of the commit
+// directories of dir, which are next to it.
+func commitPrefix(dir string) string {
+	return "." + filepath.Base(dir) + ".commit-"
+}
+
+// writeJournal writes the journal of the commit directory c, listing the
+// files to be placed.  It is renamed into place, so it is complete if it
+// exists.
+func writeJournal(c string, place []string) error {
+	tmp := filepath.Join(c, journalName+".tmp")
+	err := ioutil.WriteFile(tmp, []byte(strings.Join(place, "\n")), 0644)
+	if err != nil {
+		return errors.Wrap(err, "writing commit journal")
+	}
+	return errors.Wrap(os.Rename(tmp, filepath.Join(c, journalName)),
+		"writing commit journal")
+}
+
+// apply moves each of the stale files, and the files the placed ones
+// replace, from dir into prev in the commit directory c, and moves the
+// placed files from next into dir.  The manifest is placed last.
+func apply(c, dir string, place, stale []string) error {
+	aside := func(name string) error {
+		from := filepath.Join(dir, filepath.FromSlash(name))
+		to := filepath.Join(c, "prev", filepath.FromSlash(name))
+		if _, err := os.Lstat(from); os.IsNotExist(err) {
+			return nil
+		}
+		if err := os.MkdirAll(filepath.Dir(to), 0755); err != nil {
+			return err
+		}
+		return errors.Wrapf(os.Rename(from, to), "moving aside %s", name)
+	}
+
+	for _, name := range stale {
+		if err := aside(name); err != nil {
+			return err
+		}
+	}
+
+	for _, name := range place {
+		if err := aside(name); err != nil {
+			return err
+		}
+
+		to := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(to), 0755); err != nil {
+			return err
+		}
+		err := os.Rename(filepath.Join(c, "next", filepath.FromSlash(name)), to)
+		if err != nil {
+			return errors.Wrapf(err, "placing %s", name)
+		}
+	}
+	return nil
+}
+
+// rollback undoes what apply did in dir from the commit directory c.
+// Files which were placed without replacing anything are removed, and
+// the files in prev are moved back.  Without a journal, nothing was
+// applied.
+func rollback(c, dir string) error {
+	bs, err := ioutil.ReadFile(filepath.Join(c, journalName))
+	switch {
+	case os.IsNotExist(err):
+		return nil
+	case err != nil:
+		return errors.Wrap(err, "reading commit journal")
+	}
+
+	exists := func(p string) bool {
+		_, err := os.Lstat(p)
+		return err == nil
+	}
+
+	for _, name := range strings.Split(string(bs), "\n") {
+		if name == "" {
+			continue
+		}
+		rel := filepath.FromSlash(name)
+		if exists(filepath.Join(c, "next", rel)) ||
+			exists(filepath.Join(c, "prev", rel)) {
+			// It wasn't placed yet, or it is restored below.
+			continue
+		}
+		err := os.Remove(filepath.Join(dir, rel))
+		if err != nil && !os.IsNotExist(err) {
+			return errors.Wrapf(err, "removing %s", name)
+		}
+	}
+
+	prev := filepath.Join(c, "prev")
+	if !exists(prev) {
+		return nil
+	}
+	return filepath.Walk(prev, func(p string, fi os.FileInfo, err error) error {
+		if err != nil || fi.IsDir() {
+			return err
+		}
+		rel, err := filepath.Rel(prev, p)
+		if err != nil {
+			return err
+		}
+
+		to := filepath.Join(dir, rel)
+		if err := os.MkdirAll(filepath.Dir(to), 0755); err != nil {
+			return err
+		}
+		return errors.Wrapf(os.Rename(p, to), "restoring %s",
+			filepath.ToSlash(rel))
+	})
+}
+
+// restore rolls back the commits into g.To which were interrupted, such
+// as by a crash, if it is an fs.Real.  It must be called with g.To
+// locked.
+func (g Gen) restore() error {
+	to, ok := g.To.(fs.Real)
+	if !ok {
+		return nil
+	}
+
+	dir := filepath.Clean(to.Where)
+	cs, err := filepath.Glob(filepath.Join(filepath.Dir(dir),
+		commitPrefix(dir)+"*"))
+	if err != nil {
+		return err
+	}
+
+	for _, c := range cs {
+		if err := rollback(c, dir); err != nil {
+			return errors.Wrapf(err, "rolling back %s", c)
+		}
+		if err := os.RemoveAll(c); err != nil {
+			return errors.Wrapf(err, "removing %s", c)
+		}
+		fmt.Printf("rolled back an interrupted commit into %s\n", dir)
+	}
+	return nil
+}
+
+// moveAll moves the named files from one FS to another, one at a time,
+// since fs.Move is not concurrency-safe.
+func moveAll(from, to fs.FS, names []string) error {
+	for _, name := range names {
+		if err := fs.Move(from, to, name, name); err != nil {
+			return errors.Wrapf(err, "finalizing %s", name)
+		}
+	}
+	return nil
+}
+
+// pruneDirs removes the parent directories of the named files under
+// dir, from the deepest up, as long as they are empty.
+func pruneDirs(dir string, names []string) error {
+	for _, name := range names {
+		for p := path.Dir(name); p != "."; p = path.Dir(p) {
+			full := filepath.Join(dir, filepath.FromSlash(p))
+			infos, err := ioutil.ReadDir(full)
+			if os.IsNotExist(err) {
+				continue
+			} else if err != nil {
+				return errors.Wrapf(err, "reading %s", full)
+			} else if len(infos) > 0 {
+				break
+			}
+
+			if err := os.Remove(full); err != nil {
+				return errors.Wrapf(err, "removing %s", full)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,288 @@
+package gen_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/phoenix-engine/phx/fs"
+	"github.com/phoenix-engine/phx/gen"
+)
+
+func TestGenCommit(t *testing.T) {
+	from, rmFrom := makeTree(t, map[string]string{
+		"a.txt": "some text",
+		"b.txt": "more text",
+	})
+	defer rmFrom()
+	root, rmTo := makeTree(t, map[string]string{
+		"gen/lz4/lib/lz4.c": "not generated",
+	})
+	defer rmTo()
+	to := filepath.Join(root, "gen")
+
+	if err := makeGen(from, to).Operate(); err != nil {
+		t.Fatalf("expected nil error, got %#v", err)
+	}
+
+	aPath := filepath.Join(to, "res", "a_txt_real.cxx")
+	bPath := filepath.Join(to, "res", "b_txt_real.cxx")
+	aBefore, err := os.Stat(aPath)
+	if err != nil {
+		t.Fatalf("expected nil error, got %#v", err)
+	}
+	bBefore, err := ioutil.ReadFile(bPath)
+	if err != nil {
+		t.Fatalf("expected nil error, got %#v", err)
+	}
+	lz4Before, err := os.Stat(filepath.Join(to, "lz4"))
+	if err != nil {
+		t.Fatalf("expected nil error, got %#v", err)
+	}
+
+	t.Log("a failed run leaves the output untouched")
+
+	writeFile(t, from, "b.txt", "changed text")
+	failing := makeGen(from, to)
+	failing.Sources[0].Maker = failMaker{}
+	if err := failing.Operate(); err == nil {
+		t.Fatal("expected an error, got nil")
+	}
+
+	if bs, err := ioutil.ReadFile(bPath); err != nil {
+		t.Fatalf("expected nil error, got %#v", err)
+	} else if string(bs) != string(bBefore) {
+		t.Errorf("expected %s to be untouched", bPath)
+	}
+
+	t.Log("a successful run keeps unchanged and foreign files")
+
+	if err := makeGen(from, to).Operate(); err != nil {
+		t.Fatalf("expected nil error, got %#v", err)
+	}
+
+	if aAfter, err := os.Stat(aPath); err != nil {
+		t.Fatalf("expected nil error, got %#v", err)
+	} else if !os.SameFile(aBefore, aAfter) {
+		t.Errorf("expected %s to be kept as it was", aPath)
+	}
+
+	if bs, err := ioutil.ReadFile(bPath); err != nil {
+		t.Fatalf("expected nil error, got %#v", err)
+	} else if string(bs) == string(bBefore) {
+		t.Errorf("expected %s to be replaced", bPath)
+	}
+
+	if _, err := os.Stat(filepath.Join(to, "lz4", "lib", "lz4.c")); err != nil {
+		t.Errorf("expected foreign file to be kept, got %#v", err)
+	}
+	if lz4After, err := os.Stat(filepath.Join(to, "lz4")); err != nil {
+		t.Fatalf("expected nil error, got %#v", err)
+	} else if !os.SameFile(lz4Before, lz4After) {
+		t.Errorf("expected foreign directory to be left alone")
+	}
+
+	fis, err := ioutil.ReadDir(root)
+	if err != nil {
+		t.Fatalf("expected nil error, got %#v", err)
+	}
+	for _, fi := range fis {
+		if n := fi.Name(); n != "gen" && n != ".gen.lock" {
+			t.Errorf("expected temporary directories to be removed, found %s", n)
+		}
+	}
+}
+
+func TestGenRestore(t *testing.T) {
+	from, rmFrom := makeTree(t, map[string]string{
+		"a.txt": "some text",
+		"b.txt": "more text",
+	})
+	defer rmFrom()
+	root, rmTo := makeTree(t, nil)
+	defer rmTo()
+	to := filepath.Join(root, "gen")
+
+	if err := makeGen(from, to).Operate(); err != nil {
+		t.Fatalf("expected nil error, got %#v", err)
+	}
+	bPath := filepath.Join(to, "res", "b_txt_real.cxx")
+	bBefore, err := ioutil.ReadFile(bPath)
+	if err != nil {
+		t.Fatalf("expected nil error, got %#v", err)
+	}
+
+	// A commit was interrupted after it replaced a_txt_real.cxx,
+	// placed the new new.txt, and removed the stale keep.txt, but
+	// before it placed b_txt_real.cxx.
+	c := filepath.Join(root, ".gen.commit-1")
+	for name, content := range map[string]string{
+		"placed":                  "res/a_txt_real.cxx\nnew.txt\nres/b_txt_real.cxx",
+		"prev/res/a_txt_real.cxx": "old a",
+		"prev/keep.txt":           "kept",
+		"next/res/b_txt_real.cxx": "new b",
+	} {
+		writeFile(t, c, name, content)
+	}
+	writeFile(t, to, "new.txt", "new")
+
+	// The commit is rolled back before anything else, even if the
+	// run fails.
+	failing := makeGen(from, to)
+	failing.Sources[0].Maker = failMaker{}
+	failing.Force = true
+	if err := failing.Operate(); err == nil {
+		t.Fatal("expected an error, got nil")
+	}
+
+	for name, expect := range map[string]string{
+		"res/a_txt_real.cxx": "old a",
+		"res/b_txt_real.cxx": string(bBefore),
+		"keep.txt":           "kept",
+	} {
+		bs, err := ioutil.ReadFile(filepath.Join(to, filepath.FromSlash(name)))
+		if err != nil {
+			t.Errorf("expected nil error, got %#v", err)
+		} else if string(bs) != expect {
+			t.Errorf("expected %s to be %q, got %q", name, expect, bs)
+		}
+	}
+	for _, p := range []string{filepath.Join(to, "new.txt"), c} {
+		if _, err := os.Stat(p); !os.IsNotExist(err) {
+			t.Errorf("expected %s to be removed, got %#v", p, err)
+		}
+	}
+}
+
+func TestGenConcurrent(t *testing.T) {
+	from, rmFrom := makeTree(t, map[string]string{
+		"a.txt": "some text",
+		"b.txt": "more text",
+	})
+	defer rmFrom()
+	root, rmTo := makeTree(t, nil)
+	defer rmTo()
+	to := filepath.Join(root, "gen")
+
+	const runs = 4
+	errs := make(chan error)
+	for i := 0; i < runs; i++ {
+		go func() {
+			g := makeGen(from, to)
+			g.Force = true
+			errs <- g.Operate()
+		}()
+	}
+	for i := 0; i < runs; i++ {
+		if err := <-errs; err != nil {
+			t.Errorf("expected nil error, got %#v", err)
+		}
+	}
+
+	m, err := gen.ReadManifest(fs.Real{Where: to})
+	if err != nil {
+		t.Fatalf("expected nil error, got %#v", err)
+	}
+	if len(m.Resources) != 2 {
+		t.Errorf("unexpected manifest %#v", m)
+	}
+}
+
+func TestGenPrune(t *testing.T) {
+	from, rmFrom := makeTree(t, map[string]string{
+		"a.txt":     "some text",
+		"sub/b.txt": "more text",
+	})
+	defer rmFrom()
+	root, rmTo := makeTree(t, map[string]string{
+		"gen/lz4/lib/lz4.c": "not generated",
+	})
+	defer rmTo()
+	to := filepath.Join(root, "gen")
+
+	if err := makeGen(from, to).Operate(); err != nil {
+		t.Fatalf("expected nil error, got %#v", err)
+	}
+
+	bPath := filepath.Join(to, "res", "sub", "sub_b_txt_real.cxx")
+	if _, err := os.Stat(bPath); err != nil {
+		t.Fatalf("expected nil error, got %#v", err)
+	}
+
+	t.Log("with NoPrune, outputs of removed resources are kept")
+
+	if err := os.RemoveAll(filepath.Join(from, "sub")); err != nil {
+		t.Fatalf("expected nil error, got %#v", err)
+	}
+	keep := makeGen(from, to)
+	keep.NoPrune = true
+	if err := keep.Operate(); err != nil {
+		t.Fatalf("expected nil error, got %#v", err)
+	}
+	if _, err := os.Stat(bPath); err != nil {
+		t.Errorf("expected %s to be kept, got %#v", bPath, err)
+	}
+
+	t.Log("otherwise, they are removed along with empty directories")
+
+	if err := makeGen(from, to).Operate(); err != nil {
+		t.Fatalf("expected nil error, got %#v", err)
+	}
+	for _, p := range []string{
+		bPath,
+		filepath.Join(to, "res", "sub", "sub_b_txt_decl.cxx"),
+		filepath.Join(to, "res", "sub"),
+	} {
+		if _, err := os.Stat(p); !os.IsNotExist(err) {
+			t.Errorf("expected %s to be removed, got %#v", p, err)
+		}
+	}
+
+	for _, p := range []string{
+		filepath.Join(to, "res", "a_txt_real.cxx"),
+		filepath.Join(to, "lz4", "lib", "lz4.c"),
+	} {
+		if _, err := os.Stat(p); err != nil {
+			t.Errorf("expected %s to be kept, got %#v", p, err)
+		}
+	}
+
+	m, err := gen.ReadManifest(fs.Real{Where: to})
+	if err != nil {
+		t.Fatalf("expected nil error, got %#v", err)
+	}
+	for _, f := range m.Files {
+		if f == "res/sub/sub_b_txt_real.cxx" {
+			t.Errorf("expected %s not to be owned", f)
+		}
+	}
+}
+
+func TestGenPruneMem(t *testing.T) {
+	from, rmFrom := makeTree(t, map[string]string{
+		"a.txt": "some text",
+		"b.txt": "more text",
+	})
+	defer rmFrom()
+
+	g := makeGen(from, "")
+	g.To = fs.MakeSyncMem()
+
+	if err := g.Operate(); err != nil {
+		t.Fatalf("expected nil error, got %#v", err)
+	}
+	if err := os.Remove(filepath.Join(from, "b.txt")); err != nil {
+		t.Fatalf("expected nil error, got %#v", err)
+	}
+	if err := g.Operate(); err != nil {
+		t.Fatalf("expected nil error, got %#v", err)
+	}
+
+	if _, err := g.To.Lstat("res/b_txt_real.cxx"); !os.IsNotExist(err) {
+		t.Errorf("expected removed resource to be pruned, got %#v", err)
+	}
+	if _, err := g.To.Lstat("res/a_txt_real.cxx"); err != nil {
+		t.Errorf("expected nil error, got %#v", err)
+	}
+}
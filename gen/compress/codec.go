@@ -0,0 +1,99 @@
+package compress
+
+import (
+	"compress/zlib"
+	"io"
+	"io/ioutil"
+	"sort"
+	"sync"
+
+	"github.com/pierrec/lz4"
+	"github.com/pkg/errors"
+)
+
+// DefaultCodec is the name of the Codec used when none is given.
+const DefaultCodec = "lz4"
+
+// Codec is a compression codec which can be selected by name.
+type Codec struct {
+	Name string
+
+	// Maker returns a Maker for Compressors of the Codec at the
+	// given Level.
+	Maker func(Level) Maker
+
+	// Reader returns a ReadCloser which decompresses the output of
+	// the Codec's Compressors read from the given Reader.
+	Reader func(io.Reader) (io.ReadCloser, error)
+}
+
+var codecs = struct {
+	sync.RWMutex
+	byName map[string]Codec
+}{byName: make(map[string]Codec)}
+
+func init() {
+	Register(Codec{
+		Name:  "lz4",
+		Maker: func(l Level) Maker { return LZ4Maker{Level: l} },
+		Reader: func(r io.Reader) (io.ReadCloser, error) {
+			return ioutil.NopCloser(lz4.NewReader(r)), nil
+		},
+	})
+	Register(Codec{
+		Name:   "deflate",
+		Maker:  func(l Level) Maker { return DeflateMaker{Level: l} },
+		Reader: zlib.NewReader,
+	})
+	Register(Codec{
+		Name:  "none",
+		Maker: func(Level) Maker { return NoMaker{} },
+		Reader: func(r io.Reader) (io.ReadCloser, error) {
+			return ioutil.NopCloser(r), nil
+		},
+	})
+}
+
+// Register makes the Codec available by its Name.  It panics if a Codec
+// with the same Name is already registered.  A Codec which the C++
+// output may use must be registered with its runtime by cpp.Register
+// instead.
+func Register(c Codec) {
+	codecs.Lock()
+	defer codecs.Unlock()
+
+	if _, ok := codecs.byName[c.Name]; ok {
+		panic("compress: codec " + c.Name + " registered twice")
+	}
+	codecs.byName[c.Name] = c
+}
+
+// Lookup returns the Codec registered with the given name.  The empty
+// name refers to DefaultCodec.
+func Lookup(name string) (Codec, error) {
+	if name == "" {
+		name = DefaultCodec
+	}
+
+	codecs.RLock()
+	defer codecs.RUnlock()
+
+	c, ok := codecs.byName[name]
+	if !ok {
+		return c, errors.Errorf("unknown codec %q", name)
+	}
+	return c, nil
+}
+
+// Codecs returns the names of the registered Codecs in lexical order.
+func Codecs() []string {
+	codecs.RLock()
+	defer codecs.RUnlock()
+
+	var names []string
+	for name := range codecs.byName {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -2,6 +2,7 @@ package compress_test
 
 import (
 	"compress/gzip"
+	"testing"
 
 	"github.com/phoenix-engine/phx/gen/compress"
 
@@ -16,3 +17,23 @@ var _ compress.Compressor = new(lz4.Writer)
 
 var _ = compress.Maker(compress.NoMaker{})
 var _ = compress.Maker(compress.LZ4Maker{})
+var _ = compress.Maker(compress.DeflateMaker{})
+
+var _ = compress.Leveler(compress.LZ4Maker{})
+var _ = compress.Leveler(compress.DeflateMaker{})
+
+func TestLevelOf(t *testing.T) {
+	for _, test := range []struct {
+		given  compress.Maker
+		expect compress.Level
+	}{
+		{compress.LZ4Maker{Level: compress.LZ4HC}, compress.LZ4HC},
+		{compress.DeflateMaker{Level: compress.High}, compress.High},
+		{compress.NoMaker{}, compress.Fastest},
+	} {
+		if got := compress.LevelOf(test.given); got != test.expect {
+			t.Errorf("%s: expected level %s, got %s",
+				test.given.Name(), test.expect, got)
+		}
+	}
+}
@@ -4,8 +4,11 @@ import (
 	"io"
 )
 
+// Maker makes Compressors of a particular codec.  Name identifies the
+// codec.  Makers are used as map keys, so they must be comparable.
 type Maker interface {
 	Make() Compressor
+	Name() string
 }
 
 type NoMaker struct{}
@@ -14,6 +17,8 @@ func (NoMaker) Make() Compressor {
 	return &NoCompress{nil}
 }
 
+func (NoMaker) Name() string { return "none" }
+
 // Compressor implements a simple common interface across compressors.
 // Note that some compressors require a call to Close to finalize the
 // stream.  They should have a wrapper type implemented in Flush.
@@ -51,6 +56,41 @@ const (
 	LZ4HC
 )
 
+// LevelFromInt maps a numeric compression level, as given on the command
+// line, to a Level.
+func LevelFromInt(n int) Level {
+	switch n {
+	case 0:
+		return Fastest
+	case 1:
+		return Medium
+	case 2, 3:
+		return High
+	case 9:
+		return LZ4HC
+	default:
+		return Medium
+	}
+}
+
+// Leveler is a Maker whose Compressors compress at a Level.  The Makers
+// of this package which have a Level are Levelers.
+type Leveler interface {
+	Maker
+
+	// CompressionLevel returns the Level of the Maker.
+	CompressionLevel() Level
+}
+
+// LevelOf returns the Level of the given Maker, or Fastest if it is not
+// a Leveler.
+func LevelOf(m Maker) Level {
+	if l, ok := m.(Leveler); ok {
+		return l.CompressionLevel()
+	}
+	return Fastest
+}
+
 // Implement fmt.Stringer for fmt-compatible output strings.
 func (l Level) String() string {
 	switch l {
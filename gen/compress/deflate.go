@@ -0,0 +1,51 @@
+package compress
+
+import (
+	"compress/zlib"
+	"io"
+)
+
+// DeflateMaker makes Deflate Compressors.
+type DeflateMaker struct{ Level }
+
+func (d DeflateMaker) Make() Compressor {
+	// The level is always valid, so there is no error.
+	zw, _ := zlib.NewWriterLevel(nil, d.zlibLevel())
+	return &Deflate{zw, new(WCounter)}
+}
+
+func (DeflateMaker) Name() string { return "deflate" }
+
+// CompressionLevel implements Leveler on DeflateMaker.
+func (d DeflateMaker) CompressionLevel() Level { return d.Level }
+
+func (d DeflateMaker) zlibLevel() int {
+	switch d.Level {
+	case Fastest:
+		return zlib.BestSpeed
+	case Medium:
+		return zlib.DefaultCompression
+	case High, LZ4HC:
+		return zlib.BestCompression
+	default:
+		return zlib.DefaultCompression
+	}
+}
+
+// Deflate is a wrapper for zlib.Writer which counts its output.  It
+// writes a zlib stream (RFC 1950), as read by zlib's inflate.
+type Deflate struct {
+	*zlib.Writer
+	ct *WCounter
+}
+
+func (d *Deflate) Count() int64 {
+	return d.ct.Count()
+}
+
+func (d *Deflate) Reset(w io.Writer) {
+	d.ct.Written = 0
+	d.ct.Writer = w
+
+	d.Writer.Reset(d.ct)
+}
@@ -0,0 +1,117 @@
+package compress_test
+
+import (
+	"bytes"
+	"compress/zlib"
+	"io"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/phoenix-engine/phx/gen/compress"
+)
+
+func TestDeflateMaker(t *testing.T) {
+	input := strings.Repeat("hello this is a rather long test ", 1000)
+
+	for _, level := range []compress.Level{
+		compress.Fastest, compress.Medium, compress.High, compress.LZ4HC,
+	} {
+		comped := new(bytes.Buffer)
+
+		made := compress.DeflateMaker{Level: level}.Make()
+		made.Reset(comped)
+
+		n, err := io.Copy(made, strings.NewReader(input))
+		if err != nil {
+			t.Fatalf("%s: expected nil write error, got %#v", level, err)
+		}
+		if err := made.Close(); err != nil {
+			t.Fatalf("%s: expected nil error on Close, got %#v", level, err)
+		}
+		if exl := int64(len(input)); exl != n {
+			t.Errorf("%s: expected %d bytes copied, got %d", level, exl, n)
+		}
+
+		if ct, ok := made.(compress.Counter); !ok {
+			t.Fatalf("%s: expected Deflate to implement Counter, got %T",
+				level, made)
+		} else if num := ct.Count(); num != int64(comped.Len()) {
+			t.Errorf("%s: expected count %d to equal written %d",
+				level, num, comped.Len())
+		}
+
+		zr, err := zlib.NewReader(comped)
+		if err != nil {
+			t.Fatalf("%s: expected nil error, got %#v", level, err)
+		}
+		out, err := ioutil.ReadAll(zr)
+		if err != nil {
+			t.Fatalf("%s: expected nil read error, got %#v", level, err)
+		}
+		if string(out) != input {
+			t.Errorf("%s: expected output to match input", level)
+		}
+	}
+}
+
+func TestLookup(t *testing.T) {
+	for _, test := range []struct {
+		name, expect string
+		expectErr    string
+	}{
+		{name: "", expect: "lz4"},
+		{name: "lz4", expect: "lz4"},
+		{name: "deflate", expect: "deflate"},
+		{name: "none", expect: "none"},
+		{name: "zstd", expectErr: `unknown codec "zstd"`},
+	} {
+		c, err := compress.Lookup(test.name)
+		if test.expectErr != "" {
+			if err == nil || err.Error() != test.expectErr {
+				t.Errorf("%q: expected error %q, got %v",
+					test.name, test.expectErr, err)
+			}
+			continue
+		} else if err != nil {
+			t.Errorf("%q: expected nil error, got %#v", test.name, err)
+			continue
+		}
+
+		m := c.Maker(compress.High)
+		if m.Name() != test.expect {
+			t.Errorf("%q: expected Maker %s, got %s",
+				test.name, test.expect, m.Name())
+		}
+
+		// The Codec's Reader decompresses its Compressor's output.
+		var (
+			input  = strings.Repeat("some input ", 100)
+			comped = new(bytes.Buffer)
+			comp   = m.Make()
+		)
+		comp.Reset(comped)
+		if _, err := io.WriteString(comp, input); err != nil {
+			t.Fatalf("%q: expected nil error, got %#v", test.name, err)
+		}
+		if err := comp.Close(); err != nil {
+			t.Fatalf("%q: expected nil error, got %#v", test.name, err)
+		}
+
+		rc, err := c.Reader(comped)
+		if err != nil {
+			t.Fatalf("%q: expected nil error, got %#v", test.name, err)
+		}
+		if out, err := ioutil.ReadAll(rc); err != nil {
+			t.Errorf("%q: expected nil error, got %#v", test.name, err)
+		} else if string(out) != input {
+			t.Errorf("%q: expected output to match input", test.name)
+		}
+		rc.Close()
+	}
+
+	names := compress.Codecs()
+	if strings.Join(names, ",") != "deflate,lz4,none" {
+		t.Errorf("unexpected codecs %v", names)
+	}
+}
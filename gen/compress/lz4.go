@@ -12,6 +12,11 @@ func (l LZ4Maker) Make() Compressor {
 	return &LZ4{lz4.NewWriter(nil), new(WCounter), l.Level}
 }
 
+func (LZ4Maker) Name() string { return "lz4" }
+
+// CompressionLevel implements Leveler on LZ4Maker.
+func (l LZ4Maker) CompressionLevel() Level { return l.Level }
+
 // LZ4 is a wrapper for lz4.Writer which knows how to Flush properly.
 type LZ4 struct {
 	*lz4.Writer
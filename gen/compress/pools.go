@@ -0,0 +1,29 @@
+package compress
+
+import "sync"
+
+// Pools holds a Pool of Compressors for each Maker.
+type Pools struct {
+	sync.Mutex
+	byMaker map[Maker]*sync.Pool
+}
+
+// MakePools returns an empty Pools.
+func MakePools() *Pools {
+	return &Pools{byMaker: make(map[Maker]*sync.Pool)}
+}
+
+// For returns the Pool of Compressors made by the given Maker.
+func (p *Pools) For(using Maker) *sync.Pool {
+	p.Lock()
+	defer p.Unlock()
+
+	pool, ok := p.byMaker[using]
+	if !ok {
+		pool = &sync.Pool{
+			New: func() interface{} { return using.Make() },
+		}
+		p.byMaker[using] = pool
+	}
+	return pool
+}
@@ -1,171 +1,301 @@
 package cpp
 
 import (
-	"bytes"
-	"encoding/hex"
 	"io"
 	"strconv"
 	"unicode"
+	"unicode/utf8"
 
 	"github.com/pkg/errors"
 )
 
 // ArrayWriter consumes bytes and formats them as a C++ array literal.
+// Bytes which don't fill a line are kept until more are written, or
+// the ArrayWriter is flushed, so the lines don't depend on how the
+// bytes were split between calls to Write.
 //
-// TODO: Set an unrecoverable error state to indicate that internal
-// state may be unusable.
+// The comment of each line of an EncodingHex array shows its printable
+// ASCII and UTF-8 characters.  A character whose encoding continues into
+// the next line is shown whole on the line where it begins, so the last
+// bytes of a line are only written once the next few are known.
 //
-// TODO: Support chunked write / partial lines from Write, etc. without
-// weird line breaks.
-//
-// TODO: Support Windows-style newline + carriage return?
-//
-// TODO: Optimize for space?  (Base64 / other solutions?)
-//
-// TODO: Add benchmark tests.
+// The output is buffered, and written to Into a page at a time.  Once
+// writing to Into fails, the ArrayWriter keeps returning the error, as
+// its output may be incomplete.
 type ArrayWriter struct {
-	pBuf, outBuf *bytes.Buffer
-
-	lBuf []byte
+	*arrayState
 
 	Into io.WriteCloser
 }
 
+// arrayState is the state shared by copies of an ArrayWriter.
+type arrayState struct {
+	// out is the buffered output.
+	out []byte
+
+	// in is where ReadFrom reads input pages.
+	in []byte
+
+	// line holds the bytes of an EncodingHex array which have not
+	// been written yet.  It holds less than a line, plus ahead bytes.
+	line []byte
+
+	// ahead is the number of bytes past the end of a line which are
+	// needed to render its comment.
+	ahead int
+
+	// cont is the number of bytes at the start of the next line which
+	// continue a character shown in the comment of the last line.
+	cont int
+
+	// pk encodes the bytes, unless the Encoding is EncodingHex.
+	pk *packer
+
+	f       Format
+	perLine int
+	nl      string
+
+	// err is the first error from writing to Into.
+	err error
+}
+
+// Input is encoded chunkSize bytes at a time.  No Encoding writes more
+// than maxExpansion bytes of output for each byte of input, even with
+// one byte per line and CRLF.
+const (
+	chunkSize    = 256
+	maxExpansion = hexWidth + 1 + commentWidth + 2
+)
+
+// hexDigits and asciiComment are the tables used to encode each byte
+// of an EncodingHex array.
+var (
+	hexDigits    = "0123456789abcdef"
+	asciiComment [256]byte
+)
+
+func init() {
+	for i := range asciiComment {
+		switch r := rune(i); {
+		case !strconv.IsPrint(r), unicode.IsSpace(r):
+			asciiComment[i] = '.'
+		default:
+			asciiComment[i] = byte(i)
+		}
+	}
+}
+
 // NewArrayWriter constructs a new ArrayWriter over the given writer.
 func NewArrayWriter(over io.WriteCloser) ArrayWriter {
-	var (
-		// Page buffer, output buffer
-		pBuf, outBuf = new(bytes.Buffer), new(bytes.Buffer)
+	a, _ := NewEncodedArrayWriter(over, EncodingHex, Format{})
+	return a
+}
+
+// NewEncodedArrayWriter constructs a new ArrayWriter over the given
+// writer, which uses the given Encoding and Format.  NewArrayWriter
+// uses EncodingHex and the default Format.  It returns an error if the
+// Format is not valid.
+func NewEncodedArrayWriter(
+	over io.WriteCloser,
+	enc Encoding,
+	f Format,
+) (ArrayWriter, error) {
+	if err := f.Validate(); err != nil {
+		return ArrayWriter{}, err
+	}
 
-		// Line buffer plus 1 for terminal newline.
-		lbb  [MaxWidth + 1]byte
-		lBuf = lbb[:]
-	)
+	st := &arrayState{
+		f:       f,
+		perLine: f.perLine(),
+		nl:      f.newline(),
+	}
 
-	return ArrayWriter{
-		pBuf:   pBuf,
-		outBuf: outBuf,
-		lBuf:   lBuf,
-		Into:   over,
+	// The output is flushed once it reaches a page, so it never
+	// grows past a page plus the encoding of one chunk.
+	st.out = make([]byte, 0, PageSize+chunkSize*maxExpansion)
+	if enc != EncodingHex {
+		st.pk = &packer{Encoding: enc, Format: f}
 	}
+	if !f.NoComment {
+		st.ahead = utf8.UTFMax - 1
+	}
+	st.line = make([]byte, 0, st.perLine+st.ahead)
+
+	return ArrayWriter{arrayState: st, Into: over}, nil
 }
 
-// Flush flushes any remaining buffered contents to a.Into.
+// Flush writes any partial line, and flushes any remaining buffered
+// contents to a.Into.
 func (a ArrayWriter) Flush() error {
-	defer a.outBuf.Reset()
-	_, err := io.Copy(a.Into, a.outBuf)
-	return errors.Wrap(err, "flushing buffer")
+	if a.err != nil {
+		return a.err
+	}
+	for a.pk == nil && len(a.line) > 0 {
+		n := lesser(a.perLine, len(a.line))
+		a.writeLine(a.line, n)
+		a.line = a.line[:copy(a.line, a.line[n:])]
+	}
+	return a.flush()
+}
+
+// flush writes the buffered output to a.Into.
+func (a ArrayWriter) flush() error {
+	if a.err != nil || len(a.out) == 0 {
+		return a.err
+	}
+
+	_, err := a.Into.Write(a.out)
+	a.out = a.out[:0]
+	if err != nil {
+		a.err = errors.Wrap(err, "flushing buffer")
+	}
+	return a.err
 }
 
-// Close calls Flush and then closes the underlying WriteCloser if
-// successful.  It may not be used after this.
+// Close ends the encoded output, calls Flush and then closes the
+// underlying WriteCloser if successful.  It may not be used after this.
 func (a ArrayWriter) Close() error {
+	if a.pk != nil && a.err == nil {
+		a.out = a.pk.finish(a.out)
+	}
 	if err := a.Flush(); err != nil {
 		return err
 	}
 	return a.Into.Close()
 }
 
-// Write implements io.Writer on ArrayWriter for the purpose of Copy
-// from an io.WriterTo.
-func (a ArrayWriter) Write(some []byte) (int, error) {
-	// TODO: Make this more efficient (don't allocate a buffer.)
-	// TODO: Don't always flush, etc.
-	buf := bytes.NewBuffer(some)
-	n, err := a.ReadFrom(buf)
-	return int(n), err
+// Write implements io.Writer on ArrayWriter, encoding the given bytes
+// without allocating.
+func (a ArrayWriter) Write(some []byte) (n int, err error) {
+	if a.err != nil {
+		return 0, a.err
+	}
+
+	for n < len(some) {
+		end := lesser(len(some), n+chunkSize)
+		a.encode(some[n:end])
+		n = end
+
+		// Flush the output every <page size>.
+		if len(a.out) >= PageSize {
+			if err := a.flush(); err != nil {
+				return n, err
+			}
+		}
+	}
+	return n, nil
 }
 
 // ReadFrom consumes bytes from the given Reader, translating them into
-// hex literals formatted for a C++ byte array literal.
+// literals formatted for a C++ byte array literal.
 //
 // The returned count is the number of bytes consumed from the Reader.
 func (a ArrayWriter) ReadFrom(some io.Reader) (total int64, err error) {
-	var (
-		pb = a.pBuf
-		lb = a.lBuf
-
-		done bool
-	)
-
-	for !done {
-		pb.Reset()
-		n, err := io.CopyN(pb, some, PageSize)
-		total += n
-		switch err {
+	if a.err != nil {
+		return 0, a.err
+	}
+	if a.in == nil {
+		a.in = make([]byte, PageSize)
+	}
+
+	for {
+		n, rerr := io.ReadFull(some, a.in)
+		total += int64(n)
+
+		if _, err := a.Write(a.in[:n]); err != nil {
+			return total, err
+		}
+
+		switch rerr {
 		case nil:
-		case io.EOF:
+		case io.EOF, io.ErrUnexpectedEOF:
 			// Reached end of input.
-			done = true
-
+			return total, nil
 		default:
-			return total, errors.Wrap(err, "buffering")
+			return total, errors.Wrap(rerr, "buffering")
 		}
+	}
+}
 
-		from := pb.Bytes()
-		for iter := 0; iter < len(from); iter += 11 {
-			// Loop over the page, writing out lines of hex.
-			// One line of 72 ASCII characters can represent
-			// up to 11 bytes of the input page.
-			//
-			// This could be made more space-efficient by
-			// encoding as a base64 string and then decoding
-			// in the C++ class, but that seems unnecessary.
-			begin, end := iter, lesser(len(from), iter+11)
-			lb = lb[0 : 6*(end-begin+1)+1]
-
-			var j int
-			for ; j < 11 && iter+j < end; j++ {
-				// Loop over each byte in the line of
-				// output.
-
-				// Each will consume "0xYY,", plus a
-				// comment to represent it in ASCII.
-				cb := j * 5
-
-				lb[cb], lb[cb+1] = '0', 'x'
-
-				// This always copies 2 ASCII symbols.
-				_ = hex.Encode(
-					lb[cb+2:cb+4],
-					from[begin+j:begin+j+1],
-				)
-				lb[cb+4] = ','
-			}
+// encode encodes the bytes into the output buffer.
+func (a ArrayWriter) encode(from []byte) {
+	if a.pk != nil {
+		a.out = a.pk.encode(a.out, from)
+		return
+	}
 
-			// After encoding j bytes, copy out the comment.
-			// j*6+6 = j*5 + len(" // |") + j + len("|\n")
-			renderASCIIComment(lb[j*5:j*6+7], from[begin:end])
+	// Fill out the current partial line first.
+	for full := a.perLine + a.ahead; len(a.line) > 0; {
+		if len(a.line)+len(from) < full {
+			a.line = append(a.line, from...)
+			return
+		}
 
-			// Write to *bytes.Buffer never fails.
-			_, _ = a.outBuf.Write(lb[:j*6+7])
+		kept, need := len(a.line), full-len(a.line)
+		a.line = append(a.line, from[:need]...)
+		a.writeLine(a.line, a.perLine)
 
-			// Flush outBuf every <page size>.
-			if a.outBuf.Len() >= PageSize {
-				if err = a.Flush(); err != nil {
-					return total, err
-				}
-			}
+		if kept <= a.perLine {
+			// The bytes past the line are still in from.
+			a.line, from = a.line[:0], from[a.perLine-kept:]
+		} else {
+			rest := copy(a.line, a.line[a.perLine:])
+			a.line, from = a.line[:rest], from[need:]
 		}
 	}
 
-	return
+	// Then write full lines directly, and keep the rest for the
+	// next call.
+	for ; len(from) >= a.perLine+a.ahead; from = from[a.perLine:] {
+		a.writeLine(from, a.perLine)
+	}
+	a.line = append(a.line, from...)
 }
 
-func renderASCIIComment(into, from []byte) {
-	copy(into, []byte{' ', '/', '/', ' ', '|'})
+// writeLine writes a line of hex literals of the first n bytes of from
+// into the output buffer.  The bytes after them are only used for the
+// comment.
+func (a ArrayWriter) writeLine(from []byte, n int) {
+	out := a.out
+	for _, b := range from[:n] {
+		out = append(out, '0', 'x', hexDigits[b>>4], hexDigits[b&0xf], ',')
+	}
 
-	for i, c := range from {
-		// TODO: Try to parse as runes?  Check for UTF-8?
-		switch {
-		case !strconv.IsPrint(rune(c)), unicode.IsSpace(rune(c)):
-			into[5+i] = '.'
-		default:
-			into[5+i] = c
-		}
+	if !a.f.NoComment {
+		out = append(out, " // |"...)
+		out = a.appendComment(out, from, n)
+		out = append(out, '|')
 	}
 
-	into[len(from)+5], into[len(from)+6] = '|', '\n'
+	a.out = append(out, a.nl...)
+}
+
+// appendComment appends the comment of the first n bytes of from to out.
+// Printable characters are shown as they are, and other bytes as '.'.
+func (a ArrayWriter) appendComment(out, from []byte, n int) []byte {
+	// The character these bytes continue was already shown.
+	i := lesser(a.cont, n)
+	a.cont -= i
+
+	for ; i < n; i++ {
+		if b := from[i]; b < utf8.RuneSelf {
+			out = append(out, asciiComment[b])
+			continue
+		}
+
+		r, size := utf8.DecodeRune(from[i:])
+		if size == 1 || !unicode.IsPrint(r) {
+			out = append(out, '.')
+			continue
+		}
+
+		out = append(out, from[i:i+size]...)
+		if i+size > n {
+			a.cont = i + size - n
+		}
+		i += size - 1
+	}
+	return out
 }
 
 func lesser(a, b int) int {
@@ -2,7 +2,10 @@ package cpp_test
 
 import (
 	"bytes"
+	"fmt"
 	"io"
+	"math/rand"
+	"strings"
 	"testing"
 
 	"github.com/phoenix-engine/phx/gen/cpp"
@@ -56,3 +59,321 @@ func TestArrayWriter(t *testing.T) {
 		}
 	}
 }
+
+func TestArrayWriterEncodings(t *testing.T) {
+	random := make([]byte, 3*cpp.PageSize+17)
+	rand.New(rand.NewSource(1)).Read(random)
+
+	text := []byte(strings.Repeat("Some \"text\" (with) )phx\" "+
+		"trigraphs?? and\ttabs\\\n", 50) + "\x00\r\n\xc3\xa9")
+
+	for _, enc := range []cpp.Encoding{
+		cpp.EncodingHex,
+		cpp.EncodingDenseHex,
+		cpp.EncodingDecimal,
+		cpp.EncodingString,
+		cpp.EncodingRaw,
+	} {
+		for name, given := range map[string][]byte{
+			"empty":  nil,
+			"random": random,
+			"text":   text,
+		} {
+			src, err := encodeAll(enc, cpp.Format{}, given, 0)
+			if err != nil {
+				t.Errorf("%s %s: expected nil error, got %#v",
+					enc, name, err)
+				continue
+			}
+
+			// Writing in small, uneven pieces gives the same
+			// output.
+			chunked, err := encodeAll(enc, cpp.Format{}, given, 7)
+			if err != nil {
+				t.Errorf("%s %s: expected nil error, got %#v",
+					enc, name, err)
+				continue
+			}
+			if chunked != src {
+				t.Errorf("%s %s: expected chunked writes to match:\n%s",
+					enc, name, chunked)
+			}
+
+			got, err := decodeInitializer(src)
+			if err != nil {
+				t.Errorf("%s %s: decoding: %s\n%s", enc, name, err, src)
+				continue
+			}
+			if !bytes.Equal(got, given) {
+				t.Errorf("%s %s: expected round trip, got:\n%s",
+					enc, name, src)
+			}
+
+			if enc == cpp.EncodingHex {
+				continue
+			}
+			for i, line := range strings.Split(src, "\n") {
+				if len(line) > cpp.MaxWidth && enc != cpp.EncodingRaw {
+					t.Errorf("%s %s: line %d is %d wide",
+						enc, name, i, len(line))
+				}
+			}
+			if enc.Literal() && len(given) == 0 && src != "\"\"\n" {
+				t.Errorf("%s: expected empty literal, got %q", enc, src)
+			}
+		}
+	}
+}
+
+func TestArrayWriterFormat(t *testing.T) {
+	for i, test := range []struct {
+		should    string
+		enc       cpp.Encoding
+		format    cpp.Format
+		given     string
+		expect    string
+		expectErr string
+	}{{
+		should: "fit as many bytes with comments as the width allows",
+		format: cpp.Format{Width: 30},
+		given:  "hello",
+		expect: "0x68,0x65,0x6c,0x6c, // |hell|\n0x6f, // |o|\n",
+	}, {
+		should: "leave out comments",
+		format: cpp.Format{PerLine: 2, NoComment: true},
+		given:  "hello",
+		expect: "0x68,0x65,\n0x6c,0x6c,\n0x6f,\n",
+	}, {
+		should: "end lines with CRLF",
+		format: cpp.Format{CRLF: true},
+		given:  "hello",
+		expect: "0x68,0x65,0x6c,0x6c,0x6f, // |hello|\r\n",
+	}, {
+		should: "wrap dense hex at the width",
+		enc:    cpp.EncodingDenseHex,
+		format: cpp.Format{Width: 12, CRLF: true},
+		given:  "\x00\x01\xff",
+		expect: "0x0,0x1,\r\n0xff,\r\n",
+	}, {
+		should: "wrap string literals at the width",
+		enc:    cpp.EncodingString,
+		format: cpp.Format{Width: 12},
+		given:  "abcdefghijkl",
+		expect: "\"abcdefghij\"\n\"kl\"\n",
+	}, {
+		should:    "reject bytes per line which don't fit",
+		format:    cpp.Format{PerLine: 20},
+		expectErr: "20 bytes per line don't fit in width 72",
+	}, {
+		should:    "reject a tiny width",
+		format:    cpp.Format{Width: 4},
+		expectErr: "width 4 is less than 12",
+	}} {
+		t.Logf("test %d: should %s", i, test.should)
+
+		got, err := encodeAll(test.enc, test.format, []byte(test.given), 1)
+		if !pt.CheckErrMatches(t, err, test.expectErr) || err != nil {
+			continue
+		}
+		pt.CheckEq(t, got, test.expect)
+	}
+}
+
+func TestArrayWriterComment(t *testing.T) {
+	for i, test := range []struct {
+		should string
+		format cpp.Format
+		given  string
+		expect string
+	}{{
+		should: "show printable UTF-8",
+		given:  "héllo",
+		expect: "0x68,0xc3,0xa9,0x6c,0x6c,0x6f, // |héllo|\n",
+	}, {
+		should: "show a character on the line where it begins",
+		format: cpp.Format{PerLine: 2},
+		given:  "aéb",
+		expect: "0x61,0xc3, // |aé|\n0xa9,0x62, // |b|\n",
+	}, {
+		should: "show a character which spans several lines",
+		format: cpp.Format{PerLine: 1},
+		given:  "😀.",
+		expect: "0xf0, // |😀|\n0x9f, // ||\n0x98, // ||\n" +
+			"0x80, // ||\n0x2e, // |.|\n",
+	}, {
+		should: "not show invalid or incomplete UTF-8",
+		given:  "\xc3x\xa9\xc3",
+		expect: "0xc3,0x78,0xa9,0xc3, // |.x..|\n",
+	}, {
+		should: "not show unprintable characters",
+		given:  "a\u202eb",
+		expect: "0x61,0xe2,0x80,0xae,0x62, // |a...b|\n",
+	}} {
+		t.Logf("test %d: should %s", i, test.should)
+
+		// The lines don't depend on how the input is written.
+		for _, chunk := range []int{0, 1, 2, 5} {
+			got, err := encodeAll(cpp.EncodingHex, test.format,
+				[]byte(test.given), chunk)
+			if pt.CheckErrMatches(t, err, "") {
+				pt.CheckEq(t, got, test.expect)
+			}
+		}
+	}
+}
+
+func TestFormatOver(t *testing.T) {
+	ff := mockFS{objs: make(map[string]bcl)}
+	for _, f := range []cpp.Format{{}, {CRLF: true}} {
+		w, err := f.Over(ff).Create(fmt.Sprintf("crlf_%t", f.CRLF))
+		if err != nil {
+			t.Fatalf("expected nil error, got %#v", err)
+		}
+		n, err := w.Write([]byte("a\nb\n\nc"))
+		pt.CheckErrMatches(t, err, "")
+		pt.CheckEq(t, n, 6)
+		pt.CheckErrMatches(t, w.Close(), "")
+	}
+
+	pt.CheckEq(t, ff.objs["crlf_false"].String(), "a\nb\n\nc")
+	pt.CheckEq(t, ff.objs["crlf_true"].String(), "a\r\nb\r\n\r\nc")
+}
+
+// encodeAll encodes the given bytes using an ArrayWriter, writing them
+// in chunks of the given size, or all at once if it is zero.
+func encodeAll(
+	enc cpp.Encoding,
+	f cpp.Format,
+	given []byte,
+	chunk int,
+) (string, error) {
+	tmp := bcl{new(bytes.Buffer)}
+	aw, err := cpp.NewEncodedArrayWriter(tmp, enc, f)
+	if err != nil {
+		return "", err
+	}
+
+	if chunk == 0 {
+		_, err = io.Copy(aw, bytes.NewReader(given))
+	}
+	for rest := given; chunk > 0 && len(rest) > 0 && err == nil; {
+		n := lesser(len(rest), chunk)
+		_, err = aw.Write(rest[:n])
+		rest = rest[n:]
+	}
+	if err != nil {
+		return "", err
+	}
+
+	if err := aw.Close(); err != nil {
+		return "", err
+	}
+	return tmp.String(), nil
+}
+
+func TestParseEncoding(t *testing.T) {
+	for _, name := range cpp.Encodings() {
+		enc, err := cpp.ParseEncoding(name)
+		pt.CheckErrMatches(t, err, "")
+		pt.CheckEq(t, enc.String(), name)
+	}
+
+	enc, err := cpp.ParseEncoding("")
+	pt.CheckErrMatches(t, err, "")
+	pt.CheckEq(t, enc, cpp.EncodingHex)
+
+	_, err = cpp.ParseEncoding("base64")
+	pt.CheckErrMatches(t, err, `unknown encoding "base64"`)
+}
+
+// failCloser fails every Write after the first n bytes.
+type failCloser struct{ n int }
+
+func (f *failCloser) Write(some []byte) (int, error) {
+	if len(some) > f.n {
+		return 0, fmt.Errorf("disk full")
+	}
+	f.n -= len(some)
+	return len(some), nil
+}
+
+func (f *failCloser) Close() error { return nil }
+
+func TestArrayWriterStickyError(t *testing.T) {
+	aw := cpp.NewArrayWriter(&failCloser{})
+
+	// Enough to fill a page, so the output is flushed.
+	_, err := aw.Write(make([]byte, cpp.PageSize))
+	pt.CheckErrMatches(t, err, "flushing buffer: disk full")
+
+	n, err := aw.Write([]byte("more"))
+	pt.CheckErrMatches(t, err, "flushing buffer: disk full")
+	pt.CheckEq(t, n, 0)
+
+	_, err = aw.ReadFrom(strings.NewReader("more"))
+	pt.CheckErrMatches(t, err, "flushing buffer: disk full")
+	pt.CheckErrMatches(t, aw.Flush(), "flushing buffer: disk full")
+	pt.CheckErrMatches(t, aw.Close(), "flushing buffer: disk full")
+}
+
+func lesser(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+type discardCloser struct{}
+
+func (discardCloser) Write(some []byte) (int, error) { return len(some), nil }
+func (discardCloser) Close() error                   { return nil }
+
+func BenchmarkArrayWriter(b *testing.B) {
+	given := make([]byte, 1<<20)
+	rand.New(rand.NewSource(1)).Read(given)
+
+	for _, enc := range []cpp.Encoding{
+		cpp.EncodingHex,
+		cpp.EncodingDenseHex,
+		cpp.EncodingDecimal,
+		cpp.EncodingString,
+	} {
+		for _, bench := range []struct {
+			name  string
+			chunk int
+		}{
+			{"ReadFrom", 0},
+			{"Write64K", 64 << 10},
+			{"Write100", 100},
+		} {
+			b.Run(enc.String()+"/"+bench.name, func(b *testing.B) {
+				b.SetBytes(int64(len(given)))
+				b.ReportAllocs()
+
+				for i := 0; i < b.N; i++ {
+					aw, err := cpp.NewEncodedArrayWriter(
+						discardCloser{}, enc, cpp.Format{},
+					)
+					if err != nil {
+						b.Fatal(err)
+					}
+
+					if bench.chunk == 0 {
+						_, err = aw.ReadFrom(bytes.NewReader(given))
+					}
+					for rest := given; bench.chunk > 0 && len(rest) > 0 && err == nil; {
+						n := lesser(len(rest), bench.chunk)
+						_, err = aw.Write(rest[:n])
+						rest = rest[n:]
+					}
+					if err == nil {
+						err = aw.Close()
+					}
+					if err != nil {
+						b.Fatal(err)
+					}
+				}
+			})
+		}
+	}
+}
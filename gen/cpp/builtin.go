@@ -0,0 +1,265 @@
+package cpp
+
+import (
+	"fmt"
+	"io"
+	"path"
+	"strings"
+
+	"github.com/phoenix-engine/phx/fs"
+
+	"github.com/pkg/errors"
+)
+
+// templateOutputs are the paths of the files each template creates,
+// where <name> stands for the Path of a resource.
+var templateOutputs = map[TemplateID]string{
+	TmpDecl:        "res/<name>_decl.cxx",
+	TmpDeclChunked: "res/<name>_decl.cxx",
+	TmpDeclIncbin:  "res/<name>_decl.cxx",
+	TmpIncbin:      "res/<name>_real.S",
+	TmpID:          "id.hpp",
+	TmpMapperHdr:   "mapper.hpp",
+	TmpMappings:    "mappings.cxx",
+
+	TmpCMakeLists:  "CMakeLists.txt",
+	TmpGitignore:   ".gitignore",
+	TmpClangFormat: ".clang-format",
+
+	TmpMapperImpl:   "mapper.cxx",
+	TmpResourceHdr:  "resource.hpp",
+	TmpResourceImpl: "resource.cxx",
+}
+
+// TemplateIDs returns the IDs of all templates, in order.
+func TemplateIDs() []TemplateID {
+	ids := make([]TemplateID, len(templateFiles))
+	for i := range ids {
+		ids[i] = TemplateID(i)
+	}
+	return ids
+}
+
+// Output returns the path of the file the template creates, such as
+// "res/<name>_decl.cxx", where <name> stands for the path of a resource.
+func (id TemplateID) Output() string {
+	return templateOutputs[id]
+}
+
+// Runtime returns true if the template overrides the sources of the
+// Runtime, which are otherwise copied as they are.
+func (id TemplateID) Runtime() bool {
+	switch id {
+	case TmpMapperImpl, TmpResourceHdr, TmpResourceImpl:
+		return true
+	}
+	return false
+}
+
+// Builtin returns the built-in template with the given ID, as it would be
+// written in a template directory.
+//
+// The sources of the runtime are those of the Runtime for the named
+// codec, which are only templates when they are overridden.  They are
+// declared in the root namespace of the Resources they are executed
+// with.
+func Builtin(id TemplateID, codec string) (string, error) {
+	var src string
+	switch {
+	case id.Runtime():
+		rt, err := RuntimeFor(codec)
+		if err != nil {
+			return "", err
+		}
+		if err := rt.check(); err != nil {
+			return "", err
+		}
+		src = map[TemplateID]string{
+			TmpMapperImpl:   rt.MapperImpl,
+			TmpResourceHdr:  rt.ResourceHdr,
+			TmpResourceImpl: rt.ResourceImpl,
+		}[id]
+	case id == TmpGitignore, id == TmpClangFormat:
+		src = templates[id]
+	default:
+		if _, ok := templates[id]; !ok {
+			return "", errors.Errorf("unknown template %d", id)
+		}
+		return templates[id], nil
+	}
+
+	// The files which are copied as they are might contain actions.
+	def := Namespace{DefaultNamespace}
+	return strings.NewReplacer(
+		"{{", `{{"{{"}}`,
+		def.Open(), "{{.Resources.Root.Open}}",
+		def.Close(), "{{.Resources.Root.Close}}",
+	).Replace(src), nil
+}
+
+// Diff writes a unified diff from the built-in template to each template
+// in the root of the given FS which differs from it, and returns their
+// names.  The templates are named as in LoadTemplates, and the sources
+// of the runtime are those of the Runtime for the named codec.
+func Diff(w io.Writer, from fs.FS, codec string) ([]string, error) {
+	names, err := fs.Files(from, "")
+	if err != nil {
+		return nil, errors.Wrap(err, "reading templates")
+	}
+
+	var changed []string
+	for _, name := range names {
+		if path.Ext(name) != TemplateExt {
+			continue
+		}
+
+		id, ok := templateFor(name)
+		if !ok {
+			return nil, errors.Errorf("unknown template %s", name)
+		}
+
+		bs, err := readAll(from, name)
+		if err != nil {
+			return nil, err
+		}
+
+		builtin, err := Builtin(id, codec)
+		if err != nil {
+			return nil, err
+		}
+
+		if string(bs) == builtin {
+			continue
+		}
+		changed = append(changed, name)
+
+		_, err = fmt.Fprintf(w, "--- builtin/%s\n+++ %s\n", name, name)
+		if err != nil {
+			return nil, errors.Wrapf(err, "writing diff of %s", name)
+		}
+		if err := unified(w, lines(builtin), lines(string(bs))); err != nil {
+			return nil, errors.Wrapf(err, "writing diff of %s", name)
+		}
+	}
+
+	return changed, nil
+}
+
+// lines splits s into lines which keep their line endings.
+func lines(s string) []string {
+	ls := strings.SplitAfter(s, "\n")
+	if ls[len(ls)-1] == "" {
+		ls = ls[:len(ls)-1]
+	}
+	return ls
+}
+
+// diffContext is the number of unchanged lines around each change in
+// a unified diff.
+const diffContext = 3
+
+type diffOp struct {
+	kind byte
+	line string
+
+	// a and b are the indices of the line, or of the next line, in
+	// each side of the diff.
+	a, b int
+}
+
+// unified writes the hunks of a unified diff from a to b into w.  It
+// uses a longest common subsequence of the lines, which is quadratic,
+// but templates are small.
+func unified(w io.Writer, a, b []string) error {
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			switch {
+			case a[i] == b[j]:
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			case lcs[i+1][j] >= lcs[i][j+1]:
+				lcs[i][j] = lcs[i+1][j]
+			default:
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	var (
+		ops     []diffOp
+		changes []int
+	)
+	for i, j := 0, 0; i < len(a) || j < len(b); {
+		switch {
+		case i < len(a) && j < len(b) && a[i] == b[j]:
+			ops = append(ops, diffOp{' ', a[i], i, j})
+			i++
+			j++
+		case i < len(a) && (j == len(b) || lcs[i+1][j] >= lcs[i][j+1]):
+			changes = append(changes, len(ops))
+			ops = append(ops, diffOp{'-', a[i], i, j})
+			i++
+		default:
+			changes = append(changes, len(ops))
+			ops = append(ops, diffOp{'+', b[j], i, j})
+			j++
+		}
+	}
+
+	for len(changes) > 0 {
+		// A hunk includes every change within twice the context of
+		// the last.
+		last := 0
+		for last+1 < len(changes) &&
+			changes[last+1]-changes[last] <= 2*diffContext {
+			last++
+		}
+
+		start, end := changes[0]-diffContext, changes[last]+diffContext+1
+		if start < 0 {
+			start = 0
+		}
+		if end > len(ops) {
+			end = len(ops)
+		}
+		changes = changes[last+1:]
+
+		hunk := ops[start:end]
+		aStart, bStart := hunk[0].a, hunk[0].b
+		var aLen, bLen int
+		for _, op := range hunk {
+			if op.kind != '+' {
+				aLen++
+			}
+			if op.kind != '-' {
+				bLen++
+			}
+		}
+		if aLen > 0 {
+			aStart++
+		}
+		if bLen > 0 {
+			bStart++
+		}
+
+		_, err := fmt.Fprintf(w, "@@ -%d,%d +%d,%d @@\n",
+			aStart, aLen, bStart, bLen)
+		if err != nil {
+			return err
+		}
+		for _, op := range hunk {
+			line := string(op.kind) + op.line
+			if !strings.HasSuffix(line, "\n") {
+				line += "\n\\ No newline at end of file\n"
+			}
+			if _, err := io.WriteString(w, line); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,144 @@
+package cpp_test
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/phoenix-engine/phx/gen/cpp"
+	pt "github.com/phoenix-engine/phx/testing"
+)
+
+func TestBuiltin(t *testing.T) {
+	for _, codec := range []string{"lz4", "deflate", "none"} {
+		files := make(map[string]string)
+		for _, id := range cpp.TemplateIDs() {
+			tmp, err := cpp.Builtin(id, codec)
+			if err != nil {
+				t.Fatalf("%s: expected nil error, got %#v", codec, err)
+			}
+			files[id.File()] = tmp
+		}
+
+		tmps, err := cpp.LoadTemplates(makeTemplates(t, files))
+		if err != nil {
+			t.Fatalf("%s: expected nil error, got %#v", codec, err)
+		}
+
+		rt, err := cpp.RuntimeFor(codec)
+		if err != nil {
+			t.Fatalf("%s: expected nil error, got %#v", codec, err)
+		}
+		in, err := rt.In(cpp.Namespace{"game", "res"})
+		if err != nil {
+			t.Fatalf("%s: expected nil error, got %#v", codec, err)
+		}
+
+		// The exported templates create the same files as the
+		// built-in templates, in any namespace.
+		var (
+			naming = cpp.Naming{Namespace: "game::res", Nested: true}
+			res    = cpp.Resources{
+				{Name: "a.txt", Size: 5, Codec: codec, Naming: naming},
+				{Name: "ui/b.png", Size: 6, Codec: codec, Naming: naming},
+			}
+			p = cpp.Project{Resources: res, Runtime: in}
+
+			builtin = cpp.Templates{}
+			got     = mockFS{objs: make(map[string]bcl)}
+			expect  = mockFS{objs: make(map[string]bcl)}
+		)
+		if err := tmps.CreateImplementations(got, p); err != nil {
+			t.Fatalf("%s: expected nil error, got %#v", codec, err)
+		}
+		if err := builtin.CreateImplementations(expect, p); err != nil {
+			t.Fatalf("%s: expected nil error, got %#v", codec, err)
+		}
+		for name, id := range map[string]cpp.TemplateID{
+			"id.hpp":       cpp.TmpID,
+			"mappings.cxx": cpp.TmpMappings,
+			"mapper.hpp":   cpp.TmpMapperHdr,
+		} {
+			if err := tmps.Creator(name, id, res).Create(got); err != nil {
+				t.Fatalf("%s: expected nil error, got %#v", codec, err)
+			}
+			if err := builtin.Creator(name, id, res).Create(expect); err != nil {
+				t.Fatalf("%s: expected nil error, got %#v", codec, err)
+			}
+		}
+
+		pt.CheckEq(t, len(got.objs), len(expect.objs))
+		for name, buf := range expect.objs {
+			if g := got.objs[name].String(); g != buf.String() {
+				t.Errorf("%s: %s differs", codec, name)
+				logDiffStrings(t, g, buf.String())
+			}
+		}
+	}
+}
+
+func TestDiff(t *testing.T) {
+	decl, err := cpp.Builtin(cpp.TmpDecl, "")
+	if err != nil {
+		t.Fatalf("expected nil error, got %#v", err)
+	}
+	id, err := cpp.Builtin(cpp.TmpID, "")
+	if err != nil {
+		t.Fatalf("expected nil error, got %#v", err)
+	}
+	cmake, err := cpp.Builtin(cpp.TmpCMakeLists, "")
+	if err != nil {
+		t.Fatalf("expected nil error, got %#v", err)
+	}
+
+	// Changes far apart are in separate hunks.
+	lines := strings.SplitAfter(cmake, "\n")
+	lines[0] = "# Customized.\n"
+	lines[len(lines)-2] = "# The end.\n"
+
+	buf := new(bytes.Buffer)
+	changed, err := cpp.Diff(buf, makeTemplates(t, map[string]string{
+		"decl.cxx.tmpl": strings.Replace(decl, "{{.Size}};",
+			"{{.Size}}; // {{size .Size}}", 1) + "// x",
+		"id.hpp.tmpl":         id,
+		"CMakeLists.txt.tmpl": strings.Join(lines, ""),
+		"README.md":           "Not a template.",
+	}), "")
+	if err != nil {
+		t.Fatalf("expected nil error, got %#v", err)
+	}
+
+	pt.CheckEq(t, strings.Join(changed, " "), "CMakeLists.txt.tmpl decl.cxx.tmpl")
+
+	got := buf.String()
+	pt.CheckEq(t, strings.Count(got, "\n@@ "), 3)
+	if i := strings.Index(got, "--- builtin/decl.cxx.tmpl"); i < 0 {
+		t.Errorf("expected a diff of decl.cxx.tmpl, got:\n%s", got)
+	} else {
+		// The context of an empty line is a space.
+		expect := `
+--- builtin/decl.cxx.tmpl
++++ decl.cxx.tmpl
+@@ -1,8 +1,9 @@
+ #include "mapper.hpp"
+`[1:] + " \n" + ` {{.Root.Open}}
+-    const size_t        Mapper::{{.VarName}}_len = {{.Size}};
++    const size_t        Mapper::{{.VarName}}_len = {{.Size}}; // {{size .Size}}
+     const unsigned char Mapper::{{.VarName}}[]   = {
+ #include "{{.VarName}}_real.cxx"
+     };
+ {{.Root.Close}}
++// x
+\ No newline at end of file
+`
+		if got[i:] != expect {
+			t.Errorf("\n======== expected:\n%s\n\n"+
+				"======== got:\n%s", expect, got[i:])
+		}
+	}
+
+	_, err = cpp.Diff(buf, makeTemplates(t, map[string]string{
+		"nope.tmpl": "",
+	}), "")
+	pt.CheckErrMatches(t, err, `^unknown template nope\.tmpl$`)
+}
@@ -0,0 +1,86 @@
+package cpp
+
+import (
+	"io"
+
+	"github.com/phoenix-engine/phx/fs"
+
+	"github.com/pkg/errors"
+)
+
+// MinChunkSize is the smallest ChunkSize of a Target.  The header of
+// compressed content must fit in the first chunk.
+const MinChunkSize = PageSize
+
+// chunkWriter writes the content of a chunked Resource as the arrays of
+// its Chunks, creating the asset of each chunk once it is reached.
+type chunkWriter struct {
+	fs.FS
+	res Resource
+	enc Encoding
+	f   Format
+
+	// aw writes the current chunk, which has room for left more
+	// bytes.  next is the index of the next chunk.
+	aw   io.WriteCloser
+	left int64
+	next int
+}
+
+func (c *chunkWriter) Write(some []byte) (n int, err error) {
+	for len(some) > 0 {
+		if c.aw == nil || c.left == 0 {
+			if err := c.nextChunk(); err != nil {
+				return n, err
+			}
+		}
+
+		m := len(some)
+		if int64(m) > c.left {
+			m = int(c.left)
+		}
+
+		written, err := c.aw.Write(some[:m])
+		n, c.left, some = n+written, c.left-int64(written), some[m:]
+		if err != nil {
+			return n, err
+		}
+	}
+	return n, nil
+}
+
+// nextChunk closes the current chunk, if any, and creates the next.
+func (c *chunkWriter) nextChunk() error {
+	if c.aw != nil {
+		if err := c.aw.Close(); err != nil {
+			return err
+		}
+	}
+
+	name := c.res.chunkAsset(c.res.chunkVarName(c.next))
+	f, err := c.Create(name)
+	if err != nil {
+		return errors.Wrapf(err, "creating chunk %s", name)
+	}
+
+	aw, err := NewEncodedArrayWriter(f, c.enc, c.f)
+	if err != nil {
+		f.Close()
+		return err
+	}
+
+	c.aw, c.left = aw, c.res.ChunkSize
+	c.next++
+	return nil
+}
+
+// Close closes the last chunk.  If nothing was written, it creates an
+// empty first chunk.
+func (c *chunkWriter) Close() error {
+	if c.aw == nil {
+		if err := c.nextChunk(); err != nil {
+			return err
+		}
+	}
+	return c.aw.Close()
+}
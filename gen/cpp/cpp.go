@@ -1,6 +1,7 @@
 package cpp
 
 import (
+	"debug/elf"
 	"fmt"
 	"io"
 	"sort"
@@ -30,81 +31,198 @@ func (c CloserCloser) Close() error {
 	return c.second.Close()
 }
 
-func PrepareTarget(over fs.FS, using compress.Maker) Target {
+func PrepareTarget(over fs.FS) Target {
 	return Target{
 		FS:        over,
 		WaitGroup: new(sync.WaitGroup),
-		// The Target has a Pool of compressors, which will be
-		// created and returned as needed.
-		Pool: &sync.Pool{
-			New: func() interface{} { return using.Make() },
-		},
+		// The Target has a Pool of compressors for each Maker,
+		// which will be created and returned as needed.
+		Pools: compress.MakePools(),
 
-		done: make(chan Resource),
+		created: &created{latest: make(map[string]*Resource)},
+		done:    make(chan Resource),
 	}
 }
 
+// Embed selects how a Target embeds the content of its resources.
+type Embed int
+
+// Embed constants.
+const (
+	// EmbedArray writes the content of each resource as a C++ array
+	// literal.
+	EmbedArray Embed = iota
+
+	// EmbedIncbin writes the content of each resource as a raw
+	// binary file, which is included by a small assembly file using
+	// the GNU assembler's .incbin directive.  This skips compiling
+	// large array literals, but requires a GNU-compatible toolchain.
+	EmbedIncbin
+
+	// EmbedELF writes the content of each resource directly into a
+	// relocatable ELF object file, which is linked into the library
+	// without compiling anything for it.
+	EmbedELF
+)
+
 // Target is a complete C++ static asset class.
 //
 // TODO: cpp.Target is just a wrapper for a handful of C helpers.
 type Target struct {
 	fs.FS
 	*sync.WaitGroup
-	*sync.Pool
+	*compress.Pools
+
+	// Embed selects how the content of each resource is embedded.
+	// It does not change the C++ API of the Mapper.
+	Embed Embed
+
+	// Machine is the architecture of the object files created for
+	// EmbedELF.
+	Machine elf.Machine
+
+	// Encoding is the Encoding of the arrays of EmbedArray.  With
+	// EncodingRaw, resources which are compressed use EncodingString
+	// instead.
+	Encoding Encoding
 
-	done chan Resource
+	// Format is the formatting profile of the generated source.
+	Format Format
+
+	// Naming selects the identifiers and namespaces of the resources
+	// in the C++ API.
+	Naming Naming
+
+	// Templates are the templates the source is created from.  The
+	// zero Templates are the built-in templates.
+	Templates Templates
+
+	// IDs are the IDs of the named resources which disambiguate
+	// their VarNames, as returned by Names.Disambiguate.
+	IDs map[string]int
+
+	// ChunkSize, if positive, splits the content of each resource of
+	// EmbedArray into arrays of ChunkSize bytes, for compilers which
+	// limit the size of an array initializer.  It must be at least
+	// MinChunkSize.
+	ChunkSize int64
+
+	created *created
+	done    chan Resource
 
 	// TODO: Cancel()
 	cancel chan struct{}
 }
 
 // Create creates a Resource which the static asset will be written to,
-// which uses a Compressor from the Target's pool.
-func (t Target) Create(name string) (io.WriteCloser, error) {
+// which uses a Compressor from the Target's pool for the given Maker.
+// If the named resource was created before, and its Resource closed,
+// its files are replaced.
+func (t Target) Create(name string, using compress.Maker) (io.WriteCloser, error) {
 
 	// Create a Resource to manage the creation of the asset and its
 	// variable declaration.  The project layout is created in
 	// Finalize() using the full Resource list.
-	res := &Resource{Name: name}
+	res := &Resource{
+		Name:      name,
+		ID:        t.IDs[name],
+		Codec:     using.Name(),
+		Embed:     t.Embed,
+		ChunkSize: t.chunkSize(),
+		Machine:   t.Machine,
+		Naming:    t.Naming,
+		from:      t.FS,
+		tmps:      t.Templates,
+	}
+	if err := t.created.add(res, t.FS); err != nil {
+		return nil, errors.Wrapf(err, "replacing %s", name)
+	}
 
-	// Create the asset container (e.g. "dat_txt_real.cxx".)
-	assetF, err := t.FS.Create(t.FS.Join("res", res.VarName()+"_real.cxx"))
-	if err != nil {
-		return nil, errors.Wrapf(err, "creating asset %s", name)
+	// Create the asset container (e.g. "dat_txt_real.cxx".)  The
+	// assets of a chunked resource (e.g. "dat_txt_0_real.cxx") are
+	// created as its content is written.
+	var assetF io.WriteCloser
+	if res.ChunkSize > 0 {
+		if err := t.Format.Validate(); err != nil {
+			return nil, err
+		}
+	} else {
+		f, err := t.FS.Create(res.Asset())
+		if err != nil {
+			return nil, errors.Wrapf(err, "creating asset %s", name)
+		}
+		assetF = f
 	}
 
 	// Create the variable declaration file for the resource (e.g.
-	// "dat_txt_decl.cxx".)
-	declF, err := t.FS.Create(t.FS.Join("res", res.VarName()+"_decl.cxx"))
+	// "dat_txt_decl.cxx".)  For EmbedELF, this is the object file
+	// (e.g. "dat_txt_real.o".)
+	declName, declFS := res.Path()+"_decl.cxx", t.Format.Over(t.FS)
+	if t.Embed == EmbedELF {
+		declName, declFS = res.Path()+"_real.o", t.FS
+	}
+	declF, err := declFS.Create(declName)
 	if err != nil {
 		return nil, errors.Wrapf(err, "creating decl %s", name)
 	}
 
-	// Fetch and prepare a new Compressor over an ArrayWriter.
-	comp := t.Get().(compress.Compressor)
-	aw := NewArrayWriter(assetF)
-	comp.Reset(aw)
+	// Fetch and prepare a new Compressor.
+	pool := t.For(using)
+	comp := pool.Get().(compress.Compressor)
 
 	// The raw asset will be copied into "Into", which compresses
-	// and writes the compressed content into the ArrayWriter, which
-	// encodes the compressed bytes as a C++ array literal.
+	// and writes the compressed content into the asset.
 	//
 	// The Compressor may also implement compress.Counter, counting
 	// the compressed bytes.
 	res.Into, res.Decl = comp, declF
 
-	// This takes care of flushing the compressor and array writer
-	// first, and then closing the underlying buffer or file.
-	res.CloserCloser = CloserCloser{
-		// First, close the compressor, then the array writer.
-		first: CloserCloser{
+	switch t.Embed {
+	case EmbedELF:
+		// The compressed bytes are written as they are, and
+		// copied into the object file when the Resource is
+		// closed.
+		comp.Reset(assetF)
+		res.CloserCloser = CloserCloser{first: res.Into, second: assetF}
+
+	case EmbedIncbin:
+		// The compressed bytes are written as they are, and
+		// included by the assembly file (e.g. "dat_txt_real.S".)
+		if err := AssetAsm(*res).Create(t.Format.Over(t.FS)); err != nil {
+			return nil, err
+		}
+		comp.Reset(assetF)
+
+		// Close the compressor, then the asset file.
+		res.CloserCloser = CloserCloser{first: res.Into, second: assetF}
+
+	default:
+		// The ArrayWriter encodes the compressed bytes as a C++
+		// array literal.  A chunked resource has one for each
+		// chunk.
+		enc := t.Encoding
+		if enc == EncodingRaw && using.Name() != (compress.NoMaker{}).Name() {
+			enc = EncodingString
+		}
+		var aw io.WriteCloser
+		if res.ChunkSize > 0 {
+			aw = &chunkWriter{FS: t.FS, res: *res, enc: enc, f: t.Format}
+		} else if aw, err = NewEncodedArrayWriter(assetF, enc, t.Format); err != nil {
+			pool.Put(comp)
+			return nil, err
+		}
+		comp.Reset(aw)
+
+		// This takes care of flushing the compressor and array
+		// writer first, and then closing the underlying buffer
+		// or file.
+		res.CloserCloser = CloserCloser{
 			// First, close the compressor.
 			first: res.Into,
-			// Then, close the arraywriter.
+			// Then, close the arraywriter, which flushes it
+			// and closes the output asset file.
 			second: aw,
-		},
-		// Then, close the output asset file.
-		second: assetF,
+		}
 	}
 
 	done := make(chan struct{})
@@ -120,7 +238,7 @@ func (t Target) Create(name string) (io.WriteCloser, error) {
 
 		// Reset and recycle the Compressor.
 		comp.Reset(nil)
-		t.Put(comp)
+		pool.Put(comp)
 
 		// Get rid of the "Into" handle, since it was pointing
 		// at that recycled resource.
@@ -134,6 +252,52 @@ func (t Target) Create(name string) (io.WriteCloser, error) {
 	return DoneCloser{res, done}, nil
 }
 
+// Outputs implements gen.Reuser on Target.  It returns the files
+// created for the named resource, which was stored with the given codec
+// and sizes.
+func (t Target) Outputs(name, codec string, size, compressedSize int64) []string {
+	return Resource{
+		Name:      name,
+		ID:        t.IDs[name],
+		Codec:     codec,
+		Embed:     t.Embed,
+		ChunkSize: t.chunkSize(),
+		Naming:    t.Naming,
+		Size:      size,
+		CompCount: compressedSize,
+	}.Outputs()
+}
+
+// chunkSize returns the ChunkSize of the Target's resources, which is
+// zero unless they are EmbedArray.
+func (t Target) chunkSize() int64 {
+	if t.Embed != EmbedArray || t.ChunkSize < 0 {
+		return 0
+	}
+	return t.ChunkSize
+}
+
+// Reuse implements gen.Reuser on Target.  The named resource is
+// included in the files created by Finalize, but its asset and
+// declaration files are not created again.
+func (t Target) Reuse(name, codec string, size, compressedSize int64) {
+	t.Add(1)
+
+	go func() {
+		defer t.Done()
+		t.done <- Resource{
+			Name:      name,
+			ID:        t.IDs[name],
+			Codec:     codec,
+			Embed:     t.Embed,
+			ChunkSize: t.chunkSize(),
+			Naming:    t.Naming,
+			Size:      size,
+			CompCount: compressedSize,
+		}
+	}()
+}
+
 type allErrs []error
 
 func (a allErrs) Error() string {
@@ -145,41 +309,58 @@ func (a allErrs) Error() string {
 }
 
 func (t Target) Finalize() error {
-	var res Resources
+	var (
+		res       Resources
+		collected = make(chan struct{})
+	)
 	go func() {
+		defer close(collected)
 		for re := range t.done {
 			// Each one represents two files.
-			res = append(res, re)
+			if !t.created.replaced(re) {
+				res = append(res, re)
+			}
 		}
 	}()
 
-	// Create all the files which don't rely on variable state.
-	// They can be created while the resources are still being
-	// processed, but we'll wait at least until Finalize is called.
-	if err := CreateImplementations(t.FS); err != nil {
-		t.Wait()
-		close(t.done)
-		return errors.Wrap(err, "creating implementation files")
-	}
-
 	// Wait for all Resource names to be processed so we can use
 	// them in the Mapper, etc.
 	t.Wait()
 	close(t.done)
+	<-collected
 
 	sort.Sort(res)
 
-	// TODO: use templates from a subrepo / subfolder.
+	// The Runtime which decodes the resources depends on their
+	// codec.
+	codec, err := res.Codec()
+	if err != nil {
+		return err
+	}
+	rt, err := RuntimeFor(codec)
+	if err != nil {
+		return err
+	}
+
+	// Create all the files which don't rely on variable state.
+	text := t.Format.Over(t.FS)
+	if rt, err = rt.In(res.Root()); err != nil {
+		return err
+	}
+	if err := t.Templates.CreateImplementations(text, Project{res, rt}); err != nil {
+		return errors.Wrap(err, "creating implementation files")
+	}
+
 	ccs := []Creator{
-		ID(res),
-		Mappings(res),
-		MapperHdr(res),
-		CMakeLists(res),
+		t.Templates.Creator("id.hpp", TmpID, res),
+		t.Templates.Creator("mappings.cxx", TmpMappings, res),
+		t.Templates.Creator("mapper.hpp", TmpMapperHdr, res),
+		t.Templates.Creator("CMakeLists.txt", TmpCMakeLists, Project{res, rt}),
 	}
 
 	errs := make(chan error)
 	for _, cc := range ccs {
-		go func(c Creator) { errs <- c.Create(t.FS) }(cc)
+		go func(c Creator) { errs <- c.Create(text) }(cc)
 	}
 
 	var ees allErrs
@@ -1,8 +1,6 @@
 package cpp
 
 import (
-	"bytes"
-	"io"
 	"text/template"
 
 	"github.com/phoenix-engine/phx/fs"
@@ -15,26 +13,32 @@ type TemplateID int
 // Template ID constants.
 const (
 	TmpDecl TemplateID = iota
+	TmpDeclChunked
+	TmpDeclIncbin
+	TmpIncbin
 	TmpID
 	TmpMapperHdr
-	TmpMapperImpl
 	TmpMappings
-	TmpResourceHdr
-	TmpResourceImpl
 
 	TmpCMakeLists
 	TmpGitignore
 	TmpClangFormat
+
+	// The runtime's sources, which are only templates when they are
+	// overridden.  Otherwise, they are copied as they are.
+	TmpMapperImpl
+	TmpResourceHdr
+	TmpResourceImpl
 )
 
 var templates = map[TemplateID]string{
-	TmpDecl:         declTmp,
-	TmpID:           idTmp,
-	TmpMapperHdr:    mapperHdrTmp,
-	TmpMapperImpl:   mapperImplTmp,
-	TmpMappings:     mappingsTmp,
-	TmpResourceHdr:  resourceHdrTmp,
-	TmpResourceImpl: resourceImplTmp,
+	TmpDecl:        declTmp,
+	TmpDeclChunked: declChunkedTmp,
+	TmpDeclIncbin:  declIncbinTmp,
+	TmpIncbin:      incbinTmp,
+	TmpID:          idTmp,
+	TmpMapperHdr:   mapperHdrTmp,
+	TmpMappings:    mappingsTmp,
 
 	TmpCMakeLists:  cmakeTmp,
 	TmpGitignore:   gitignoreTmp,
@@ -78,43 +82,27 @@ func (m MapperHdr) Create(f fs.FS) error {
 
 type CMakeLists Resources
 
+// Create a CMakeLists.txt building the Resources with the Runtime for
+// their codec.
 func (c CMakeLists) Create(f fs.FS) error {
-	return create(f, "CMakeLists.txt", TmpCMakeLists, Resources(c))
-}
-
-func create(f fs.FS, name string, id TemplateID, rs Resources) error {
-	tmp, err := template.New(name).Parse(templates[id])
+	codec, err := Resources(c).Codec()
+	if err != nil {
+		return err
+	}
+	rt, err := RuntimeFor(codec)
 	if err != nil {
-		return errors.Wrapf(err, "parsing %s template", name)
+		return err
 	}
 
-	return Execute(f, tmp, rs)
+	return create(f, "CMakeLists.txt", TmpCMakeLists, Project{Resources(c), rt})
 }
 
-// CreateImplementations creates the files that don't rely on variable
-// state.
-func CreateImplementations(f fs.FS) error {
-	for fname, tmp := range map[string]TemplateID{
-		"mapper.cxx":    TmpMapperImpl,
-		"resource.hpp":  TmpResourceHdr,
-		"resource.cxx":  TmpResourceImpl,
-		".gitignore":    TmpGitignore,
-		".clang-format": TmpClangFormat,
-	} {
-		ff, err := f.Create(fname)
-		if err != nil {
-			return errors.Wrapf(err, "creating %s", fname)
-		}
-
-		_, err = io.Copy(ff, bytes.NewBufferString(templates[tmp]))
-		if err != nil {
-			return errors.Wrapf(err, "writing %s", fname)
-		}
-
-		if err := ff.Close(); err != nil {
-			return errors.Wrapf(err, "closing %s", fname)
-		}
-	}
+func create(f fs.FS, name string, id TemplateID, args interface{}) error {
+	return Templates{}.Creator(name, id, args).Create(f)
+}
 
-	return nil
+// CreateImplementations creates the files that don't rely on variable
+// state, using the given Runtime.
+func CreateImplementations(f fs.FS, rt Runtime) error {
+	return Templates{}.CreateImplementations(f, Project{Runtime: rt})
 }
@@ -3,9 +3,11 @@ package cpp_test
 import (
 	"bytes"
 	"io"
+	"strings"
 	"testing"
 
 	"github.com/phoenix-engine/phx/fs"
+	"github.com/phoenix-engine/phx/gen/compress"
 	"github.com/phoenix-engine/phx/gen/cpp"
 )
 
@@ -57,7 +59,7 @@ namespace res {
 	bob_gif, // bob.gif
 	bob_jpg, // bob.jpg
     };
-};
+}; // namespace res
 
 #endif
 `[1:]
@@ -96,8 +98,17 @@ if(POLICY CMP0076)
   cmake_policy(SET CMP0076 NEW)
 endif() # POLICY CMP0076
 
-# Add LZ4 and LZ4F definitions.
-add_subdirectory(lz4/lib)
+# Build LZ4 and LZ4F from the sources of the LZ4 library in lz4, unless
+# the project defines LZ4F itself.
+if(NOT TARGET LZ4F)
+  add_library(LZ4F STATIC
+    lz4/lib/lz4.c
+    lz4/lib/lz4frame.c
+    lz4/lib/lz4hc.c
+    lz4/lib/xxhash.c
+  )
+  target_include_directories(LZ4F PUBLIC ${CMAKE_CURRENT_LIST_DIR}/lz4/lib)
+endif()
 
 set_source_files_properties(
   res/al_gif_real.cxx
@@ -179,25 +190,25 @@ namespace res {
 	// al.gif
 	{
 		ID::al_gif,
-		{ 100, al_gif_len, al_gif },
+		{ "lz4", 100, al_gif_len, al_gif },
 	},
 
 	// al.jpg
 	{
 		ID::al_jpg,
-		{ 200, al_jpg_len, al_jpg },
+		{ "none", 200, al_jpg_len, al_jpg },
 	},
 
 	// bob.gif
 	{
 		ID::bob_gif,
-		{ 300, bob_gif_len, bob_gif },
+		{ "lz4", 300, bob_gif_len, bob_gif },
 	},
 
 	// bob.jpg
 	{
 		ID::bob_jpg,
-		{ 400, bob_jpg_len, bob_jpg },
+		{ "lz4", 400, bob_jpg_len, bob_jpg },
 	},
     };
 }; // namespace res
@@ -206,8 +217,8 @@ namespace res {
 	ff := mockFS{objs: make(map[string]bcl)}
 	ii := cpp.Mappings{
 		{Name: "al.gif", CompCount: 100},
-		{Name: "al.jpg", CompCount: 200},
-		{Name: "bob.gif", CompCount: 300},
+		{Name: "al.jpg", CompCount: 200, Codec: "none"},
+		{Name: "bob.gif", CompCount: 300, Codec: "lz4"},
 		{Name: "bob.jpg", CompCount: 400},
 	}
 
@@ -257,10 +268,20 @@ namespace res {
 	static std::unique_ptr<Resource> Fetch(ID) noexcept(false);
 
     private:
+	// The codec is the name of the codec the content is stored
+	// with, such as "none" for uncompressed content.
+	//
+	// The content of a chunked resource is split into arrays of
+	// chunk_length bytes, except the last, which are listed in
+	// chunks.  Otherwise, chunks is null.
 	struct resDefn {
+	    const char*          codec;
 	    size_t               compressed_length;
 	    size_t               decompressed_length;
 	    const unsigned char* content;
+
+	    const unsigned char* const* chunks;
+	    size_t                      chunk_length;
 	};
 
 	static std::map<ID, const resDefn> mappings;
@@ -314,3 +335,199 @@ namespace res {
 		t.FailNow()
 	}
 }
+
+func TestCMakeCreatorCodec(t *testing.T) {
+	for i, test := range []struct {
+		given         cpp.CMakeLists
+		expectHas     []string
+		expectHasNot  []string
+		expectErrLike string
+	}{{
+		given: cpp.CMakeLists{
+			{Name: "al.gif", Codec: "deflate"},
+			{Name: "bob.gif", Codec: "deflate"},
+		},
+		expectHas: []string{
+			"find_package(ZLIB REQUIRED)",
+			"target_link_libraries(Resource ZLIB::ZLIB)",
+		},
+		expectHasNot: []string{"lz4"},
+	}, {
+		given: cpp.CMakeLists{
+			{Name: "al.gif", Codec: "none"},
+			{Name: "bob.gif", Codec: "deflate"},
+		},
+		expectHas: []string{"target_link_libraries(Resource ZLIB::ZLIB)"},
+	}, {
+		given:        cpp.CMakeLists{{Name: "al.gif", Codec: "none"}},
+		expectHasNot: []string{"target_link_libraries", "lz4"},
+	}, {
+		given: cpp.CMakeLists{
+			{Name: "al.gif"},
+			{Name: "bob.gif", Codec: "deflate"},
+		},
+		expectErrLike: `bob.gif uses "deflate"`,
+	}, {
+		given: cpp.CMakeLists{
+			{Name: "al.gif", Embed: cpp.EmbedIncbin},
+			{Name: "bob.gif"},
+		},
+		expectHas: []string{
+			"enable_language(ASM)",
+			"  res/al_gif_real.S\n\n  PROPERTIES",
+			"    res/al_gif_decl.cxx\n    res/al_gif_real.S\n",
+			"  res/bob_gif_real.cxx\n\n  PROPERTIES",
+		},
+		expectHasNot: []string{"al_gif_real.cxx", "al_gif_real.bin"},
+	}, {
+		given: cpp.CMakeLists{{Name: "al.gif", Embed: cpp.EmbedELF}},
+		expectHas: []string{
+			"  res/al_gif_real.o\n\n  PROPERTIES\n" +
+				"    GENERATED True\n    EXTERNAL_OBJECT True\n",
+			"  PRIVATE\n    res/al_gif_real.o\n)",
+		},
+		expectHasNot: []string{"_decl.cxx", "HEADER_FILE_ONLY", "ASM"},
+	}, {
+		given:         cpp.CMakeLists{{Name: "al.gif", Codec: "nope"}},
+		expectErrLike: `no C++ runtime for codec "nope"`,
+	}} {
+		ff := mockFS{objs: make(map[string]bcl)}
+		err := test.given.Create(ff)
+		if test.expectErrLike != "" {
+			if err == nil || !strings.Contains(err.Error(), test.expectErrLike) {
+				t.Errorf("%d: expected error like %q, got %v",
+					i, test.expectErrLike, err)
+			}
+			continue
+		} else if err != nil {
+			t.Errorf("%d: expected nil error, got %#v", i, err)
+			continue
+		}
+
+		got := ff.objs["CMakeLists.txt"].String()
+		for _, s := range test.expectHas {
+			if !strings.Contains(got, s) {
+				t.Errorf("%d: expected CMakeLists.txt to contain %q:\n%s",
+					i, s, got)
+			}
+		}
+		for _, s := range test.expectHasNot {
+			if strings.Contains(got, s) {
+				t.Errorf("%d: expected CMakeLists.txt not to contain %q:\n%s",
+					i, s, got)
+			}
+		}
+	}
+}
+
+func TestCreateImplementations(t *testing.T) {
+	for codec, include := range map[string]string{
+		"":        `#include "lz4frame.h"`,
+		"lz4":     `#include "lz4frame.h"`,
+		"deflate": `#include "zlib.h"`,
+		"none":    `#include <cstddef>`,
+	} {
+		rt, err := cpp.RuntimeFor(codec)
+		if err != nil {
+			t.Fatalf("%q: expected nil error, got %#v", codec, err)
+		}
+
+		ff := mockFS{objs: make(map[string]bcl)}
+		if err := cpp.CreateImplementations(ff, rt); err != nil {
+			t.Fatalf("%q: expected nil error, got %#v", codec, err)
+		}
+
+		if len(ff.objs) != 5 {
+			t.Errorf("%q: unexpected objects in FS: %+v", codec, ff.objs)
+		}
+		if got := ff.objs["resource.hpp"].String(); !strings.Contains(got, include) {
+			t.Errorf("%q: expected resource.hpp to contain %q", codec, include)
+		}
+	}
+}
+
+func TestRuntimeIn(t *testing.T) {
+	rt, err := cpp.RuntimeFor("none")
+	if err != nil {
+		t.Fatalf("expected nil error, got %#v", err)
+	}
+
+	in, err := rt.In(cpp.Namespace{"game", "res"})
+	if err != nil {
+		t.Fatalf("expected nil error, got %#v", err)
+	}
+	for _, src := range []string{in.MapperImpl, in.ResourceHdr, in.ResourceImpl} {
+		if !strings.Contains(src, "namespace game { namespace res {") ||
+			!strings.Contains(src, "}; }; // namespace game::res") {
+			t.Errorf("expected the source to be in game::res:\n%s", src)
+		}
+	}
+
+	// A runtime which doesn't declare everything in the default
+	// namespace can't be moved into another.
+	rt.ResourceHdr = strings.Replace(rt.ResourceHdr,
+		"}; // namespace res", "} // namespace res", 1)
+	_, err = rt.In(cpp.Namespace{"game"})
+	expect := `runtime resource.hpp doesn't contain "}; // namespace res"`
+	if err == nil || err.Error() != expect {
+		t.Errorf("expected error %q, got %#v", expect, err)
+	}
+}
+
+func TestRegister(t *testing.T) {
+	rt, err := cpp.RuntimeFor("none")
+	if err != nil {
+		t.Fatalf("expected nil error, got %#v", err)
+	}
+	codec, err := compress.Lookup("none")
+	if err != nil {
+		t.Fatalf("expected nil error, got %#v", err)
+	}
+
+	// The codec and its runtime are registered together.
+	codec.Name = "cpp-test"
+	cpp.Register(codec, rt)
+	if _, err := compress.Lookup("cpp-test"); err != nil {
+		t.Errorf("expected nil error, got %#v", err)
+	}
+	if _, err := cpp.RuntimeFor("cpp-test"); err != nil {
+		t.Errorf("expected nil error, got %#v", err)
+	}
+
+	bad := rt
+	bad.MapperImpl = ""
+	for _, test := range []struct {
+		should string
+		name   string
+		rt     cpp.Runtime
+		expect string
+	}{{
+		should: "reject a codec registered twice",
+		name:   "cpp-test",
+		rt:     rt,
+		expect: "cpp: runtime for codec cpp-test registered twice",
+	}, {
+		should: "reject an invalid runtime",
+		name:   "cpp-test-bad",
+		rt:     bad,
+		expect: `cpp: runtime for codec cpp-test-bad: ` +
+			`runtime mapper.cxx doesn't contain "namespace res {"`,
+	}} {
+		t.Logf("should %s", test.should)
+
+		codec.Name = test.name
+		func() {
+			defer func() {
+				if got := recover(); got != test.expect {
+					t.Errorf("expected panic %q, got %#v", test.expect, got)
+				}
+			}()
+			cpp.Register(codec, test.rt)
+		}()
+	}
+
+	// A codec without a valid runtime isn't registered at all.
+	if _, err := compress.Lookup("cpp-test-bad"); err == nil {
+		t.Errorf("expected codec cpp-test-bad not to be registered")
+	}
+}
@@ -0,0 +1,246 @@
+package cpp
+
+import (
+	"strconv"
+
+	"github.com/pkg/errors"
+)
+
+// Encoding selects how an ArrayWriter encodes bytes as the initializer
+// of a C++ byte array.
+type Encoding int
+
+// Encoding constants.
+const (
+	// EncodingHex encodes each byte as a two-digit hex literal, with
+	// a comment on each line showing its bytes as ASCII.
+	EncodingHex Encoding = iota
+
+	// EncodingDenseHex encodes each byte as a hex literal without
+	// leading zeros, packed into lines without comments.
+	EncodingDenseHex
+
+	// EncodingDecimal is EncodingDenseHex using decimal literals.
+	EncodingDecimal
+
+	// EncodingString encodes the bytes as string literals, using
+	// octal escapes for bytes which are not printable ASCII.
+	EncodingString
+
+	// EncodingRaw encodes the bytes as a raw string literal, only
+	// escaping bytes which should not appear in source.  It is meant
+	// for text resources which are stored uncompressed.
+	EncodingRaw
+)
+
+var encodingNames = []string{
+	EncodingHex:      "hex",
+	EncodingDenseHex: "dense-hex",
+	EncodingDecimal:  "decimal",
+	EncodingString:   "string",
+	EncodingRaw:      "raw",
+}
+
+// String implements fmt.Stringer on Encoding.
+func (e Encoding) String() string {
+	if e < 0 || int(e) >= len(encodingNames) {
+		return "Encoding(" + strconv.Itoa(int(e)) + ")"
+	}
+	return encodingNames[e]
+}
+
+// Literal returns true if the Encoding produces string literals.  The
+// array they initialize has a terminating null byte after the content,
+// so it may be passed to C APIs expecting a string.
+func (e Encoding) Literal() bool {
+	return e == EncodingString || e == EncodingRaw
+}
+
+// ParseEncoding returns the Encoding with the given name.  The empty
+// name is EncodingHex.
+func ParseEncoding(name string) (Encoding, error) {
+	if name == "" {
+		return EncodingHex, nil
+	}
+	for e, n := range encodingNames {
+		if n == name {
+			return Encoding(e), nil
+		}
+	}
+	return EncodingHex, errors.Errorf("unknown encoding %q", name)
+}
+
+// Encodings returns the names of all Encodings.
+func Encodings() []string {
+	return append([]string(nil), encodingNames...)
+}
+
+// rawDelim delimits raw string literals.  A raw literal ends at the
+// first ")phx\"", so a '"' completing it is escaped instead.
+const rawDelim = "phx"
+
+// packer encodes bytes for the Encodings other than EncodingHex, which
+// pack their output into lines as wide as the Format allows.
+type packer struct {
+	Encoding
+	Format
+
+	// col is the column of the output on the current line.
+	col int
+
+	// open is true if a string literal is open, and raw is true if
+	// it is a raw string literal.
+	open, raw bool
+
+	// tail is the length of the end of the open raw literal which
+	// matches the start of its closing delimiter.
+	tail int
+
+	// wrote is true once any output has been written.
+	wrote bool
+}
+
+// encode appends the encoding of some to into.
+func (p *packer) encode(into, some []byte) []byte {
+	for _, b := range some {
+		p.wrote = true
+
+		switch p.Encoding {
+		case EncodingDenseHex:
+			if b < 0x10 {
+				into = p.token(into, 4)
+				into = append(into, '0', 'x', hexDigits[b], ',')
+			} else {
+				into = p.token(into, 5)
+				into = append(into, '0', 'x',
+					hexDigits[b>>4], hexDigits[b&0xf], ',')
+			}
+
+		case EncodingDecimal:
+			switch {
+			case b < 10:
+				into = p.token(into, 2)
+				into = append(into, '0'+b, ',')
+			case b < 100:
+				into = p.token(into, 3)
+				into = append(into, '0'+b/10, '0'+b%10, ',')
+			default:
+				into = p.token(into, 4)
+				into = append(into, '0'+b/100, '0'+b/10%10, '0'+b%10, ',')
+			}
+
+		case EncodingString:
+			if !p.open {
+				into = append(into, '"')
+				p.open, p.col = true, 1
+			}
+			n := escapedLen[b]
+			if p.col+n+1 > p.width() {
+				into = append(into, '"')
+				into = append(into, p.newline()...)
+				into = append(into, '"')
+				p.col = 1
+			}
+			into = escape(into, b)
+			p.col += n
+
+		case EncodingRaw:
+			into = p.encodeRaw(into, b)
+		}
+	}
+	return into
+}
+
+// token starts a new line for a number token of width n, if it doesn't
+// fit on the current one.
+func (p *packer) token(into []byte, n int) []byte {
+	if p.col > 0 && p.col+n > p.width() {
+		into = append(into, p.newline()...)
+		p.col = 0
+	}
+	p.col += n
+	return into
+}
+
+func (p *packer) encodeRaw(into []byte, b byte) []byte {
+	const closing = ")" + rawDelim + "\""
+
+	safe := b == '\n' || b == '\t' || ' ' <= b && b <= '~'
+	if b == '"' && p.tail == len(closing)-1 {
+		safe = false
+	}
+
+	switch {
+	case safe && !p.raw:
+		// Start a raw literal, closing any escaped one first.
+		if p.open {
+			into = append(into, '"', ' ')
+		}
+		into = append(into, "R\""+rawDelim+"("...)
+		p.open, p.raw, p.tail = true, true, 0
+
+	case !safe && p.raw:
+		into = append(into, closing+" \""...)
+		p.raw = false
+
+	case !safe && !p.open:
+		into = append(into, '"')
+		p.open = true
+	}
+
+	if !safe {
+		return escape(into, b)
+	}
+
+	switch {
+	case b == closing[0]:
+		p.tail = 1
+	case p.tail > 0 && b == closing[p.tail]:
+		p.tail++
+	default:
+		p.tail = 0
+	}
+	return append(into, b)
+}
+
+// finish appends the end of the encoded output to into.
+func (p *packer) finish(into []byte) []byte {
+	switch nl := p.newline(); {
+	case p.raw:
+		into = append(into, ")"+rawDelim+"\""+nl...)
+	case p.open:
+		into = append(into, "\""+nl...)
+	case !p.wrote && p.Literal():
+		// An empty literal still initializes the array.
+		into = append(into, "\"\""+nl...)
+	case p.col > 0:
+		into = append(into, nl...)
+	}
+	p.open, p.raw, p.col = false, false, 0
+	return into
+}
+
+// escapedLen is the length of each byte in a string literal, as written
+// by escape.
+var escapedLen [256]int
+
+func init() {
+	var t [4]byte
+	for i := range escapedLen {
+		escapedLen[i] = len(escape(t[:0], byte(i)))
+	}
+}
+
+// escape appends b to t as it appears in a string literal, using an
+// octal escape if it is not printable ASCII.  Octal escapes always
+// have three digits, so a following digit is not taken as part of one.
+func escape(t []byte, b byte) []byte {
+	switch {
+	case b == '"', b == '\\', b == '?':
+		// '?' is escaped so it can't form a trigraph.
+		return append(t, '\\', b)
+	case ' ' <= b && b <= '~':
+		return append(t, b)
+	}
+	return append(t, '\\', '0'+b>>6, '0'+b>>3&7, '0'+b&7)
+}
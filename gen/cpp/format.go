@@ -0,0 +1,139 @@
+package cpp
+
+import (
+	"bytes"
+	"io"
+
+	"github.com/phoenix-engine/phx/fs"
+
+	"github.com/pkg/errors"
+)
+
+// Format is a formatting profile for generated source files.  The zero
+// Format is the default, which is how phx has always formatted them.
+type Format struct {
+	// Width is the maximum width of a line of an array, not counting
+	// the newline.  If it is zero, MaxWidth is used.
+	Width int `yaml:"width" json:"width,omitempty"`
+
+	// PerLine is the number of bytes on each line of an EncodingHex
+	// array.  If it is zero, as many as fit in the Width are used.
+	PerLine int `yaml:"per_line" json:"per_line,omitempty"`
+
+	// NoComment leaves out the comment showing the bytes of each
+	// line of an EncodingHex array as ASCII.
+	NoComment bool `yaml:"no_comment" json:"no_comment,omitempty"`
+
+	// CRLF ends lines of generated source files with "\r\n" instead
+	// of "\n".  Newlines which are part of the content of a raw
+	// string literal are left alone.
+	CRLF bool `yaml:"crlf" json:"crlf,omitempty"`
+}
+
+// Widths of the parts of a line of an EncodingHex array.
+const (
+	hexWidth     = len("0xYY,")
+	commentWidth = len(" // |") + len("|")
+)
+
+// Validate returns an error if the Format can't be used.
+func (f Format) Validate() error {
+	switch w := f.width(); {
+	case w < minWidth:
+		return errors.Errorf("width %d is less than %d", w, minWidth)
+	case f.PerLine < 0:
+		return errors.Errorf("invalid bytes per line %d", f.PerLine)
+	case f.lineWidth(f.perLine()) > w:
+		return errors.Errorf("%d bytes per line don't fit in width %d",
+			f.perLine(), w)
+	}
+	return nil
+}
+
+// minWidth is enough for a line of one byte of any Encoding.
+const minWidth = hexWidth + 1 + commentWidth
+
+func (f Format) width() int {
+	if f.Width == 0 {
+		return MaxWidth
+	}
+	return f.Width
+}
+
+// perLine returns the number of bytes on each line of an EncodingHex
+// array.
+func (f Format) perLine() int {
+	if f.PerLine > 0 {
+		return f.PerLine
+	}
+
+	n := f.width() / hexWidth
+	if !f.NoComment {
+		n = (f.width() - commentWidth) / (hexWidth + 1)
+	}
+	if n < 1 {
+		return 1
+	}
+	return n
+}
+
+// lineWidth returns the width of a line of n bytes of an EncodingHex
+// array.
+func (f Format) lineWidth(n int) int {
+	if f.NoComment {
+		return n * hexWidth
+	}
+	return n*(hexWidth+1) + commentWidth
+}
+
+func (f Format) newline() string {
+	if f.CRLF {
+		return "\r\n"
+	}
+	return "\n"
+}
+
+// Over returns an FS whose created files are written with the Format's
+// newlines, for files which are written with "\n".  If the Format uses
+// "\n", it returns the given FS.
+func (f Format) Over(over fs.FS) fs.FS {
+	if !f.CRLF {
+		return over
+	}
+	return crlfFS{over}
+}
+
+type crlfFS struct{ fs.FS }
+
+func (c crlfFS) Create(name string) (io.WriteCloser, error) {
+	w, err := c.FS.Create(name)
+	if err != nil {
+		return nil, err
+	}
+	return crlfWriter{w}, nil
+}
+
+// crlfWriter replaces each "\n" written to it with "\r\n".
+type crlfWriter struct{ io.WriteCloser }
+
+func (c crlfWriter) Write(some []byte) (int, error) {
+	var n int
+	for len(some) > 0 {
+		i := bytes.IndexByte(some, '\n')
+		if i < 0 {
+			m, err := c.WriteCloser.Write(some)
+			return n + m, err
+		}
+
+		m, err := c.WriteCloser.Write(some[:i])
+		n += m
+		if err != nil {
+			return n, err
+		}
+		if _, err := io.WriteString(c.WriteCloser, "\r\n"); err != nil {
+			return n, err
+		}
+		n, some = n+1, some[i+1:]
+	}
+	return n, nil
+}
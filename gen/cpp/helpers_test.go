@@ -4,6 +4,8 @@ import (
 	"bytes"
 	"fmt"
 	"io"
+	"strconv"
+	"strings"
 	"unicode"
 )
 
@@ -61,3 +63,73 @@ func replaceNonPrint(s []byte) string {
 
 	return string(out)
 }
+
+// decodeInitializer decodes the bytes of a C++ array initializer
+// written by an ArrayWriter.  If it is made of string literals, their
+// terminating null byte is not included.
+func decodeInitializer(src string) ([]byte, error) {
+	var out []byte
+	for len(src) > 0 {
+		switch c := src[0]; {
+		case c == ' ', c == '\n', c == ',':
+			src = src[1:]
+
+		case strings.HasPrefix(src, "//"):
+			end := strings.IndexByte(src, '\n')
+			if end < 0 {
+				end = len(src)
+			}
+			src = src[end:]
+
+		case strings.HasPrefix(src, `R"`):
+			open := strings.IndexByte(src, '(')
+			if open < 0 {
+				return nil, fmt.Errorf("bad raw literal at %q", src)
+			}
+			closing := ")" + src[2:open] + `"`
+			end := strings.Index(src[open:], closing)
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated raw literal")
+			}
+			out = append(out, src[open+1:open+end]...)
+			src = src[open+end+len(closing):]
+
+		case c == '"':
+			src = src[1:]
+			for len(src) > 0 && src[0] != '"' {
+				if src[0] != '\\' {
+					out, src = append(out, src[0]), src[1:]
+					continue
+				}
+				if len(src) > 1 && strings.IndexByte(`"\?`, src[1]) >= 0 {
+					out, src = append(out, src[1]), src[2:]
+					continue
+				}
+				if len(src) < 4 {
+					return nil, fmt.Errorf("bad escape at %q", src)
+				}
+				b, err := strconv.ParseUint(src[1:4], 8, 8)
+				if err != nil {
+					return nil, err
+				}
+				out, src = append(out, byte(b)), src[4:]
+			}
+			if len(src) == 0 {
+				return nil, fmt.Errorf("unterminated literal")
+			}
+			src = src[1:]
+
+		default:
+			end := strings.IndexByte(src, ',')
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated number at %q", src)
+			}
+			b, err := strconv.ParseUint(src[:end], 0, 8)
+			if err != nil {
+				return nil, err
+			}
+			out, src = append(out, byte(b)), src[end:]
+		}
+	}
+	return out, nil
+}
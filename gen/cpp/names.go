@@ -0,0 +1,276 @@
+package cpp
+
+import (
+	"fmt"
+	"hash/fnv"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/pkg/errors"
+	"golang.org/x/text/unicode/norm"
+)
+
+// Names checks the VarNames of a set of resources, and their identifiers
+// in the C++ API, which must be valid C++ identifiers and must not
+// collide with each other.
+type Names struct {
+	// Members is true if each resource declares Mapper members named
+	// after its VarName, as with Target, rather than only an ID.
+	Members bool
+
+	// Chunked is true if the resources are chunked, so they also
+	// declare members for their chunks.
+	Chunked bool
+
+	// Naming is the Naming of the resources, whose identifiers must
+	// also be valid, and not collide in their ID enums.
+	Naming Naming
+}
+
+// Check returns an error reporting every resource, of the given names
+// disambiguated by the given IDs, whose VarName is not a valid
+// identifier, and every identifier which more than one of them uses.
+func (n Names) Check(names []string, ids map[string]int) error {
+	invalid, users := n.idents(names, ids)
+
+	var errs allErrs
+	for _, name := range invalid {
+		errs = append(errs, n.check(n.resource(name, ids)))
+	}
+
+	// The same resources collide on their members too, which is
+	// only reported once.
+	reported := make(map[string]bool)
+	for _, ident := range collisions(users) {
+		key := strings.Join(users[ident], "\x00")
+		if !reported[key] {
+			reported[key] = true
+			errs = append(errs, collision(ident, users[ident]))
+		}
+	}
+
+	switch len(errs) {
+	case 0:
+		return nil
+	case 1:
+		return errs[0]
+	default:
+		return errs
+	}
+}
+
+// Disambiguate returns the IDs which disambiguate the VarNames of the
+// named resources which are invalid, or which collide.  The ID of each
+// only depends on its name, so it is the same on every run.
+func (n Names) Disambiguate(names []string) map[string]int {
+	invalid, users := n.idents(names, nil)
+
+	ids := make(map[string]int)
+	for _, name := range invalid {
+		ids[name] = nameID(name)
+	}
+	for _, ident := range collisions(users) {
+		for _, name := range users[ident] {
+			ids[name] = nameID(name)
+		}
+	}
+	return ids
+}
+
+// idents returns the names of the resources whose VarNames are not
+// valid identifiers, and the names of the resources using each
+// identifier.
+func (n Names) idents(
+	names []string,
+	ids map[string]int,
+) (invalid []string, users map[string][]string) {
+	var (
+		vars = make(map[string][]string)
+		use  = func(ident, name string) {
+			users[ident] = append(users[ident], name)
+		}
+	)
+	users = make(map[string][]string)
+
+	for _, name := range names {
+		r := n.resource(name, ids)
+		if n.check(r) != nil {
+			invalid = append(invalid, name)
+		}
+
+		v := r.VarName()
+		vars[v] = append(vars[v], name)
+		use(v, name)
+		if n.Members {
+			use(v+"_len", name)
+		}
+		if n.Chunked {
+			use(v+"_chunks", name)
+		}
+
+		// The identifiers in the ID enums only differ from the
+		// VarNames with another Naming.
+		if n.Naming != (Naming{}) {
+			use(append(r.Scope(), "ID", r.Ident()).String(), name)
+		}
+	}
+
+	if n.Chunked {
+		// The number of chunks is not known until the resources
+		// are encoded, so a VarName which could name a chunk of
+		// another resource collides with it.
+		for v := range vars {
+			i := strings.LastIndexByte(v, '_')
+			if i < 0 || !isDigits(v[i+1:]) {
+				continue
+			}
+			for _, name := range vars[v[:i]] {
+				use(v, name)
+			}
+		}
+	}
+
+	sort.Strings(invalid)
+	return invalid, users
+}
+
+// collisions returns the identifiers used by more than one resource, in
+// order.
+func collisions(users map[string][]string) []string {
+	var idents []string
+	for ident, names := range users {
+		if len(names) > 1 {
+			sort.Strings(names)
+			idents = append(idents, ident)
+		}
+	}
+	sort.Strings(idents)
+	return idents
+}
+
+func (n Names) resource(name string, ids map[string]int) Resource {
+	return Resource{Name: name, ID: ids[name], Naming: n.Naming}
+}
+
+// check returns an error if the VarName of the resource, or any of its
+// identifiers in the C++ API, is not valid.
+func (n Names) check(r Resource) error {
+	switch v := r.VarName(); {
+	case keywords[v]:
+		return errors.Errorf("resource %s maps to %s, which is a C++ keyword",
+			r.Name, v)
+	case n.Members && mapperMembers[v]:
+		return errors.Errorf("resource %s maps to %s, which is a member of the Mapper",
+			r.Name, v)
+	}
+
+	if ident := r.Ident(); keywords[ident] {
+		return errors.Errorf("resource %s is named %s, which is a C++ keyword",
+			r.Name, ident)
+	}
+	for _, ns := range r.Scope() {
+		switch {
+		case keywords[ns]:
+			return errors.Errorf("resource %s is in namespace %s, which is a C++ keyword",
+				r.Name, ns)
+		case reservedScopes[ns]:
+			return errors.Errorf("resource %s is in namespace %s, which is reserved",
+				r.Name, ns)
+		}
+	}
+	return nil
+}
+
+func collision(ident string, names []string) error {
+	if len(names) == 2 {
+		return errors.Errorf("resources %s and %s both map to %s",
+			names[0], names[1], ident)
+	}
+	return errors.Errorf("resources %s and %s all map to %s",
+		strings.Join(names[:len(names)-1], ", "), names[len(names)-1], ident)
+}
+
+// nameID returns the ID which disambiguates the named resource, which is
+// a hash of the name.
+func nameID(name string) int {
+	h := fnv.New32a()
+	fmt.Fprint(h, name)
+	if id := h.Sum32(); id != 0 {
+		return int(id)
+	}
+	return 1
+}
+
+// transliterate returns the part of a VarName which stands for the given
+// non-ASCII rune.  The compatibility decomposition of the rune, without
+// its marks, is used if it is ASCII, such as "e" for 'é' or "fi" for
+// 'ﬁ'.  Otherwise, its codepoint is escaped.
+func transliterate(r rune) string {
+	if s, ok := latin[r]; ok {
+		return s
+	}
+
+	d := strings.TrimFunc(norm.NFKD.String(string(r)), func(r rune) bool {
+		return unicode.Is(unicode.Mn, r)
+	})
+	if d != "" && strings.IndexFunc(d, func(r rune) bool {
+		return !isIdentASCII(r)
+	}) < 0 {
+		return d
+	}
+	return fmt.Sprintf("u%04x", r)
+}
+
+func isIdentASCII(r rune) bool {
+	return 'A' <= r && r <= 'Z' ||
+		'a' <= r && r <= 'z' ||
+		'0' <= r && r <= '9'
+}
+
+func isDigits(s string) bool {
+	for _, r := range s {
+		if r < '0' || '9' < r {
+			return false
+		}
+	}
+	return s != ""
+}
+
+// mapperMembers are the names of the Mapper's own members.
+var mapperMembers = map[string]bool{
+	"Fetch":    true,
+	"Mapper":   true,
+	"mappings": true,
+	"resDefn":  true,
+}
+
+// latin are the transliterations of Latin letters which don't decompose
+// into ASCII letters.
+var latin = map[rune]string{
+	'Æ': "AE", 'æ': "ae", 'Ð': "D", 'ð': "d", 'Đ': "D", 'đ': "d",
+	'Ħ': "H", 'ħ': "h", 'ı': "i", 'Ł': "L", 'ł': "l", 'Ŋ': "NG",
+	'ŋ': "ng", 'Œ': "OE", 'œ': "oe", 'Ø': "O", 'ø': "o", 'ß': "ss",
+	'Þ': "TH", 'þ': "th", 'Ŧ': "T", 'ŧ': "t",
+}
+
+// keywords are the keywords and alternative tokens of C++.
+var keywords = make(map[string]bool)
+
+func init() {
+	for _, k := range strings.Fields(`
+		alignas alignof and and_eq asm auto bitand bitor bool break
+		case catch char char8_t char16_t char32_t class compl concept
+		const consteval constexpr constinit const_cast continue
+		co_await co_return co_yield decltype default delete do double
+		dynamic_cast else enum explicit export extern false float for
+		friend goto if inline int long mutable namespace new noexcept
+		not not_eq nullptr operator or or_eq private protected public
+		register reinterpret_cast requires return short signed sizeof
+		static static_assert static_cast struct switch template this
+		thread_local throw true try typedef typeid typename union
+		unsigned using virtual void volatile wchar_t while xor xor_eq
+	`) {
+		keywords[k] = true
+	}
+}
@@ -0,0 +1,118 @@
+package cpp_test
+
+import (
+	"testing"
+
+	"github.com/phoenix-engine/phx/gen/cpp"
+	pt "github.com/phoenix-engine/phx/testing"
+)
+
+func TestNamesCheck(t *testing.T) {
+	for i, test := range []struct {
+		should    string
+		names     cpp.Names
+		given     []string
+		expectErr string
+	}{{
+		should: "accept distinct names",
+		names:  cpp.Names{Members: true},
+		given:  []string{"a.png", "b/a.png", "d1.txt"},
+	}, {
+		should:    "reject names mapping to the same identifier",
+		names:     cpp.Names{Members: true},
+		given:     []string{"a-b.png", "a_b.png", "a b.png"},
+		expectErr: `^resources a b\.png, a-b\.png and a_b\.png all map to a_b_png$`,
+	}, {
+		should:    "reject a name mapping to a member of another",
+		names:     cpp.Names{Members: true},
+		given:     []string{"foo", "foo_len"},
+		expectErr: `^resources foo and foo_len both map to foo_len$`,
+	}, {
+		should: "accept a name like a member without members",
+		given:  []string{"foo", "foo_len"},
+	}, {
+		should:    "reject a name which could be a chunk of another",
+		names:     cpp.Names{Members: true, Chunked: true},
+		given:     []string{"foo", "foo_12", "foo_x"},
+		expectErr: `^resources foo and foo_12 both map to foo_12$`,
+	}, {
+		should: "reject keywords and Mapper members",
+		names:  cpp.Names{Members: true},
+		given:  []string{"int", "mappings", "class"},
+		expectErr: `^3 errors: resource class maps to class, which is a C\+\+ keyword; ` +
+			`resource int maps to int, which is a C\+\+ keyword; ` +
+			`resource mappings maps to mappings, which is a member of the Mapper$`,
+	}, {
+		should: "accept a Mapper member without members",
+		given:  []string{"mappings"},
+	}, {
+		should:    "reject names whose identifiers collide",
+		names:     cpp.Names{Naming: cpp.Naming{StripExt: true}},
+		given:     []string{"a.png", "a.jpg", "b.png"},
+		expectErr: `^resources a\.jpg and a\.png both map to ID::a$`,
+	}, {
+		should: "accept identifiers in different namespaces",
+		names:  cpp.Names{Naming: cpp.Naming{StripExt: true, Nested: true}},
+		given:  []string{"a.png", "b/a.png", "b/c/a.png"},
+	}, {
+		should: "reject invalid identifiers and namespaces",
+		names:  cpp.Names{Naming: cpp.Naming{StripExt: true, Nested: true}},
+		given:  []string{"new.png", "Mapper/a.png", "for/a.png"},
+		expectErr: `^3 errors: resource Mapper/a\.png is in namespace Mapper, which is reserved; ` +
+			`resource for/a\.png is in namespace for, which is a C\+\+ keyword; ` +
+			`resource new\.png is named new, which is a C\+\+ keyword$`,
+	}} {
+		t.Logf("test %d: should %s", i, test.should)
+
+		err := test.names.Check(test.given, nil)
+		pt.CheckErrMatches(t, err, test.expectErr)
+	}
+}
+
+func TestNamesDisambiguate(t *testing.T) {
+	var (
+		names = cpp.Names{Members: true}
+		given = []string{"a-b.png", "a_b.png", "c.png", "int", "foo", "foo_len"}
+		ids   = names.Disambiguate(given)
+	)
+
+	pt.CheckErrMatches(t, names.Check(given, ids), "")
+	pt.CheckEq(t, len(ids), 5)
+	pt.CheckEq(t, ids["c.png"], 0)
+
+	// The IDs only depend on the name.
+	again := names.Disambiguate([]string{"a_b.png", "int", "int.png", "c.png"})
+	pt.CheckEq(t, again["int"], ids["int"])
+	pt.CheckEq(t, len(again), 1)
+
+	for name, id := range ids {
+		v := cpp.Resource{Name: name, ID: id}.VarName()
+		base := cpp.Resource{Name: name}.VarName()
+		pt.CheckEq(t, len(v), len(base)+9)
+		pt.CheckEq(t, v[:len(base)+1], base+"_")
+	}
+}
+
+func TestVarName(t *testing.T) {
+	for _, test := range []struct {
+		given, expect string
+	}{
+		{"a-b.png", "a_b_png"},
+		{"1.png", "d_png"},
+		{"a[b]^c`d\\e.txt", "a_b__c_d_e_txt"},
+		{"Zz_09", "Zz_09"},
+		{"café.png", "cafe_png"},
+		{"cafe\u0301.png", "cafe_png"},
+		{"Straße/Æble.ogg", "Strasse_AEble_ogg"},
+		{"ﬁle²", "file2"},
+		{"²", "d"},
+		{"日本.txt", "u65e5u672c_txt"},
+		{"\U0001f600", "u1f600"},
+		{"\xffa", "_a"},
+	} {
+		pt.CheckEq(t, cpp.Resource{Name: test.given}.VarName(), test.expect)
+	}
+
+	pt.CheckEq(t, cpp.Resource{Name: "a.png", ID: 0xbeef}.VarName(),
+		"a_png_0000beef")
+}
@@ -0,0 +1,296 @@
+package cpp
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// DefaultNamespace is the root namespace of the generated C++ API.
+const DefaultNamespace = "res"
+
+// Naming styles of the identifiers of resources.
+const (
+	// StyleSnake uses the VarName, such as title_screen_png.
+	StyleSnake = "snake"
+
+	// StyleCamel capitalizes each word of the VarName, such as
+	// TitleScreenPng.
+	StyleCamel = "camel"
+
+	// StyleConstant is StyleCamel with a leading 'k', such as
+	// kTitleScreenPng.
+	StyleConstant = "constant"
+)
+
+// Styles returns the names of all naming styles.
+func Styles() []string {
+	return []string{StyleSnake, StyleCamel, StyleConstant}
+}
+
+// Naming selects how the identifiers of resources in the ID enums are
+// derived from their names, and the namespaces they are declared in.
+// The zero Naming is the default, which declares every resource in the
+// one ID enum of namespace res, named by its VarName.
+//
+// Only the C++ API changes.  The Mapper's members and the generated
+// files are still named by the VarName of each resource.
+type Naming struct {
+	// Style is the style of the identifiers, such as StyleCamel.  If
+	// it is empty, StyleSnake is used.
+	Style string `yaml:"style" json:"style,omitempty"`
+
+	// StripExt leaves the extension of each file name out of its
+	// identifier, so title_screen.png becomes title_screen.
+	StripExt bool `yaml:"strip_ext" json:"strip_ext,omitempty"`
+
+	// StripPrefix is left out of the identifier of each resource
+	// whose name begins with it, such as "assets/", or otherwise
+	// whose file name begins with it, such as "ui_".
+	StripPrefix string `yaml:"strip_prefix" json:"strip_prefix,omitempty"`
+
+	// Namespace is the root namespace which everything is declared
+	// in, which may be nested, such as "game::res".  If it is empty,
+	// DefaultNamespace is used.
+	Namespace string `yaml:"namespace" json:"namespace,omitempty"`
+
+	// Nested declares the resources of each subdirectory in an ID
+	// enum of their own, in nested namespaces named after it, so
+	// textures/ui/button.png is res::textures::ui::ID::button_png.
+	// Otherwise, the directory is part of each identifier.
+	Nested bool `yaml:"nested" json:"nested,omitempty"`
+}
+
+// Validate returns an error if the Naming can't be used.
+func (n Naming) Validate() error {
+	switch n.Style {
+	case "", StyleSnake, StyleCamel, StyleConstant:
+	default:
+		return errors.Errorf("unknown naming style %q", n.Style)
+	}
+
+	for _, ns := range n.Root() {
+		if !isIdent(ns) || keywords[ns] || reservedScopes[ns] {
+			return errors.Errorf("invalid namespace %q", n.Namespace)
+		}
+	}
+	return nil
+}
+
+// Root returns the root namespace.
+func (n Naming) Root() Namespace {
+	if n.Namespace == "" {
+		return Namespace{DefaultNamespace}
+	}
+	return strings.Split(n.Namespace, "::")
+}
+
+// Namespace is a C++ namespace, as the names of the namespaces it is
+// nested in, outermost first.  C++11 can't declare them all at once.
+type Namespace []string
+
+// String returns the qualified name of the Namespace.
+func (n Namespace) String() string {
+	return strings.Join(n, "::")
+}
+
+// Open returns the declarations opening the Namespace.
+func (n Namespace) Open() string {
+	open := make([]string, len(n))
+	for i, ns := range n {
+		open[i] = "namespace " + ns + " {"
+	}
+	return strings.Join(open, " ")
+}
+
+// Close returns the braces closing the Namespace, as opened by Open.
+func (n Namespace) Close() string {
+	return strings.Repeat("}; ", len(n)-1) + "}; // namespace " + n.String()
+}
+
+// Ident returns the identifier of the resource in its ID enum, which
+// depends on its Naming.  With the default Naming, it is the VarName.
+func (r Resource) Ident() string {
+	name := r.stripped()
+	if r.Naming.Nested {
+		name = path.Base(name)
+	}
+
+	v := Resource{Name: name}.VarName()
+	switch r.Naming.Style {
+	case StyleCamel:
+		v = camel(v)
+	case StyleConstant:
+		v = "k" + camel(v)
+	}
+
+	if r.ID != 0 {
+		v += fmt.Sprintf("_%08x", uint32(r.ID))
+	}
+	return v
+}
+
+// Scope returns the namespace of the resource's ID enum, relative to the
+// root namespace.  It is empty unless the Naming is Nested.
+func (r Resource) Scope() Namespace {
+	if !r.Naming.Nested {
+		return nil
+	}
+
+	dir := path.Dir(r.stripped())
+	if dir == "." {
+		return nil
+	}
+
+	scope := strings.Split(dir, "/")
+	for i, ns := range scope {
+		scope[i] = Resource{Name: ns}.VarName()
+	}
+	return scope
+}
+
+// Root returns the root namespace of the resource.
+func (r Resource) Root() Namespace { return r.Naming.Root() }
+
+// IDRef returns a reference to the resource's ID in the root namespace.
+// The ID of a resource in a nested namespace is converted to the root
+// ID, which the Mapper is keyed by.
+func (r Resource) IDRef() string {
+	if scope := r.Scope(); len(scope) > 0 {
+		return "static_cast<ID>(" + scope.String() + "::ID::" + r.Ident() + ")"
+	}
+	return "ID::" + r.Ident()
+}
+
+// stripped returns the name of the resource without the parts the
+// Naming leaves out of its identifier.
+func (r Resource) stripped() string {
+	name := r.Name
+	if p := r.Naming.StripPrefix; p != "" {
+		dir, file := path.Split(name)
+		switch {
+		case strings.HasPrefix(name, p) && len(name) > len(p):
+			name = name[len(p):]
+		case strings.HasPrefix(file, p) && len(file) > len(p):
+			name = dir + file[len(p):]
+		}
+	}
+
+	if r.Naming.StripExt {
+		if ext := path.Ext(name); len(ext) < len(path.Base(name)) {
+			name = name[:len(name)-len(ext)]
+		}
+	}
+	return name
+}
+
+// camel capitalizes each word of the given VarName, and joins them.
+func camel(v string) string {
+	var b strings.Builder
+	for _, word := range strings.Split(v, "_") {
+		if word == "" {
+			continue
+		}
+		if c := word[0]; 'a' <= c && c <= 'z' {
+			b.WriteByte(c - 'a' + 'A')
+			word = word[1:]
+		}
+		b.WriteString(word)
+	}
+
+	if b.Len() == 0 {
+		return v
+	}
+	return b.String()
+}
+
+// Group is the resources declared in the ID enum of one namespace.
+type Group struct {
+	// Scope is the namespace of the ID enum, relative to the root.
+	Scope Namespace
+
+	Entries []Entry
+}
+
+// Entry is a resource in the ID enum of a Group.
+type Entry struct {
+	Resource
+
+	// Value is the value of the resource's ID, which is its index
+	// in the sorted Resources, if the Naming is Nested.  Otherwise,
+	// it is zero, and the value is implied by its position.
+	Value int
+}
+
+// Root returns the root namespace of the Resources.
+func (r Resources) Root() Namespace {
+	if len(r) == 0 {
+		return Naming{}.Root()
+	}
+	return r[0].Root()
+}
+
+// Groups returns the Resources by the namespace of their ID enums.  The
+// root namespace is always first, even if it is empty, followed by the
+// nested namespaces in order.  The Resources must be sorted.
+func (r Resources) Groups() []Group {
+	var (
+		groups = []Group{{}}
+		byNS   = map[string]int{"": 0}
+		nested = len(r) > 0 && r[0].Naming.Nested
+	)
+	for i, res := range r {
+		scope := res.Scope()
+		g, ok := byNS[scope.String()]
+		if !ok {
+			g = len(groups)
+			byNS[scope.String()] = g
+			groups = append(groups, Group{Scope: scope})
+		}
+
+		e := Entry{Resource: res}
+		if nested {
+			e.Value = i
+		}
+		groups[g].Entries = append(groups[g].Entries, e)
+	}
+
+	rest := groups[1:]
+	sort.Slice(rest, func(i, j int) bool {
+		return rest[i].Scope.String() < rest[j].Scope.String()
+	})
+	return groups
+}
+
+// Nested returns the nested namespaces of the Resources' ID enums.
+func (r Resources) Nested() []Namespace {
+	var nested []Namespace
+	for _, g := range r.Groups()[1:] {
+		nested = append(nested, g.Scope)
+	}
+	return nested
+}
+
+func isIdent(s string) bool {
+	for i, r := range s {
+		if r != '_' && !isIdentASCII(r) || i == 0 && '0' <= r && r <= '9' {
+			return false
+		}
+	}
+	return s != ""
+}
+
+// reservedScopes are the names which a nested namespace can't have,
+// since the generated code uses them inside the root namespace.
+var reservedScopes = map[string]bool{
+	"ID":       true,
+	"Mapper":   true,
+	"Resource": true,
+	"std":      true,
+	"size_t":   true,
+	"uint32_t": true,
+	"uint64_t": true,
+}
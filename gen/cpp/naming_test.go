@@ -0,0 +1,134 @@
+package cpp_test
+
+import (
+	"testing"
+
+	"github.com/phoenix-engine/phx/gen/cpp"
+	pt "github.com/phoenix-engine/phx/testing"
+)
+
+func TestIdent(t *testing.T) {
+	for i, test := range []struct {
+		should      string
+		naming      cpp.Naming
+		given       string
+		expectIdent string
+		expectScope string
+		expectRef   string
+	}{{
+		should:      "use the VarName by default",
+		given:       "textures/ui/button.png",
+		expectIdent: "textures_ui_button_png",
+		expectRef:   "ID::textures_ui_button_png",
+	}, {
+		should:      "capitalize each word",
+		naming:      cpp.Naming{Style: cpp.StyleCamel},
+		given:       "title_screen.png",
+		expectIdent: "TitleScreenPng",
+		expectRef:   "ID::TitleScreenPng",
+	}, {
+		should:      "prefix constants with k",
+		naming:      cpp.Naming{Style: cpp.StyleConstant, StripExt: true},
+		given:       "title_screen.png",
+		expectIdent: "kTitleScreen",
+		expectRef:   "ID::kTitleScreen",
+	}, {
+		should:      "strip a path prefix",
+		naming:      cpp.Naming{StripPrefix: "assets/", StripExt: true},
+		given:       "assets/ui/ok.png",
+		expectIdent: "ui_ok",
+		expectRef:   "ID::ui_ok",
+	}, {
+		should:      "strip a file name prefix",
+		naming:      cpp.Naming{StripPrefix: "spr_"},
+		given:       "ui/spr_ok.png",
+		expectIdent: "ui_ok_png",
+		expectRef:   "ID::ui_ok_png",
+	}, {
+		should:      "keep a name which is only an extension",
+		naming:      cpp.Naming{StripExt: true},
+		given:       ".gitignore",
+		expectIdent: "_gitignore",
+		expectRef:   "ID::_gitignore",
+	}, {
+		should:      "map directories to nested namespaces",
+		naming:      cpp.Naming{Nested: true, StripExt: true},
+		given:       "textures/ui/button.png",
+		expectIdent: "button",
+		expectScope: "textures::ui",
+		expectRef:   "static_cast<ID>(textures::ui::ID::button)",
+	}, {
+		should:      "sanitize nested namespaces",
+		naming:      cpp.Naming{Nested: true, Style: cpp.StyleCamel},
+		given:       "2d/ui-kit/ok.png",
+		expectIdent: "OkPng",
+		expectScope: "dd::ui_kit",
+		expectRef:   "static_cast<ID>(dd::ui_kit::ID::OkPng)",
+	}} {
+		t.Logf("test %d: should %s", i, test.should)
+
+		res := cpp.Resource{Name: test.given, Naming: test.naming}
+		pt.CheckEq(t, res.Ident(), test.expectIdent)
+		pt.CheckEq(t, res.Scope().String(), test.expectScope)
+		pt.CheckEq(t, res.IDRef(), test.expectRef)
+	}
+}
+
+func TestNamingValidate(t *testing.T) {
+	for i, test := range []struct {
+		given     cpp.Naming
+		expectErr string
+	}{
+		{cpp.Naming{}, ""},
+		{cpp.Naming{Style: cpp.StyleConstant, Namespace: "game::res"}, ""},
+		{cpp.Naming{Style: "kebab"}, `^unknown naming style "kebab"$`},
+		{cpp.Naming{Namespace: "game::"}, `^invalid namespace "game::"$`},
+		{cpp.Naming{Namespace: "1res"}, `^invalid namespace "1res"$`},
+		{cpp.Naming{Namespace: "std"}, `^invalid namespace "std"$`},
+	} {
+		t.Logf("test %d: %+v", i, test.given)
+		pt.CheckErrMatches(t, test.given.Validate(), test.expectErr)
+	}
+}
+
+func TestNestedIDCreator(t *testing.T) {
+	expect := `
+#ifndef PHX_RES_ID
+#define PHX_RES_ID
+
+namespace game { namespace res {
+    enum class ID {
+	Title, // title.png
+    };
+
+    namespace ui {
+    enum class ID {
+	Button = 1, // ui/button.png
+	Icon = 2, // ui/icon.png
+    };
+    }; // namespace ui
+}; }; // namespace game::res
+
+#endif
+`[1:]
+
+	naming := cpp.Naming{
+		Style:     cpp.StyleCamel,
+		StripExt:  true,
+		Namespace: "game::res",
+		Nested:    true,
+	}
+	ff := mockFS{objs: make(map[string]bcl)}
+	ii := cpp.ID{
+		{Name: "title.png", Naming: naming},
+		{Name: "ui/button.png", Naming: naming},
+		{Name: "ui/icon.png", Naming: naming},
+	}
+
+	pt.CheckErrMatches(t, ii.Create(ff), "")
+	if fs := ff.objs["id.hpp"].String(); fs != expect {
+		t.Errorf("\n======== expected:\n%s\n\n"+
+			"======== got:\n%s", expect, fs)
+		logDiffStrings(t, fs, expect)
+	}
+}
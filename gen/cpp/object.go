@@ -0,0 +1,225 @@
+package cpp
+
+import (
+	"bytes"
+	"debug/elf"
+	"encoding/binary"
+	"io"
+	"runtime"
+
+	"github.com/pkg/errors"
+)
+
+// MachineFor returns the ELF machine of the named architecture, which
+// may be "x86-64" or "aarch64", or their Go names.  If arch is empty,
+// the architecture phx was built for is used.
+func MachineFor(arch string) (elf.Machine, error) {
+	if arch == "" {
+		arch = runtime.GOARCH
+	}
+
+	switch arch {
+	case "x86-64", "x86_64", "amd64":
+		return elf.EM_X86_64, nil
+	case "aarch64", "arm64":
+		return elf.EM_AARCH64, nil
+	default:
+		return elf.EM_NONE, errors.Errorf("unsupported architecture %q", arch)
+	}
+}
+
+// Section header indices of an object file.
+const (
+	secRodata = iota + 1
+	secSymtab
+	secStrtab
+	secShstrtab
+	secNote
+	numSections
+)
+
+// WriteObject writes a relocatable 64-bit little-endian ELF object for
+// the given machine, which defines the Mapper members of the Resource
+// in its .rodata section.  The content is read from the given Reader,
+// which must have exactly n bytes.  The length member is res.Size.
+func WriteObject(
+	w io.Writer,
+	m elf.Machine,
+	res Resource,
+	content io.Reader, n int64,
+) error {
+	var (
+		ehdrSize = uint64(binary.Size(elf.Header64{}))
+		symSize  = uint64(binary.Size(elf.Sym64{}))
+		shdrSize = uint64(binary.Size(elf.Section64{}))
+
+		// The length follows the content in .rodata, aligned
+		// for a size_t.
+		contentLen = uint64(n)
+		lenOff     = align(contentLen, 8)
+		rodataLen  = lenOff + 8
+	)
+
+	strtab, names := stringTable("", res.Symbol(), res.LenSymbol())
+	shstrtab, shnames := stringTable(
+		"", ".rodata", ".symtab", ".strtab", ".shstrtab",
+		".note.GNU-stack",
+	)
+
+	syms := []elf.Sym64{{}, {
+		Name:  names[1],
+		Info:  elf.ST_INFO(elf.STB_GLOBAL, elf.STT_OBJECT),
+		Shndx: secRodata,
+		Size:  contentLen,
+	}, {
+		Name:  names[2],
+		Info:  elf.ST_INFO(elf.STB_GLOBAL, elf.STT_OBJECT),
+		Shndx: secRodata,
+		Value: lenOff,
+		Size:  8,
+	}}
+
+	var (
+		rodataOff   = align(ehdrSize, 16)
+		symtabOff   = align(rodataOff+rodataLen, 8)
+		strtabOff   = symtabOff + symSize*uint64(len(syms))
+		shstrtabOff = strtabOff + uint64(len(strtab))
+		shdrOff     = align(shstrtabOff+uint64(len(shstrtab)), 8)
+	)
+
+	hdr := elf.Header64{
+		Type:      uint16(elf.ET_REL),
+		Machine:   uint16(m),
+		Version:   uint32(elf.EV_CURRENT),
+		Shoff:     shdrOff,
+		Ehsize:    uint16(ehdrSize),
+		Shentsize: uint16(shdrSize),
+		Shnum:     numSections,
+		Shstrndx:  secShstrtab,
+	}
+	copy(hdr.Ident[:], elf.ELFMAG)
+	hdr.Ident[elf.EI_CLASS] = byte(elf.ELFCLASS64)
+	hdr.Ident[elf.EI_DATA] = byte(elf.ELFDATA2LSB)
+	hdr.Ident[elf.EI_VERSION] = byte(elf.EV_CURRENT)
+	hdr.Ident[elf.EI_OSABI] = byte(elf.ELFOSABI_NONE)
+
+	shdrs := []elf.Section64{{}, {
+		Name:      shnames[1],
+		Type:      uint32(elf.SHT_PROGBITS),
+		Flags:     uint64(elf.SHF_ALLOC),
+		Off:       rodataOff,
+		Size:      rodataLen,
+		Addralign: 16,
+	}, {
+		Name:      shnames[2],
+		Type:      uint32(elf.SHT_SYMTAB),
+		Off:       symtabOff,
+		Size:      symSize * uint64(len(syms)),
+		Link:      secStrtab,
+		Info:      1, // The index of the first global symbol.
+		Addralign: 8,
+		Entsize:   symSize,
+	}, {
+		Name:      shnames[3],
+		Type:      uint32(elf.SHT_STRTAB),
+		Off:       strtabOff,
+		Size:      uint64(len(strtab)),
+		Addralign: 1,
+	}, {
+		Name:      shnames[4],
+		Type:      uint32(elf.SHT_STRTAB),
+		Off:       shstrtabOff,
+		Size:      uint64(len(shstrtab)),
+		Addralign: 1,
+	}, {
+		// This marks the object as not needing an executable
+		// stack.
+		Name:      shnames[5],
+		Type:      uint32(elf.SHT_PROGBITS),
+		Off:       shdrOff,
+		Addralign: 1,
+	}}
+
+	ow := &objectWriter{w: w}
+	ow.write(hdr)
+	ow.pad(rodataOff)
+	ow.copy(content, contentLen)
+	ow.pad(rodataOff + lenOff)
+	ow.write(uint64(res.Size))
+	ow.pad(symtabOff)
+	ow.write(syms)
+	ow.write(strtab)
+	ow.write(shstrtab)
+	ow.pad(shdrOff)
+	ow.write(shdrs)
+
+	return errors.Wrap(ow.err, "writing object")
+}
+
+// stringTable returns an ELF string table of the given strings, which
+// should start with the empty string, and the offset of each.
+func stringTable(strs ...string) ([]byte, []uint32) {
+	var (
+		tab  []byte
+		offs []uint32
+	)
+	for _, s := range strs {
+		if s == "" && len(tab) > 0 {
+			offs = append(offs, 0)
+			continue
+		}
+		offs = append(offs, uint32(len(tab)))
+		tab = append(append(tab, s...), 0)
+	}
+	return tab, offs
+}
+
+func align(n, to uint64) uint64 {
+	return (n + to - 1) / to * to
+}
+
+// objectWriter writes the parts of an object file, keeping track of the
+// offset and the first error.
+type objectWriter struct {
+	w   io.Writer
+	off uint64
+	err error
+}
+
+func (o *objectWriter) write(v interface{}) {
+	if o.err != nil {
+		return
+	}
+
+	var buf bytes.Buffer
+	if err := binary.Write(&buf, binary.LittleEndian, v); err != nil {
+		o.err = err
+		return
+	}
+
+	n, err := o.w.Write(buf.Bytes())
+	o.off += uint64(n)
+	o.err = err
+}
+
+func (o *objectWriter) pad(to uint64) {
+	if o.err == nil && to > o.off {
+		o.write(make([]byte, to-o.off))
+	}
+}
+
+func (o *objectWriter) copy(from io.Reader, n uint64) {
+	if o.err != nil {
+		return
+	}
+
+	copied, err := io.Copy(o.w, from)
+	o.off += uint64(copied)
+	switch {
+	case err != nil:
+		o.err = err
+	case uint64(copied) != n:
+		o.err = errors.Errorf("expected %d bytes of content, got %d",
+			n, copied)
+	}
+}
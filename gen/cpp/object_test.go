@@ -0,0 +1,97 @@
+package cpp_test
+
+import (
+	"bytes"
+	"debug/elf"
+	"encoding/binary"
+	"strings"
+	"testing"
+
+	"github.com/phoenix-engine/phx/gen/cpp"
+	pt "github.com/phoenix-engine/phx/testing"
+)
+
+func TestWriteObject(t *testing.T) {
+	for i, test := range []struct {
+		arch          string
+		content       string
+		expectMachine elf.Machine
+	}{{
+		arch:          "x86-64",
+		content:       "hello",
+		expectMachine: elf.EM_X86_64,
+	}, {
+		arch:          "aarch64",
+		content:       strings.Repeat("some content ", 100),
+		expectMachine: elf.EM_AARCH64,
+	}, {
+		arch:          "amd64",
+		expectMachine: elf.EM_X86_64,
+	}} {
+		m, err := cpp.MachineFor(test.arch)
+		if err != nil {
+			t.Fatalf("%d: expected nil error, got %#v", i, err)
+		}
+
+		res := cpp.Resource{Name: "sub/foo.txt", Size: 1234}
+		buf := new(bytes.Buffer)
+		err = cpp.WriteObject(buf, m, res,
+			strings.NewReader(test.content), int64(len(test.content)))
+		if err != nil {
+			t.Fatalf("%d: expected nil error, got %#v", i, err)
+		}
+
+		f, err := elf.NewFile(bytes.NewReader(buf.Bytes()))
+		if err != nil {
+			t.Fatalf("%d: expected nil error, got %#v", i, err)
+		}
+
+		pt.CheckEq(t, f.Type, elf.ET_REL)
+		pt.CheckEq(t, f.Machine, test.expectMachine)
+		pt.CheckEq(t, f.Class, elf.ELFCLASS64)
+
+		rodata := f.Section(".rodata")
+		if rodata == nil {
+			t.Fatalf("%d: expected a .rodata section", i)
+		}
+		pt.CheckEq(t, rodata.Flags, elf.SHF_ALLOC)
+		data, err := rodata.Data()
+		if err != nil {
+			t.Fatalf("%d: expected nil error, got %#v", i, err)
+		}
+
+		syms, err := f.Symbols()
+		if err != nil {
+			t.Fatalf("%d: expected nil error, got %#v", i, err)
+		}
+		if len(syms) != 2 {
+			t.Fatalf("%d: expected 2 symbols, got %+v", i, syms)
+		}
+
+		content, length := syms[0], syms[1]
+		pt.CheckEq(t, content.Name, "_ZN3res6Mapper11sub_foo_txtE")
+		pt.CheckEq(t, length.Name, "_ZN3res6Mapper15sub_foo_txt_lenE")
+		for _, s := range syms {
+			pt.CheckEq(t, elf.ST_BIND(s.Info), elf.STB_GLOBAL)
+			pt.CheckEq(t, elf.ST_TYPE(s.Info), elf.STT_OBJECT)
+			pt.CheckEq(t, int(s.Section), 1)
+		}
+
+		pt.CheckEq(t, content.Size, uint64(len(test.content)))
+		pt.CheckEq(t, string(data[content.Value:][:content.Size]),
+			test.content)
+		pt.CheckEq(t, length.Size, uint64(8))
+		pt.CheckEq(t, length.Value%8, uint64(0))
+		pt.CheckEq(t, binary.LittleEndian.Uint64(data[length.Value:]),
+			uint64(1234))
+	}
+}
+
+func TestWriteObjectErrors(t *testing.T) {
+	_, err := cpp.MachineFor("mips")
+	pt.CheckErrMatches(t, err, `unsupported architecture "mips"`)
+
+	err = cpp.WriteObject(new(bytes.Buffer), elf.EM_X86_64,
+		cpp.Resource{Name: "foo"}, strings.NewReader("abc"), 4)
+	pt.CheckErrMatches(t, err, "expected 4 bytes of content, got 3")
+}
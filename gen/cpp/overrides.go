@@ -0,0 +1,345 @@
+package cpp
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path"
+	"regexp"
+	"strings"
+	"text/template"
+
+	"github.com/phoenix-engine/phx/fs"
+	"github.com/phoenix-engine/phx/gen/compress"
+
+	"github.com/pkg/errors"
+)
+
+// TemplateExt is the extension of the files in a template directory.
+const TemplateExt = ".tmpl"
+
+// templateFiles are the names of the files each template creates, which
+// name their overrides in a template directory.
+var templateFiles = map[TemplateID]string{
+	TmpDecl:        "decl.cxx",
+	TmpDeclChunked: "decl_chunked.cxx",
+	TmpDeclIncbin:  "decl_incbin.cxx",
+	TmpIncbin:      "incbin.S",
+	TmpID:          "id.hpp",
+	TmpMapperHdr:   "mapper.hpp",
+	TmpMappings:    "mappings.cxx",
+
+	TmpCMakeLists:  "CMakeLists.txt",
+	TmpGitignore:   "gitignore",
+	TmpClangFormat: "clang-format",
+
+	TmpMapperImpl:   "mapper.cxx",
+	TmpResourceHdr:  "resource.hpp",
+	TmpResourceImpl: "resource.cxx",
+}
+
+// File returns the name of the file in a template directory which
+// overrides the template, such as "mapper.hpp.tmpl".
+func (id TemplateID) File() string {
+	return templateFiles[id] + TemplateExt
+}
+
+// templateFor returns the ID of the template the named file in a
+// template directory overrides.
+func templateFor(name string) (TemplateID, bool) {
+	for id := range templateFiles {
+		if id.File() == name {
+			return id, true
+		}
+	}
+	return 0, false
+}
+
+// Project is what the templates of the files of the whole project, such
+// as TmpCMakeLists, are executed with.
+type Project struct {
+	Resources Resources
+	Runtime
+}
+
+// Templates are the templates the generated source is created from.  The
+// zero Templates are the built-in templates.
+//
+// Besides the functions of text/template, templates may use upper and
+// lower to change the case of a string, snake and camel to convert it
+// to an identifier as in StyleSnake and StyleCamel, hex to format an
+// integer as a hex literal, size to format a number of bytes such as
+// "1.50 KB", and pages to count the pages of PageSize a number of bytes
+// takes up.
+type Templates struct {
+	overrides map[TemplateID]*template.Template
+
+	// sum is a hash of the overrides.
+	sum string
+}
+
+// LoadTemplates reads the templates in the root of the given FS, which
+// override the built-in templates.  Each is named by the File of the
+// template it overrides.  Files without TemplateExt are ignored.
+//
+// It returns an error if any template is unknown or doesn't parse, or
+// if it uses a field or method which its data doesn't have.
+func LoadTemplates(from fs.FS) (Templates, error) {
+	names, err := fs.Files(from, "")
+	if err != nil {
+		return Templates{}, errors.Wrap(err, "reading templates")
+	}
+
+	var (
+		t = Templates{overrides: make(map[TemplateID]*template.Template)}
+		h = sha256.New()
+	)
+	for _, name := range names {
+		if path.Ext(name) != TemplateExt {
+			continue
+		}
+
+		id, ok := templateFor(name)
+		if !ok {
+			return Templates{}, errors.Errorf("unknown template %s", name)
+		}
+
+		bs, err := readAll(from, name)
+		if err != nil {
+			return Templates{}, err
+		}
+
+		tmp, err := parse(name, string(bs))
+		if err != nil {
+			return Templates{}, err
+		}
+		if err := check(tmp, sample(id)); err != nil {
+			return Templates{}, err
+		}
+
+		t.overrides[id] = tmp
+		fmt.Fprintf(h, "%s\x00%d\x00%s", name, len(bs), bs)
+	}
+
+	if len(t.overrides) > 0 {
+		t.sum = hex.EncodeToString(h.Sum(nil))
+	}
+	return t, nil
+}
+
+// Sum returns a hash of the overriding templates, or "" if there are
+// none.  Output created from different templates has different Sums.
+func (t Templates) Sum() string { return t.sum }
+
+// Creator returns a Creator of the named file, from the template with the
+// given ID executed with the given data.
+func (t Templates) Creator(name string, id TemplateID, data interface{}) Creator {
+	return templateCreator{t, name, id, data}
+}
+
+type templateCreator struct {
+	Templates
+
+	name string
+	id   TemplateID
+	data interface{}
+}
+
+func (c templateCreator) Create(f fs.FS) error {
+	ff, err := f.Create(c.name)
+	if err != nil {
+		return errors.Wrapf(err, "creating %s", c.name)
+	}
+
+	if err := c.expand(ff, c.id, c.data); err != nil {
+		ff.Close()
+		return errors.Wrapf(err, "executing %s", c.name)
+	}
+
+	return errors.Wrapf(ff.Close(), "closing %s", c.name)
+}
+
+// CreateImplementations creates the files that don't depend on the
+// resources, using the Runtime of the Project.  Unless they are
+// overridden, their contents are copied as they are.
+func (t Templates) CreateImplementations(f fs.FS, p Project) error {
+	for fname, impl := range map[string]struct {
+		id      TemplateID
+		content string
+	}{
+		"mapper.cxx":    {TmpMapperImpl, p.MapperImpl},
+		"resource.hpp":  {TmpResourceHdr, p.ResourceHdr},
+		"resource.cxx":  {TmpResourceImpl, p.ResourceImpl},
+		".gitignore":    {TmpGitignore, templates[TmpGitignore]},
+		".clang-format": {TmpClangFormat, templates[TmpClangFormat]},
+	} {
+		if _, ok := t.overrides[impl.id]; ok {
+			if err := t.Creator(fname, impl.id, p).Create(f); err != nil {
+				return err
+			}
+			continue
+		}
+
+		ff, err := f.Create(fname)
+		if err != nil {
+			return errors.Wrapf(err, "creating %s", fname)
+		}
+
+		_, err = io.WriteString(ff, impl.content)
+		if err != nil {
+			ff.Close()
+			return errors.Wrapf(err, "writing %s", fname)
+		}
+
+		if err := ff.Close(); err != nil {
+			return errors.Wrapf(err, "closing %s", fname)
+		}
+	}
+
+	return nil
+}
+
+// expand executes the template with the given ID into w.
+func (t Templates) expand(w io.Writer, id TemplateID, data interface{}) error {
+	tmp, ok := t.overrides[id]
+	if !ok {
+		var err error
+		if tmp, err = parse(id.File(), templates[id]); err != nil {
+			return err
+		}
+	}
+
+	return explain(tmp.Execute(w, data))
+}
+
+func parse(name, text string) (*template.Template, error) {
+	tmp, err := template.New(name).Funcs(funcs).Parse(text)
+	return tmp, errors.Wrapf(err, "parsing template %s", name)
+}
+
+func readAll(from fs.FS, name string) ([]byte, error) {
+	f, err := from.Open(name)
+	if err != nil {
+		return nil, errors.Wrapf(err, "opening template %s", name)
+	}
+
+	bs, err := ioutil.ReadAll(f)
+	if err != nil {
+		f.Close()
+		return nil, errors.Wrapf(err, "reading template %s", name)
+	}
+
+	return bs, errors.Wrapf(f.Close(), "closing template %s", name)
+}
+
+// check executes the template with sample data, and returns an error if
+// it uses a field or method the data doesn't have.  Other errors may be
+// due to the sample, so they are left for when it is used.
+func check(tmp *template.Template, data interface{}) error {
+	err := tmp.Execute(ioutil.Discard, data)
+	if err != nil && fieldErr.MatchString(err.Error()) {
+		return explain(err)
+	}
+	return nil
+}
+
+// sample returns data like that which the template with the given ID
+// is executed with.  Both chunked and unchunked resources are included,
+// so each branch of the built-in templates is used.
+func sample(id TemplateID) interface{} {
+	var (
+		res = Resource{
+			Name:      "dir/example.txt",
+			Size:      2 * PageSize,
+			Codec:     compress.DefaultCodec,
+			CompCount: PageSize + 1,
+		}
+		chunked = res
+		incbin  = res
+	)
+	chunked.Name, chunked.ChunkSize = "dir/chunked.txt", PageSize
+	incbin.Embed = EmbedIncbin
+
+	switch id {
+	case TmpDecl:
+		return res
+	case TmpDeclChunked:
+		return chunked
+	case TmpDeclIncbin, TmpIncbin:
+		return incbin
+	case TmpID, TmpMapperHdr, TmpMappings:
+		return Resources{chunked, res}
+	default:
+		rt, _ := RuntimeFor(compress.DefaultCodec)
+		return Project{Resources{chunked, res}, rt}
+	}
+}
+
+// fieldErr matches the error of a template which uses a field or method
+// its data doesn't have.
+var fieldErr = regexp.MustCompile(
+	`^template: ([^:]*):(\d+):\d+: executing .* can't evaluate field (\w+) in type (.*)$`,
+)
+
+// explain returns err, or a clearer error if it is a fieldErr.
+func explain(err error) error {
+	if err == nil {
+		return nil
+	}
+
+	m := fieldErr.FindStringSubmatch(err.Error())
+	if m == nil {
+		return err
+	}
+
+	// The type is named without its package, such as Resource.
+	typ := qualifier.ReplaceAllString(m[4], "")
+	return errors.Errorf("template %s, line %s: %s has no field or method %s",
+		m[1], m[2], typ, m[3])
+}
+
+var qualifier = regexp.MustCompile(`\b\w+\.`)
+
+// funcs are the functions available to templates, as described in the
+// documentation of Templates.
+var funcs = template.FuncMap{
+	"upper": strings.ToUpper,
+	"lower": strings.ToLower,
+	"snake": func(s string) string {
+		return Resource{Name: s}.VarName()
+	},
+	"camel": func(s string) string {
+		return camel(Resource{Name: s}.VarName())
+	},
+	"hex": func(n int64) string {
+		if n < 0 {
+			return fmt.Sprintf("-0x%x", -n)
+		}
+		return fmt.Sprintf("0x%x", n)
+	},
+	"size": humanSize,
+	"pages": func(n int64) int64 {
+		return (n + PageSize - 1) / PageSize
+	},
+}
+
+func humanSize(n int64) string {
+	const (
+		kb = 1 << 10
+		mb = 1 << 20
+		gb = 1 << 30
+	)
+
+	switch {
+	case n < kb:
+		return fmt.Sprintf("%d B", n)
+	case n < mb:
+		return fmt.Sprintf("%.2f KB", float64(n)/kb)
+	case n < gb:
+		return fmt.Sprintf("%.2f MB", float64(n)/mb)
+	default:
+		return fmt.Sprintf("%.2f GB", float64(n)/gb)
+	}
+}
@@ -0,0 +1,175 @@
+package cpp_test
+
+import (
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/phoenix-engine/phx/fs"
+	"github.com/phoenix-engine/phx/gen/cpp"
+	pt "github.com/phoenix-engine/phx/testing"
+)
+
+func makeTemplates(t *testing.T, files map[string]string) fs.FS {
+	m := fs.MakeMem()
+	for name, content := range files {
+		f, err := m.Create(name)
+		if err != nil {
+			t.Fatalf("expected nil error, got %#v", err)
+		}
+		if _, err := io.WriteString(f, content); err != nil {
+			t.Fatalf("expected nil error, got %#v", err)
+		}
+		f.Close()
+	}
+	return m
+}
+
+func TestLoadTemplates(t *testing.T) {
+	for i, test := range []struct {
+		should    string
+		given     map[string]string
+		expectErr string
+		expectSum bool
+	}{{
+		should: "use the built-in templates if there are none",
+	}, {
+		should:    "load an override",
+		given:     map[string]string{"id.hpp.tmpl": "{{range .}}{{.Ident}}{{end}}"},
+		expectSum: true,
+	}, {
+		should: "ignore other files",
+		given:  map[string]string{"README.md": "{{.Nope}}"},
+	}, {
+		should:    "reject an unknown template",
+		given:     map[string]string{"id.cxx.tmpl": ""},
+		expectErr: `^unknown template id\.cxx\.tmpl$`,
+	}, {
+		should:    "reject a template which doesn't parse",
+		given:     map[string]string{"decl.cxx.tmpl": "{{.Size"},
+		expectErr: `^parsing template decl\.cxx\.tmpl: `,
+	}, {
+		should: "report a field the Resource doesn't have",
+		given: map[string]string{
+			"decl.cxx.tmpl": "// {{.Name}}\n{{.Length}}",
+		},
+		expectErr: `^template decl\.cxx\.tmpl, line 2: Resource has no field or method Length$`,
+	}, {
+		should: "report a field of a chunked Resource",
+		given: map[string]string{
+			"decl_chunked.cxx.tmpl": "{{range .Chunks}}{{.Name}}{{end}}",
+		},
+		expectErr: `^template decl_chunked\.cxx\.tmpl, line 1: string has no field or method Name$`,
+	}, {
+		should: "report a field the project doesn't have",
+		given: map[string]string{
+			"CMakeLists.txt.tmpl": "{{.Resources.Root}} {{.Libraries}}",
+		},
+		expectErr: `^template CMakeLists\.txt\.tmpl, line 1: Project has no field or method Libraries$`,
+	}, {
+		should: "report a field of the Resources",
+		given: map[string]string{
+			"mappings.cxx.tmpl": "{{range .}}{{.IDRef}} {{.Id}}{{end}}",
+		},
+		expectErr: `^template mappings\.cxx\.tmpl, line 1: Resource has no field or method Id$`,
+	}} {
+		t.Logf("test %d: should %s", i, test.should)
+
+		tmps, err := cpp.LoadTemplates(makeTemplates(t, test.given))
+		if !pt.CheckErrMatches(t, err, test.expectErr) {
+			continue
+		}
+		pt.CheckEq(t, tmps.Sum() != "", test.expectSum)
+	}
+}
+
+func TestTemplatesSum(t *testing.T) {
+	load := func(content string) string {
+		tmps, err := cpp.LoadTemplates(makeTemplates(t, map[string]string{
+			"mapper.hpp.tmpl": content,
+		}))
+		if err != nil {
+			t.Fatalf("expected nil error, got %#v", err)
+		}
+		return tmps.Sum()
+	}
+
+	a, b := load("// a\n"), load("// b\n")
+	pt.CheckEq(t, a != b, true)
+	pt.CheckEq(t, load("// a\n"), a)
+}
+
+func TestTemplatesCreator(t *testing.T) {
+	tmps, err := cpp.LoadTemplates(makeTemplates(t, map[string]string{
+		"id.hpp.tmpl": `{{range .}}{{upper .VarName}} {{camel .Name}} ` +
+			`{{hex .Size}} {{size .Size}} {{pages .Size}}
+{{end}}`,
+	}))
+	if err != nil {
+		t.Fatalf("expected nil error, got %#v", err)
+	}
+
+	ff := mockFS{objs: make(map[string]bcl)}
+	res := cpp.Resources{
+		{Name: "ui/title_screen.png", Size: 1536},
+		{Name: "a.txt", Size: 5000},
+	}
+	if err := tmps.Creator("id.hpp", cpp.TmpID, res).Create(ff); err != nil {
+		t.Fatalf("expected nil error, got %#v", err)
+	}
+	expect := `
+UI_TITLE_SCREEN_PNG UiTitleScreenPng 0x600 1.50 KB 1
+A_TXT ATxt 0x1388 4.88 KB 2
+`[1:]
+	if got := ff.objs["id.hpp"].String(); got != expect {
+		t.Errorf("\n======== expected:\n%s\n\n"+
+			"======== got:\n%s", expect, got)
+	}
+
+	// The templates which aren't overridden are built in.
+	if err := tmps.Creator("mappings.cxx", cpp.TmpMappings, res).Create(ff); err != nil {
+		t.Fatalf("expected nil error, got %#v", err)
+	}
+	if got := ff.objs["mappings.cxx"].String(); !strings.Contains(got, "ID::a_txt") {
+		t.Errorf("expected built-in mappings.cxx, got:\n%s", got)
+	}
+
+	// A field is only checked in the branches the sample data takes,
+	// so the error is also explained when it is executed.
+	tmps, err = cpp.LoadTemplates(makeTemplates(t, map[string]string{
+		"id.hpp.tmpl": `{{range .}}{{if eq .Name "a"}}{{.Nope}}{{end}}{{end}}`,
+	}))
+	if err != nil {
+		t.Fatalf("expected nil error, got %#v", err)
+	}
+	err = tmps.Creator("id.hpp", cpp.TmpID, cpp.Resources{{Name: "a"}}).Create(ff)
+	pt.CheckErrMatches(t, err, `^executing id\.hpp: template id\.hpp\.tmpl, line 1: `+
+		`Resource has no field or method Nope$`)
+}
+
+func TestTemplatesCreateImplementations(t *testing.T) {
+	tmps, err := cpp.LoadTemplates(makeTemplates(t, map[string]string{
+		"resource.hpp.tmpl": "// {{.Library}} {{len .Resources}}\n",
+	}))
+	if err != nil {
+		t.Fatalf("expected nil error, got %#v", err)
+	}
+
+	rt, err := cpp.RuntimeFor("lz4")
+	if err != nil {
+		t.Fatalf("expected nil error, got %#v", err)
+	}
+
+	ff := mockFS{objs: make(map[string]bcl)}
+	err = tmps.CreateImplementations(ff, cpp.Project{
+		Resources: cpp.Resources{{Name: "a.txt"}},
+		Runtime:   rt,
+	})
+	if err != nil {
+		t.Fatalf("expected nil error, got %#v", err)
+	}
+
+	pt.CheckEq(t, len(ff.objs), 5)
+	pt.CheckEq(t, ff.objs["resource.hpp"].String(), "// LZ4F 1\n")
+	pt.CheckEq(t, ff.objs["resource.cxx"].String(), rt.ResourceImpl)
+}
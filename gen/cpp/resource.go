@@ -1,30 +1,64 @@
 package cpp
 
 import (
+	"debug/elf"
+	"fmt"
 	"io"
+	"path"
+	"strconv"
 	"strings"
-	"text/template"
+	"unicode"
+	"unicode/utf8"
 
+	"github.com/phoenix-engine/phx/fs"
 	"github.com/phoenix-engine/phx/gen/compress"
 
 	"github.com/pkg/errors"
+	"golang.org/x/text/unicode/norm"
 )
 
 // Resource represents a static asset or resource generated from a file.
 type Resource struct {
-	// Name is the original filename of the resource.  This is
-	// needed for encoding the actual variable name in the var
-	// declaration.
+	// Name is the original slash-separated path of the resource,
+	// relative to the resource root.  This is needed for encoding
+	// the actual variable name in the var declaration.
 	Name string
 
-	// TODO:
-	// ID is a numeric ID assigned to the resource in case of a name
-	// collision.
+	// ID, if nonzero, is a numeric ID assigned to the resource in
+	// case of a name collision, which is appended to its VarName.
+	// See Names.Disambiguate.
 	ID int
 
 	// Size is the full uncompressed size of the resource.
 	Size int64
 
+	// Codec is the name of the compress.Codec the resource was
+	// compressed with.  If it is empty, compress.DefaultCodec is
+	// assumed.
+	Codec string
+
+	// Embed is how the content of the resource is embedded.
+	Embed Embed
+
+	// ChunkSize, if positive, is the size of the arrays the content
+	// of an EmbedArray Resource is split into.
+	ChunkSize int64
+
+	// Machine is the architecture of the object file of an EmbedELF
+	// Resource.
+	Machine elf.Machine
+
+	// Naming selects the identifier and namespace of the Resource in
+	// the C++ API.
+	Naming Naming
+
+	// from is where the asset of an EmbedELF Resource is read back
+	// from when its object file is written.
+	from fs.FS
+
+	// tmps are the templates of the Resource's declaration.
+	tmps Templates
+
 	// Into is the writer which the static asset will be written to.
 	// Decl is the writer which will encode the variable declaration
 	// referring to the asset.
@@ -37,6 +71,10 @@ type Resource struct {
 	// This handles closing the compressor / array writer first, and
 	// then the file underlying it.
 	CloserCloser
+
+	// gen counts the times the Resource's name was created before
+	// it by its Target.
+	gen int
 }
 
 func (r *Resource) Write(some []byte) (n int, err error) {
@@ -66,50 +104,315 @@ func (r *Resource) Close() (err error) {
 		return errors.Wrapf(err, "closing asset for %s", r.Name)
 	}
 
-	if err := AssetDecl(*r).Expand(r.Decl); err != nil {
-		return errors.Wrapf(err, "expanding declaration for %s", r.Name)
-	}
-
 	// Set the compressed count, if the target implements it.
 	// TODO: Use fixed decltype instead.
 	if cc, ok := r.Into.(compress.Counter); ok {
 		r.CompCount = cc.Count()
 	}
 
+	if r.Embed == EmbedELF {
+		// The declaration is an object file containing the
+		// asset, which is no longer needed after it's written.
+		if err := r.writeObject(); err != nil {
+			r.Decl.Close()
+			return errors.Wrapf(err, "writing object for %s", r.Name)
+		}
+	} else if err := AssetDecl(*r).Expand(r.Decl); err != nil {
+		return errors.Wrapf(err, "expanding declaration for %s", r.Name)
+	}
+
 	// Now close the declaration output file.
 	return errors.Wrapf(r.Decl.Close(), "closing declaration for %s", r.Name)
 }
 
+func (r *Resource) writeObject() error {
+	fi, err := r.from.Lstat(r.Asset())
+	if err != nil {
+		return err
+	}
+
+	asset, err := r.from.Open(r.Asset())
+	if err != nil {
+		return err
+	}
+
+	err = WriteObject(r.Decl, r.Machine, *r, asset, fi.Size())
+	if cerr := asset.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+
+	return r.from.Remove(r.Asset())
+}
+
 // VarName returns the cleansed name of the resource which may be used
-// as a sanitized variable name in C++.
+// as a sanitized variable name in C++.  Letters with diacritics and
+// ligatures become their ASCII letters, and other non-ASCII characters
+// become "u" followed by their hex codepoint, such as "u65e5".  Any
+// other character which can't be part of an identifier becomes '_', and
+// a leading digit becomes 'd'.  It is not checked against C++ keywords
+// or other resources; see Names.
 func (r Resource) VarName() string {
-	firstOK := false
-	return strings.Map(func(rr rune) rune {
-		if !firstOK {
-			firstOK = true
-			if '0' <= rr && rr <= '9' {
-				return 'd'
-			}
+	var b strings.Builder
+	for _, rr := range norm.NFC.String(r.Name) {
+		switch {
+		case isIdentASCII(rr):
+			b.WriteRune(rr)
+		case rr < utf8.RuneSelf, rr == utf8.RuneError:
+			b.WriteByte('_')
+		case unicode.Is(unicode.Mn, rr) && b.Len() > 0:
+			// A mark which doesn't combine with the letter
+			// before it is dropped.
+		default:
+			b.WriteString(transliterate(rr))
 		}
+	}
 
+	name := b.String()
+	if name != "" && '0' <= name[0] && name[0] <= '9' {
+		name = "d" + name[1:]
+	}
+	if r.ID != 0 {
+		name += fmt.Sprintf("_%08x", uint32(r.ID))
+	}
+	return name
+}
+
+// CommentName returns the name of the resource as it is shown in the
+// comments of the generated source.  Printable UTF-8 is kept as it is,
+// and other characters are escaped as in a Go string literal, so they
+// can't end the comment or splice the next line onto it.
+func (r Resource) CommentName() string {
+	var b strings.Builder
+	for i := 0; i < len(r.Name); {
+		rr, size := utf8.DecodeRuneInString(r.Name[i:])
 		switch {
-		case 'A' <= rr && rr <= 'z',
-			'0' <= rr && rr <= '9':
-			return rr
+		case size == 1 && rr == utf8.RuneError:
+			fmt.Fprintf(&b, `\x%02x`, r.Name[i])
+		case rr == '\\':
+			// A backslash is escaped so it can't end the line.
+			b.WriteString(`\x5c`)
+		case unicode.IsPrint(rr):
+			b.WriteRune(rr)
+		default:
+			b.WriteString(strings.Trim(strconv.QuoteRune(rr), "'"))
 		}
+		i += size
+	}
+	return b.String()
+}
+
+// Dir returns the slash-separated directory of the resource relative to
+// the resource root, or "" if the resource is at the top level.
+func (r Resource) Dir() string {
+	if d := path.Dir(r.Name); d != "." {
+		return d
+	}
+	return ""
+}
+
+// Path returns the slash-separated path of the generated files for the
+// resource, relative to the Target root and without a suffix.  The
+// directory hierarchy of the resource is preserved under "res/".
+func (r Resource) Path() string {
+	return path.Join("res", r.Dir(), r.VarName())
+}
+
+// Asset returns the path of the file the compressed content of the
+// resource is written to.  For EmbedELF, it is only kept until the
+// object file is written.  A chunked resource has an asset for each of
+// its Chunks instead.
+func (r Resource) Asset() string {
+	switch r.Embed {
+	case EmbedIncbin, EmbedELF:
+		return r.Path() + "_real.bin"
+	}
+	return r.Path() + "_real.cxx"
+}
+
+// Assets returns the paths of the files the content of an EmbedArray
+// resource is written to, which is one for each of its Chunks if it is
+// chunked.
+func (r Resource) Assets() []string {
+	chunks := r.Chunks()
+	if chunks == nil {
+		return []string{r.Asset()}
+	}
+
+	assets := make([]string, len(chunks))
+	for i, c := range chunks {
+		assets[i] = r.chunkAsset(c)
+	}
+	return assets
+}
+
+// Chunks returns the variable names of the arrays the content of a
+// chunked resource is split into, which are its VarName followed by the
+// index of each chunk.  It returns nil if the resource is not chunked.
+// A chunked resource always has at least one chunk.
+func (r Resource) Chunks() []string {
+	if r.ChunkSize <= 0 {
+		return nil
+	}
 
-		// Special-cased matches
-		switch rr {
-		case '_', '-':
+	n := (r.Stored() + r.ChunkSize - 1) / r.ChunkSize
+	if n < 1 {
+		n = 1
+	}
+
+	chunks := make([]string, n)
+	for i := range chunks {
+		chunks[i] = r.chunkVarName(i)
+	}
+	return chunks
+}
+
+func (r Resource) chunkVarName(i int) string {
+	return r.VarName() + "_" + strconv.Itoa(i)
+}
+
+func (r Resource) chunkAsset(varName string) string {
+	return path.Join("res", r.Dir(), varName+"_real.cxx")
+}
+
+// Stored returns the number of bytes of content the resource is stored
+// with, which is its Size if it is not compressed.
+func (r Resource) Stored() int64 {
+	if r.CodecName() == (compress.NoMaker{}).Name() {
+		return r.Size
+	}
+	return r.CompCount
+}
+
+// Outputs returns the paths of all of the files created for the
+// resource.
+func (r Resource) Outputs() []string {
+	switch r.Embed {
+	case EmbedIncbin:
+		return []string{
+			r.Asset(),
+			r.Path() + "_real.S",
+			r.Path() + "_decl.cxx",
 		}
+	case EmbedELF:
+		return []string{r.Path() + "_real.o"}
+	}
+	return append(r.Assets(), r.Path()+"_decl.cxx")
+}
+
+// Sources returns the paths of the files which are compiled or linked
+// into the Resource library for the resource.
+func (r Resource) Sources() []string {
+	switch r.Embed {
+	case EmbedIncbin:
+		return []string{r.Path() + "_decl.cxx", r.Path() + "_real.S"}
+	case EmbedELF:
+		return []string{r.Path() + "_real.o"}
+	}
+	return append([]string{r.Path() + "_decl.cxx"}, r.Assets()...)
+}
+
+// Symbol returns the assembler symbol of the resource's content, which
+// is the mangled name of the Mapper member declared for it.  Names are
+// mangled as in the Itanium C++ ABI used by GCC and Clang.
+func (r Resource) Symbol() string {
+	return r.mangleMember(r.VarName())
+}
+
+// LenSymbol returns the assembler symbol of the resource's length, as
+// in Symbol.
+func (r Resource) LenSymbol() string {
+	return r.mangleMember(r.VarName() + "_len")
+}
 
-		return '_'
-	}, r.Name) // + r.ID
+// mangleMember returns the mangled name of the named Mapper member in
+// the resource's root namespace.
+func (r Resource) mangleMember(name string) string {
+	var b strings.Builder
+	b.WriteString("_ZN")
+	for _, ns := range append(r.Root(), "Mapper", name) {
+		fmt.Fprintf(&b, "%d%s", len(ns), ns)
+	}
+	b.WriteByte('E')
+	return b.String()
+}
+
+// CodecName returns the name of the codec the resource is stored with.
+func (r Resource) CodecName() string {
+	if r.Codec == "" {
+		return compress.DefaultCodec
+	}
+	return r.Codec
 }
 
 // Resources implements sort.Interface.
 type Resources []Resource
 
+// Codec returns the codec of the Runtime which decodes the Resources.
+// Resources stored with "none" can be decoded by any Runtime, so it is
+// the one other codec used by the Resources, or "none" if there is no
+// other.  If there are no Resources, it is compress.DefaultCodec.
+func (r Resources) Codec() (string, error) {
+	if len(r) == 0 {
+		return compress.DefaultCodec, nil
+	}
+
+	var (
+		none  = compress.NoMaker{}.Name()
+		codec = none
+		first string
+	)
+	for _, res := range r {
+		switch c := res.CodecName(); {
+		case c == none, c == codec:
+		case codec == none:
+			codec, first = c, res.Name
+		default:
+			return "", errors.Errorf(
+				"%s uses codec %q, but %s uses %q; "+
+					"all resources must use the same codec",
+				first, codec, res.Name, c)
+		}
+	}
+	return codec, nil
+}
+
+// Included returns the paths of the files which are included by the
+// Resources' declarations, rather than compiled on their own.
+func (r Resources) Included() []string {
+	var inc []string
+	for _, res := range r {
+		if res.Embed == EmbedArray {
+			inc = append(inc, res.Assets()...)
+		}
+	}
+	return inc
+}
+
+// Assembled returns the paths of the assembly files of the Resources.
+func (r Resources) Assembled() []string {
+	var asm []string
+	for _, res := range r {
+		if res.Embed == EmbedIncbin {
+			asm = append(asm, res.Path()+"_real.S")
+		}
+	}
+	return asm
+}
+
+// Objects returns the paths of the object files of the Resources.
+func (r Resources) Objects() []string {
+	var objs []string
+	for _, res := range r {
+		if res.Embed == EmbedELF {
+			objs = append(objs, res.Path()+"_real.o")
+		}
+	}
+	return objs
+}
+
 // Resources implements sort.Interface.
 func (r Resources) Len() int      { return len(r) }
 func (r Resources) Swap(i, j int) { r[i], r[j] = r[j], r[i] }
@@ -125,12 +428,24 @@ type AssetDecl Resource
 
 func (a AssetDecl) Expand(r io.WriteCloser) error {
 	res := Resource(a)
-	name := "res/" + res.VarName() + "_decl.cxx"
+	name := res.Path() + "_decl.cxx"
 
-	tmp, err := template.New(name).Parse(templates[TmpDecl])
-	if err != nil {
-		return errors.Wrapf(err, "parsing %s template", name)
+	id := TmpDecl
+	switch {
+	case res.Embed == EmbedIncbin:
+		id = TmpDeclIncbin
+	case res.ChunkSize > 0:
+		id = TmpDeclChunked
 	}
 
-	return errors.Wrapf(tmp.Execute(r, res), "executing %s", name)
+	return errors.Wrapf(res.tmps.expand(r, id, res), "executing %s", name)
+}
+
+// AssetAsm creates the assembly file which includes the raw content of
+// an EmbedIncbin Resource.
+type AssetAsm Resource
+
+func (a AssetAsm) Create(f fs.FS) error {
+	res := Resource(a)
+	return res.tmps.Creator(res.Path()+"_real.S", TmpIncbin, res).Create(f)
 }
@@ -2,9 +2,11 @@ package cpp_test
 
 import (
 	"bytes"
+	"strings"
 	"testing"
 
 	"github.com/phoenix-engine/phx/gen/cpp"
+	pt "github.com/phoenix-engine/phx/testing"
 )
 
 func TestDeclExpand(t *testing.T) {
@@ -34,3 +36,152 @@ namespace res {
 		t.FailNow()
 	}
 }
+
+func TestIncbinExpand(t *testing.T) {
+	res := cpp.Resource{
+		Name:  "sub/foo.txt",
+		Size:  1000,
+		Embed: cpp.EmbedIncbin,
+	}
+
+	buf := bcl{new(bytes.Buffer)}
+	if err := cpp.AssetDecl(res).Expand(buf); err != nil {
+		t.Fatalf("expected nil error, but got %#v", err)
+	}
+	pt.CheckEq(t, buf.String(), `
+#include "mapper.hpp"
+
+namespace res {
+    // Mapper::sub_foo_txt is defined by sub_foo_txt_real.S.
+    const size_t Mapper::sub_foo_txt_len = 1000;
+}; // namespace res
+`[1:])
+
+	ff := mockFS{objs: make(map[string]bcl)}
+	if err := cpp.AssetAsm(res).Create(ff); err != nil {
+		t.Fatalf("expected nil error, but got %#v", err)
+	}
+
+	asm := ff.objs["res/sub/sub_foo_txt_real.S"].String()
+	for _, expect := range []string{
+		"\t.globl  PHX_SYM(_ZN3res6Mapper11sub_foo_txtE)\n",
+		"\t.incbin \"res/sub/sub_foo_txt_real.bin\"\n",
+	} {
+		if !strings.Contains(asm, expect) {
+			t.Errorf("expected assembly to contain %q:\n%s", expect, asm)
+		}
+	}
+
+	pt.CheckEq(t, strings.Join(res.Outputs(), " "),
+		"res/sub/sub_foo_txt_real.bin "+
+			"res/sub/sub_foo_txt_real.S "+
+			"res/sub/sub_foo_txt_decl.cxx")
+}
+
+func TestChunkedExpand(t *testing.T) {
+	res := cpp.Resource{
+		Name:      "sub/foo.txt",
+		Size:      10000,
+		Codec:     "none",
+		ChunkSize: 4096,
+	}
+
+	buf := bcl{new(bytes.Buffer)}
+	if err := cpp.AssetDecl(res).Expand(buf); err != nil {
+		t.Fatalf("expected nil error, but got %#v", err)
+	}
+	pt.CheckEq(t, buf.String(), `
+#include "mapper.hpp"
+
+namespace res {
+    const size_t Mapper::sub_foo_txt_len = 10000;
+
+    const unsigned char Mapper::sub_foo_txt_0[] = {
+#include "sub_foo_txt_0_real.cxx"
+    };
+
+    const unsigned char Mapper::sub_foo_txt_1[] = {
+#include "sub_foo_txt_1_real.cxx"
+    };
+
+    const unsigned char Mapper::sub_foo_txt_2[] = {
+#include "sub_foo_txt_2_real.cxx"
+    };
+
+    const unsigned char* const Mapper::sub_foo_txt_chunks[] = {
+	sub_foo_txt_0,
+	sub_foo_txt_1,
+	sub_foo_txt_2,
+    };
+}; // namespace res
+`[1:])
+
+	pt.CheckEq(t, strings.Join(res.Outputs(), " "),
+		"res/sub/sub_foo_txt_0_real.cxx "+
+			"res/sub/sub_foo_txt_1_real.cxx "+
+			"res/sub/sub_foo_txt_2_real.cxx "+
+			"res/sub/sub_foo_txt_decl.cxx")
+
+	// Compressed content is chunked by its compressed size, and
+	// there is always at least one chunk.
+	for _, test := range []struct {
+		codec       string
+		compressed  int64
+		expectCount int
+	}{
+		{"lz4", 4096, 1},
+		{"lz4", 4097, 2},
+		{"deflate", 0, 1},
+	} {
+		res.Codec, res.CompCount = test.codec, test.compressed
+		pt.CheckEq(t, len(res.Chunks()), test.expectCount)
+	}
+
+	res.ChunkSize = 0
+	if res.Chunks() != nil {
+		t.Errorf("expected no chunks, got %v", res.Chunks())
+	}
+}
+
+func TestResourcePath(t *testing.T) {
+	for i, test := range []struct {
+		should     string
+		given      string
+		expectDir  string
+		expectVar  string
+		expectPath string
+	}{{
+		should:     "place a top-level resource directly in res",
+		given:      "foo.txt",
+		expectVar:  "foo_txt",
+		expectPath: "res/foo_txt",
+	}, {
+		should:     "preserve the hierarchy of a nested resource",
+		given:      "textures/ui/button.png",
+		expectDir:  "textures/ui",
+		expectVar:  "textures_ui_button_png",
+		expectPath: "res/textures/ui/textures_ui_button_png",
+	}} {
+		t.Logf("test %d: should %s", i, test.should)
+
+		res := cpp.Resource{Name: test.given}
+		pt.CheckEq(t, res.Dir(), test.expectDir)
+		pt.CheckEq(t, res.VarName(), test.expectVar)
+		pt.CheckEq(t, res.Path(), test.expectPath)
+	}
+}
+
+func TestCommentName(t *testing.T) {
+	for _, test := range []struct {
+		given, expect string
+	}{
+		{"textures/ui/button.png", "textures/ui/button.png"},
+		{"über/日本.txt", "über/日本.txt"},
+		{"a\nb\u202e.txt", `a\nb\u202e.txt`},
+		{"a\\", `a\x5c`},
+		{"\xff.bin", `\xff.bin`},
+	} {
+		pt.CheckEq(t, cpp.Resource{Name: test.given}.CommentName(),
+			test.expect)
+	}
+}
@@ -0,0 +1,129 @@
+package cpp
+
+import (
+	"strings"
+	"sync"
+
+	"github.com/phoenix-engine/phx/gen/compress"
+
+	"github.com/pkg/errors"
+)
+
+// Runtime is the C++ runtime which decodes resources compressed with a
+// particular compress.Codec.  Each Runtime implements the same Resource
+// and Mapper interface.
+//
+// Its sources declare everything between "namespace res {" and
+// "}; // namespace res", which In replaces with another namespace, so
+// each source must contain both.
+type Runtime struct {
+	// MapperImpl, ResourceHdr and ResourceImpl are the contents of
+	// mapper.cxx, resource.hpp and resource.cxx.
+	MapperImpl, ResourceHdr, ResourceImpl string
+
+	// CMake, if set, is added to CMakeLists.txt to define or find
+	// Library.  Library, if set, is linked into the Resource
+	// library.
+	CMake, Library string
+}
+
+// In returns the Runtime with its sources declared in the given root
+// namespace instead of DefaultNamespace.  It fails if a source doesn't
+// open and close DefaultNamespace as described in Runtime.
+func (r Runtime) In(ns Namespace) (Runtime, error) {
+	if err := r.check(); err != nil {
+		return r, err
+	}
+
+	def := Namespace{DefaultNamespace}
+	rep := strings.NewReplacer(
+		def.Open(), ns.Open(),
+		def.Close(), ns.Close(),
+	)
+
+	r.MapperImpl = rep.Replace(r.MapperImpl)
+	r.ResourceHdr = rep.Replace(r.ResourceHdr)
+	r.ResourceImpl = rep.Replace(r.ResourceImpl)
+	return r, nil
+}
+
+// check returns an error if a source of the Runtime doesn't open and
+// close DefaultNamespace.
+func (r Runtime) check() error {
+	def := Namespace{DefaultNamespace}
+	for _, src := range []struct{ name, content string }{
+		{"mapper.cxx", r.MapperImpl},
+		{"resource.hpp", r.ResourceHdr},
+		{"resource.cxx", r.ResourceImpl},
+	} {
+		for _, marker := range []string{def.Open(), def.Close()} {
+			if !strings.Contains(src.content, marker) {
+				return errors.Errorf("runtime %s doesn't contain %q",
+					src.name, marker)
+			}
+		}
+	}
+	return nil
+}
+
+var runtimes = struct {
+	sync.RWMutex
+	byCodec map[string]Runtime
+}{byCodec: map[string]Runtime{
+	"lz4": {
+		MapperImpl:   lz4MapperImplTmp,
+		ResourceHdr:  lz4ResourceHdrTmp,
+		ResourceImpl: lz4ResourceImplTmp,
+
+		CMake:   lz4CMakeTmp,
+		Library: "LZ4F",
+	},
+	"deflate": {
+		MapperImpl:   deflateMapperImplTmp,
+		ResourceHdr:  deflateResourceHdrTmp,
+		ResourceImpl: deflateResourceImplTmp,
+
+		CMake:   deflateCMakeTmp,
+		Library: "ZLIB::ZLIB",
+	},
+	"none": {
+		MapperImpl:   noneMapperImplTmp,
+		ResourceHdr:  noneResourceHdrTmp,
+		ResourceImpl: noneResourceImplTmp,
+	},
+}}
+
+// Register makes the Codec available using compress.Register, along
+// with the Runtime which decodes it, so that every Codec the C++ output
+// may use has a Runtime.  It panics if the Codec is already registered,
+// or if the Runtime is invalid.
+func Register(c compress.Codec, r Runtime) {
+	runtimes.Lock()
+	defer runtimes.Unlock()
+
+	if _, ok := runtimes.byCodec[c.Name]; ok {
+		panic("cpp: runtime for codec " + c.Name + " registered twice")
+	}
+	if err := r.check(); err != nil {
+		panic("cpp: runtime for codec " + c.Name + ": " + err.Error())
+	}
+	compress.Register(c)
+	runtimes.byCodec[c.Name] = r
+}
+
+// RuntimeFor returns the Runtime for the named codec.  The empty name
+// refers to compress.DefaultCodec.
+func RuntimeFor(codec string) (Runtime, error) {
+	if codec == "" {
+		codec = compress.DefaultCodec
+	}
+
+	runtimes.RLock()
+	defer runtimes.RUnlock()
+
+	r, ok := runtimes.byCodec[codec]
+	if !ok {
+		return r, errors.Errorf("no C++ runtime for codec %q", codec)
+	}
+	return r, nil
+}
@@ -2,8 +2,13 @@ package cpp
 
 import (
 	"io"
+	"os"
+	"sync"
 
+	"github.com/phoenix-engine/phx/fs"
 	"github.com/phoenix-engine/phx/gen/compress"
+
+	"github.com/pkg/errors"
 )
 
 type DoneCloser struct {
@@ -29,3 +34,39 @@ func (d DoneCloser) Count() int64 {
 	}
 	return 0
 }
+
+// created holds the latest Resource a Target created for each name.  A
+// resource may be created again, replacing its output, such as to store
+// it uncompressed if it doesn't compress well enough.
+type created struct {
+	sync.Mutex
+	latest map[string]*Resource
+}
+
+// add registers res as the latest Resource of its name, numbering it,
+// and removes the files of the one it replaces from the FS.
+func (c *created) add(res *Resource, from fs.FS) error {
+	c.Lock()
+	defer c.Unlock()
+
+	if prev := c.latest[res.Name]; prev != nil {
+		res.gen = prev.gen + 1
+		for _, o := range prev.Outputs() {
+			if err := from.Remove(o); err != nil && !os.IsNotExist(err) {
+				return errors.Wrapf(err, "removing %s", o)
+			}
+		}
+	}
+	c.latest[res.Name] = res
+	return nil
+}
+
+// replaced returns true if res was created, and then replaced by a
+// Resource created later.
+func (c *created) replaced(res Resource) bool {
+	c.Lock()
+	defer c.Unlock()
+
+	latest := c.latest[res.Name]
+	return latest != nil && latest.gen != res.gen
+}
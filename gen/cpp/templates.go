@@ -1,29 +1,87 @@
 package cpp
 
-// TODO: Read templates from a template directory.
-// TODO: Add a "phx gen" helper for cloning / browsing templates
-
 var declTmp = `
 #include "mapper.hpp"
 
-namespace res {
+{{.Root.Open}}
     const size_t        Mapper::{{.VarName}}_len = {{.Size}};
     const unsigned char Mapper::{{.VarName}}[]   = {
 #include "{{.VarName}}_real.cxx"
     };
-}; // namespace res
+{{.Root.Close}}
+`[1:]
+
+// The chunks of a chunked resource are compiled together, but each is
+// its own array, since compilers limit the size of an initializer.
+var declChunkedTmp = `
+#include "mapper.hpp"
+
+{{.Root.Open}}
+    const size_t Mapper::{{.VarName}}_len = {{.Size}};
+{{range .Chunks}}
+    const unsigned char Mapper::{{.}}[] = {
+#include "{{.}}_real.cxx"
+    };
+{{end}}
+    const unsigned char* const Mapper::{{.VarName}}_chunks[] = {
+{{range .Chunks}}	{{.}},
+{{end}}    };
+{{.Root.Close}}
+`[1:]
+
+var declIncbinTmp = `
+#include "mapper.hpp"
+
+{{.Root.Open}}
+    // Mapper::{{.VarName}} is defined by {{.VarName}}_real.S.
+    const size_t Mapper::{{.VarName}}_len = {{.Size}};
+{{.Root.Close}}
+`[1:]
+
+// The assembler finds the .incbin file relative to the directory of
+// CMakeLists.txt, which is passed to it with -I.
+var incbinTmp = `
+// {{.CommentName}}
+
+#if defined(__APPLE__)
+#define PHX_SYM(name) _##name
+	.const
+#elif defined(_WIN32)
+#define PHX_SYM(name) name
+	.section .rdata,"dr"
+#else
+#define PHX_SYM(name) name
+	.section .rodata
+#endif
+
+	.globl  PHX_SYM({{.Symbol}})
+	.balign 16
+PHX_SYM({{.Symbol}}):
+	.incbin "{{.Path}}_real.bin"
+PHX_SYM({{.Symbol}}_end):
+
+#if defined(__ELF__)
+	.type   {{.Symbol}}, %object
+	.size   {{.Symbol}}, {{.Symbol}}_end - {{.Symbol}}
+	.section .note.GNU-stack,"",%progbits
+#endif
 `[1:]
 
 var idTmp = `
-{{define "expand"}}{{.VarName}}, // {{.Name}}
+{{define "expand"}}{{.Ident}}{{with .Value}} = {{.}}{{end}}, // {{.CommentName}}
 {{end}}`[1:] + `
 #ifndef PHX_RES_ID
 #define PHX_RES_ID
 
-namespace res {
+{{.Root.Open}}
+{{- range .Groups}}{{with .Scope}}
+
+    {{.Open}}{{end}}
     enum class ID {
-{{range .}}	{{template "expand" .}}{{end}}    };
-};
+{{range .Entries}}	{{template "expand" .}}{{end}}    };
+{{- with .Scope}}
+    {{.Close}}{{end}}{{end}}
+{{.Root.Close}}
 
 #endif
 `[1:]
@@ -31,29 +89,38 @@ namespace res {
 // TODO: Fix decltype
 var mappingsTmp = `
 {{define "expand"}}
-	// {{.Name}}
+	// {{.CommentName}}
 	{
-		ID::{{.VarName}},
-		{ {{.Count}}, {{.VarName}}_len, {{.VarName}} },
+		{{.IDRef}},
+{{- if .Chunks}}
+		{ "{{.CodecName}}", {{.Count}}, {{.VarName}}_len, {{index .Chunks 0}},
+		  {{.VarName}}_chunks, {{.ChunkSize}} },
+{{- else}}
+		{ "{{.CodecName}}", {{.Count}}, {{.VarName}}_len, {{.VarName}} },
+{{- end}}
 	},{{end}}`[1:] + `
 
 #include "id.hpp"
 #include "mapper.hpp"
 
-namespace res {
+{{.Root.Open}}
     std::map<ID, const Mapper::resDefn> Mapper::mappings{`[2:] + `
 
 {{range .}}{{template "expand" .}}
 {{end}}`[1:] + `
     };
-}; // namespace res
+{{.Root.Close}}
 `[1:]
 
 var mapperHdrTmp = `
 {{define "expand"}}
-	// {{.Name}}
+	// {{.CommentName}}
 	static const size_t        {{.VarName}}_len;
-	static const unsigned char {{.VarName}}[];{{end}}`[1:] + `
+{{- if .Chunks}}{{range .Chunks}}
+	static const unsigned char {{.}}[];{{end}}
+	static const unsigned char* const {{.VarName}}_chunks[];
+{{- else}}
+	static const unsigned char {{.VarName}}[];{{end}}{{end}}`[1:] + `
 
 #ifndef PHX_RES_MAPPER
 #define PHX_RES_MAPPER
@@ -64,7 +131,7 @@ var mapperHdrTmp = `
 #include "id.hpp"
 #include "resource.hpp"
 
-namespace res {
+{{.Root.Open}}
     // Mapper encapsulates implementation details of the mapping of IDs
     // to Resources away from the user.
     //
@@ -79,12 +146,26 @@ namespace res {
 	// Fetch creates and retrieves a unique smart-pointer to a
 	// Resource.
 	static std::unique_ptr<Resource> Fetch(ID) noexcept(false);
+{{- range .Nested}}
+	static std::unique_ptr<Resource> Fetch({{.}}::ID id) noexcept(false) {
+	    return Fetch(static_cast<ID>(id));
+	}{{end}}
 
     private:
+	// The codec is the name of the codec the content is stored
+	// with, such as "none" for uncompressed content.
+	//
+	// The content of a chunked resource is split into arrays of
+	// chunk_length bytes, except the last, which are listed in
+	// chunks.  Otherwise, chunks is null.
 	struct resDefn {
+	    const char*          codec;
 	    size_t               compressed_length;
 	    size_t               decompressed_length;
 	    const unsigned char* content;
+
+	    const unsigned char* const* chunks;
+	    size_t                      chunk_length;
 	};
 
 	static std::map<ID, const resDefn> mappings;
@@ -97,239 +178,43 @@ namespace res {
 {{end}}`[2:] + `
 
     };
-}; // namespace res
+{{.Root.Close}}
 
 #endif
 `[2:]
 
-var mapperImplTmp = `
-#include <map>
-
-#include "lz4frame.h"
-
-#include "id.hpp"
-#include "mapper.hpp"
-#include "resource.hpp"
-
-namespace res {
-    std::unique_ptr<Resource> Mapper::Fetch(ID id) noexcept(false) {
-	// This will never fail as long as every ID has a mapping.
-	auto from = mappings[id];
-
-	LZ4F_dctx* dec;
-	auto       lz4v = LZ4F_getVersion();
-	auto       err  = LZ4F_createDecompressionContext(&dec, lz4v);
-
-	if (LZ4F_isError(err)) {
-	    throw LZ4F_getErrorName(err);
-	}
-
-	return std::unique_ptr<Resource>(
-	  new Resource(dec, from.content, from.compressed_length,
-	               from.decompressed_length));
-    };
-}; // namespace res
-`[1:]
-
-var resourceImplTmp = `
-#include "lz4frame.h"
-
-#include "resource.hpp"
-
-namespace res {
-    namespace {
-	LZ4F_frameInfo_t _noFrame;
-
-	using bid = LZ4F_blockSizeID_t;
-	const size_t lookupBlkSize(bid szid) noexcept(true) {
-	    switch (szid) {
-	    case LZ4F_default:
-		return 2 << 21;
-	    case LZ4F_max64KB:
-		return 2 << 15;
-	    case LZ4F_max256KB:
-		return 2 << 17;
-	    case LZ4F_max1MB:
-		return 2 << 19;
-	    case LZ4F_max4MB:
-		return 2 << 21;
-	    default:
-		return 2 << 21;
-	    }
-	}
-    }; // namespace
-
-    const size_t Resource::Len() noexcept(true) {
-	return decompressed_content_length;
-    }
-
-    Resource::Resource(
-      LZ4F_dctx* decoder, const unsigned char* content,
-      size_t compressed_content_length,
-      size_t decompressed_content_length) noexcept(true)
-        : decoder(decoder), consumed(0), next_read_size(0),
-          compressed_content_length(compressed_content_length),
-          decompressed_content_length(decompressed_content_length),
-          content(content) {}
-
-    Resource::~Resource() noexcept(false) {
-	auto err = LZ4F_freeDecompressionContext(decoder);
-	if (LZ4F_isError(err)) {
-	    throw LZ4F_getErrorName(err);
-	}
-    }
-
-    const size_t Resource::BlockSize() noexcept(false) {
-	LZ4F_frameInfo_t frame = _noFrame;
-
-	// "more" is how much max will be parsed from buf as the header.
-	size_t more = LZ4F_HEADER_SIZE_MAX;
-
-	auto errOrNext = LZ4F_getFrameInfo(decoder, &frame,
-	                                   content + consumed, &more);
-	if (LZ4F_isError(errOrNext)) {
-	    throw LZ4F_getErrorName(errOrNext);
-	}
-
-	// "more" is now how much was read from buf.
-	consumed += more;
-
-	// "errOrNext" is the expected size of the next read.
-	next_read_size = errOrNext;
-
-	return lookupBlkSize(frame.blockSizeID);
-    }
-
-    const size_t Resource::Read(char*  into,
-                                size_t len) noexcept(false) {
-	size_t intoSize = len;
-	size_t more     = next_read_size;
-	size_t written  = 0;
-	bool   done     = false;
-
-	// Precalculate the size of the next read.
-	BlockSize();
-
-	while (!done && more > 0 && written < len) {
-	    // Consume the frame into the destination.
-	    auto errOrMore = LZ4F_decompress(
-	      decoder, into + written, &intoSize, content + consumed,
-	      &more, NULL);
-	    if (LZ4F_isError(errOrMore)) {
-		throw LZ4F_getErrorName(errOrMore);
-	    }
-	    if (errOrMore == 0) {
-		done = true;
-	    }
-
-	    // "intoSize" is now the amount actually decoded into
-	    // "into", so add it to the total written.
-	    written += intoSize;
-
-	    // Reset "intoSize" to the remaining target buffer for the
-	    // next call.
-	    intoSize = len - written;
-
-	    // After decoding the block, "more" is the count of bytes
-	    // consumed, in that call, from the internal compressed
-	    // buffer source.  Add this to the total internal offset.
-	    consumed += more;
-
-	    // errOrMore is the ideal next read size.
-	    more = next_read_size = errOrMore;
-	}
-
-	return written;
-    }
-
-    void Resource::Reset() noexcept(true) {
-	LZ4F_resetDecompressionContext(decoder);
-
-	consumed = next_read_size = 0;
-    }
-}; // namespace res
-`[1:]
-
-var resourceHdrTmp = `
-#ifndef PHX_RES
-#define PHX_RES
-
-#include "lz4frame.h"
-
-namespace res {
-    class Resource {
-    public:
-	// The default constructor is meaningless.  Every Resource must
-	// be created with a reference to a static array with an
-	// uncompressed length.
-	Resource() = delete;
-
-	// To construct a Resource, pass it an initialized LZ4F decoder
-	// context, an array containing LZ4 compressed bytes, and the
-	// size (in bytes) of the uncompressed resource.
-	//
-	// Most users should simply use Mapper::Fetch.
-	Resource(LZ4F_dctx*, const unsigned char*,
-	         size_t compressed_length,
-	         size_t decompressed_length) noexcept(true);
-	~Resource() noexcept(false);
-
-	// Len returns the full decompressed size of the asset.
-	const size_t Len() noexcept(true);
-
-	// BlockSize returns the maximum required size of a block which
-	// may be written to by a single partial Read.
-	const size_t BlockSize() noexcept(false);
-
-	// Read ingests up to len bytes into the target buffer.  For the
-	// best performance, the user should pass a buffer sized to the
-	// full size of the resource, given by Len(), or to the block
-	// size, given by BlockSize().  A smaller buffer may also be
-	// used.
-	//
-	// Reset() may be called to begin from the beginning.
-	const size_t Read(char* into, size_t len) noexcept(false);
-
-	// Reset returns the state of the Res to its initial state,
-	// ready to begin filling a new target buffer.
-	void Reset() noexcept(true);
-
-    private:
-	LZ4F_dctx* decoder;
-	size_t     consumed;
-	size_t     next_read_size;
-
-	const size_t         compressed_content_length;
-	const size_t         decompressed_content_length;
-	const unsigned char* content;
-    };
-}; // namespace res
-
-#endif
-`[1:]
-
 var cmakeTmp = `
-{{define "expand_real"}}  res/{{.VarName}}_real.cxx{{end}}`[1:] + `
-{{define "expand_both"}}    res/{{.VarName}}_decl.cxx
-    res/{{.VarName}}_real.cxx{{end}}`[1:] + `
-
 cmake_minimum_required(VERSION 3.1.0 FATAL_ERROR)
 
 if(POLICY CMP0076)
   cmake_policy(SET CMP0076 NEW)
 endif() # POLICY CMP0076
-
-# Add LZ4 and LZ4F definitions.
-add_subdirectory(lz4/lib)
-
-set_source_files_properties(
-{{range .}}{{template "expand_real" .}}
+{{with .CMake}}
+{{.}}{{end}}
+{{with .Resources.Included}}set_source_files_properties(
+{{range .}}  {{.}}
 {{end}}
   PROPERTIES
     GENERATED True
     HEADER_FILE_ONLY ON
 )
+{{end}}{{with .Resources.Assembled}}enable_language(ASM)
 
+set_source_files_properties(
+{{range .}}  {{.}}
+{{end}}
+  PROPERTIES
+    GENERATED True
+    COMPILE_FLAGS "-Wa,-I${CMAKE_CURRENT_LIST_DIR}"
+)
+{{end}}{{with .Resources.Objects}}set_source_files_properties(
+{{range .}}  {{.}}
+{{end}}
+  PROPERTIES
+    GENERATED True
+    EXTERNAL_OBJECT True
+)
+{{end}}
 # Add Resource library.
 add_library(Resource STATIC)
 
@@ -342,16 +227,15 @@ target_sources(Resource
     resource.hpp
     mapper.hpp
   PRIVATE
-{{range .}}{{template "expand_both" .}}
-{{end}}`[2:] + `
-)
+{{range .Resources}}{{range .Sources}}    {{.}}
+{{end}}{{end}})
 
 target_include_directories(Resource PUBLIC
   ${CMAKE_CURRENT_LIST_DIR}
 )
-
-target_link_libraries(Resource LZ4F)
-
+{{with .Library}}
+target_link_libraries(Resource {{.}})
+{{end}}
 set_property(TARGET Resource PROPERTY CXX_STANDARD 11)
 set_property(TARGET Resource PROPERTY CXX_STANDARD_REQUIRED ON)
 `[1:]
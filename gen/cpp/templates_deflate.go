@@ -0,0 +1,266 @@
+package cpp
+
+var deflateMapperImplTmp = `
+#include <cstring>
+#include <map>
+
+#include "id.hpp"
+#include "mapper.hpp"
+#include "resource.hpp"
+
+namespace res {
+    std::unique_ptr<Resource> Mapper::Fetch(ID id) noexcept(false) {
+	// This will never fail as long as every ID has a mapping.
+	auto from = mappings[id];
+
+	// Content which was stored uncompressed needs no decoder.
+	auto stored = std::strcmp(from.codec, "none") == 0;
+
+	return std::unique_ptr<Resource>(
+	  new Resource(from.content, from.compressed_length,
+	               from.decompressed_length, stored, from.chunks,
+	               from.chunk_length));
+    };
+}; // namespace res
+`[1:]
+
+var deflateResourceImplTmp = `
+#include <algorithm>
+#include <climits>
+#include <cstring>
+
+#include "zlib.h"
+
+#include "resource.hpp"
+
+namespace res {
+    namespace {
+	const size_t blockSize = 2 << 15;
+    }; // namespace
+
+    const size_t Resource::Len() noexcept(true) {
+	return decompressed_content_length;
+    }
+
+    Resource::Resource(const unsigned char*        content,
+                       size_t                      compressed_content_length,
+                       size_t                      decompressed_content_length,
+                       bool                        stored,
+                       const unsigned char* const* chunks,
+                       size_t chunk_length) noexcept(false)
+        : stored(stored), done(false), consumed(0),
+          compressed_content_length(compressed_content_length),
+          decompressed_content_length(decompressed_content_length),
+          content(content), chunks(chunks), chunk_length(chunk_length) {
+	std::memset(&stream, 0, sizeof(stream));
+	if (stored) {
+	    return;
+	}
+
+	// The input is given to inflate as Read needs it.
+	auto err = inflateInit(&stream);
+	if (err != Z_OK) {
+	    throw zError(err);
+	}
+    }
+
+    Resource::~Resource() noexcept(true) {
+	if (!stored) {
+	    inflateEnd(&stream);
+	}
+    }
+
+    const size_t Resource::BlockSize() noexcept(false) {
+	return blockSize;
+    }
+
+    const size_t Resource::Read(char*  into,
+                                size_t len) noexcept(false) {
+	if (stored) {
+	    return copy(into, len);
+	}
+
+	if (done) {
+	    return 0;
+	}
+
+	// zlib counts in uInt, so a very large buffer is only
+	// partially filled.
+	if (len > UINT_MAX) {
+	    len = UINT_MAX;
+	}
+
+	stream.next_out  = reinterpret_cast<Bytef*>(into);
+	stream.avail_out = static_cast<uInt>(len);
+
+	// inflate decodes until the buffer is full or the stream ends,
+	// given the input up to the end of each chunk in turn.
+	while (!done && stream.avail_out > 0) {
+	    if (stream.avail_in == 0) {
+		size_t avail;
+		auto   from = at(consumed, compressed_content_length, &avail);
+		if (avail == 0) {
+		    break;
+		}
+
+		avail           = std::min(avail, size_t(UINT_MAX));
+		stream.next_in  = const_cast<Bytef*>(from);
+		stream.avail_in = static_cast<uInt>(avail);
+		consumed += avail;
+	    }
+
+	    auto err = inflate(&stream, Z_NO_FLUSH);
+	    switch (err) {
+	    case Z_STREAM_END:
+		done = true;
+		break;
+	    case Z_OK:
+	    case Z_BUF_ERROR:
+		// Z_BUF_ERROR only means no progress was possible
+		// until there is more input.
+		break;
+	    default:
+		throw stream.msg != NULL ? stream.msg : zError(err);
+	    }
+	}
+
+	return len - stream.avail_out;
+    }
+
+    void Resource::Reset() noexcept(true) {
+	consumed = 0;
+	if (stored) {
+	    return;
+	}
+
+	inflateReset(&stream);
+
+	stream.next_in  = Z_NULL;
+	stream.avail_in = 0;
+	done            = false;
+    }
+
+    const size_t Resource::copy(char* into, size_t len) noexcept(true) {
+	size_t n = 0;
+	while (n < len) {
+	    // Copy up to the end of the chunk.
+	    size_t avail;
+	    auto   from = at(consumed, decompressed_content_length, &avail);
+	    if (avail == 0) {
+		break;
+	    }
+
+	    avail = std::min(avail, len - n);
+	    std::memcpy(into + n, from, avail);
+	    consumed += avail;
+	    n += avail;
+	}
+
+	return n;
+    }
+
+    const unsigned char* Resource::at(size_t offset, size_t length,
+                                      size_t* avail) const
+      noexcept(true) {
+	if (offset >= length) {
+	    *avail = 0;
+	    return nullptr;
+	}
+	if (chunks == nullptr) {
+	    *avail = length - offset;
+	    return content + offset;
+	}
+
+	auto in = offset % chunk_length;
+	*avail  = std::min(chunk_length - in, length - offset);
+	return chunks[offset / chunk_length] + in;
+    }
+}; // namespace res
+`[1:]
+
+var deflateResourceHdrTmp = `
+#ifndef PHX_RES
+#define PHX_RES
+
+#include "zlib.h"
+
+namespace res {
+    class Resource {
+    public:
+	// The default constructor is meaningless.  Every Resource must
+	// be created with a reference to a static array with an
+	// uncompressed length.
+	Resource() = delete;
+
+	// A Resource owns its decoder state, so it may not be copied.
+	Resource(const Resource&) = delete;
+	Resource& operator=(const Resource&) = delete;
+
+	// To construct a Resource, pass it an array containing zlib
+	// compressed bytes, its size, and the size (in bytes) of the
+	// uncompressed resource.  If stored is true, the array contains
+	// the uncompressed bytes.  If the bytes are split into chunks,
+	// chunks points to an array of them, each chunk_length bytes
+	// long except the last.
+	//
+	// Most users should simply use Mapper::Fetch.
+	Resource(const unsigned char*, size_t compressed_length,
+	         size_t                      decompressed_length,
+	         bool                        stored       = false,
+	         const unsigned char* const* chunks       = nullptr,
+	         size_t                      chunk_length = 0) noexcept(false);
+	~Resource() noexcept(true);
+
+	// Len returns the full decompressed size of the asset.
+	const size_t Len() noexcept(true);
+
+	// BlockSize returns a suggested size for the buffer passed to
+	// Read.  Any size may be used.
+	const size_t BlockSize() noexcept(false);
+
+	// Read ingests up to len bytes into the target buffer, and
+	// returns the number of bytes written.  For the best
+	// performance, the user should pass a buffer sized to the full
+	// size of the resource, given by Len().  Once the resource has
+	// been fully read, Read returns 0.
+	//
+	// Reset() may be called to begin from the beginning.
+	const size_t Read(char* into, size_t len) noexcept(false);
+
+	// Reset returns the state of the Res to its initial state,
+	// ready to begin filling a new target buffer.
+	void Reset() noexcept(true);
+
+    private:
+	// copy copies stored content, as Read does.
+	const size_t copy(char* into, size_t len) noexcept(true);
+
+	// at returns the content at the given offset of the given
+	// length of content, and sets avail to the number of bytes
+	// after it in the same chunk.
+	const unsigned char* at(size_t offset, size_t length,
+	                        size_t* avail) const noexcept(true);
+
+	z_stream stream;
+	bool     stored;
+	bool     done;
+
+	// consumed is the number of bytes of content which have been
+	// copied, or given to inflate.
+	size_t consumed;
+
+	const size_t                compressed_content_length;
+	const size_t                decompressed_content_length;
+	const unsigned char*        content;
+	const unsigned char* const* chunks;
+	const size_t                chunk_length;
+    };
+}; // namespace res
+
+#endif
+`[1:]
+
+var deflateCMakeTmp = `
+# Find zlib.
+find_package(ZLIB REQUIRED)
+`[1:]
@@ -0,0 +1,317 @@
+package cpp
+
+var lz4MapperImplTmp = `
+#include <cstring>
+#include <map>
+
+#include "lz4frame.h"
+
+#include "id.hpp"
+#include "mapper.hpp"
+#include "resource.hpp"
+
+namespace res {
+    std::unique_ptr<Resource> Mapper::Fetch(ID id) noexcept(false) {
+	// This will never fail as long as every ID has a mapping.
+	auto from = mappings[id];
+
+	// Content which was stored uncompressed needs no decoder.
+	if (std::strcmp(from.codec, "none") == 0) {
+	    return std::unique_ptr<Resource>(
+	      new Resource(nullptr, from.content, from.decompressed_length,
+	                   from.decompressed_length, from.chunks,
+	                   from.chunk_length));
+	}
+
+	LZ4F_dctx* dec;
+	auto       lz4v = LZ4F_getVersion();
+	auto       err  = LZ4F_createDecompressionContext(&dec, lz4v);
+
+	if (LZ4F_isError(err)) {
+	    throw LZ4F_getErrorName(err);
+	}
+
+	return std::unique_ptr<Resource>(
+	  new Resource(dec, from.content, from.compressed_length,
+	               from.decompressed_length, from.chunks,
+	               from.chunk_length));
+    };
+}; // namespace res
+`[1:]
+
+var lz4ResourceImplTmp = `
+#include <algorithm>
+#include <cstring>
+
+#include "lz4frame.h"
+
+#include "resource.hpp"
+
+namespace res {
+    namespace {
+	LZ4F_frameInfo_t _noFrame;
+
+	using bid = LZ4F_blockSizeID_t;
+	const size_t lookupBlkSize(bid szid) noexcept(true) {
+	    switch (szid) {
+	    case LZ4F_default:
+		return 2 << 21;
+	    case LZ4F_max64KB:
+		return 2 << 15;
+	    case LZ4F_max256KB:
+		return 2 << 17;
+	    case LZ4F_max1MB:
+		return 2 << 19;
+	    case LZ4F_max4MB:
+		return 2 << 21;
+	    default:
+		return 2 << 21;
+	    }
+	}
+    }; // namespace
+
+    const size_t Resource::Len() noexcept(true) {
+	return decompressed_content_length;
+    }
+
+    Resource::Resource(
+      LZ4F_dctx* decoder, const unsigned char* content,
+      size_t compressed_content_length,
+      size_t decompressed_content_length,
+      const unsigned char* const* chunks,
+      size_t                      chunk_length) noexcept(true)
+        : decoder(decoder), consumed(0), next_read_size(0),
+          compressed_content_length(compressed_content_length),
+          decompressed_content_length(decompressed_content_length),
+          content(content), chunks(chunks), chunk_length(chunk_length) {}
+
+    Resource::~Resource() noexcept(false) {
+	if (decoder == nullptr) {
+	    return;
+	}
+
+	auto err = LZ4F_freeDecompressionContext(decoder);
+	if (LZ4F_isError(err)) {
+	    throw LZ4F_getErrorName(err);
+	}
+    }
+
+    const size_t Resource::BlockSize() noexcept(false) {
+	if (decoder == nullptr) {
+	    return decompressed_content_length;
+	}
+
+	// "more" is how much max will be parsed from buf as the header.
+	// The header is always in the first chunk.
+	size_t more;
+	auto   from = at(consumed, compressed_content_length, &more);
+	if (more == 0) {
+	    // The content has been fully read.
+	    next_read_size = 0;
+	    return lookupBlkSize(LZ4F_default);
+	}
+	more = std::min(more, size_t(LZ4F_HEADER_SIZE_MAX));
+
+	LZ4F_frameInfo_t frame = _noFrame;
+
+	auto errOrNext = LZ4F_getFrameInfo(decoder, &frame, from, &more);
+	if (LZ4F_isError(errOrNext)) {
+	    throw LZ4F_getErrorName(errOrNext);
+	}
+
+	// "more" is now how much was read from buf.
+	consumed += more;
+
+	// "errOrNext" is the expected size of the next read.
+	next_read_size = errOrNext;
+
+	return lookupBlkSize(frame.blockSizeID);
+    }
+
+    const size_t Resource::Read(char*  into,
+                                size_t len) noexcept(false) {
+	if (decoder == nullptr) {
+	    // The content is stored uncompressed.
+	    return copy(into, len);
+	}
+
+	size_t intoSize = len;
+	size_t more     = next_read_size;
+	size_t written  = 0;
+	bool   done     = false;
+
+	// Precalculate the size of the next read.
+	BlockSize();
+
+	while (!done && more > 0 && written < len) {
+	    // Consume the frame into the destination, up to the end
+	    // of the chunk.
+	    size_t avail;
+	    auto   from = at(consumed, compressed_content_length, &avail);
+	    if (avail == 0) {
+		break;
+	    }
+	    more = std::min(more, avail);
+
+	    auto errOrMore = LZ4F_decompress(decoder, into + written,
+	                                     &intoSize, from, &more, NULL);
+	    if (LZ4F_isError(errOrMore)) {
+		throw LZ4F_getErrorName(errOrMore);
+	    }
+	    if (errOrMore == 0) {
+		done = true;
+	    }
+
+	    // "intoSize" is now the amount actually decoded into
+	    // "into", so add it to the total written.
+	    written += intoSize;
+
+	    // Reset "intoSize" to the remaining target buffer for the
+	    // next call.
+	    intoSize = len - written;
+
+	    // After decoding the block, "more" is the count of bytes
+	    // consumed, in that call, from the internal compressed
+	    // buffer source.  Add this to the total internal offset.
+	    consumed += more;
+
+	    // errOrMore is the ideal next read size.
+	    more = next_read_size = errOrMore;
+	}
+
+	return written;
+    }
+
+    void Resource::Reset() noexcept(true) {
+	if (decoder != nullptr) {
+	    LZ4F_resetDecompressionContext(decoder);
+	}
+
+	consumed = next_read_size = 0;
+    }
+
+    const size_t Resource::copy(char* into, size_t len) noexcept(true) {
+	size_t n = 0;
+	while (n < len) {
+	    // Copy up to the end of the chunk.
+	    size_t avail;
+	    auto   from = at(consumed, decompressed_content_length, &avail);
+	    if (avail == 0) {
+		break;
+	    }
+
+	    avail = std::min(avail, len - n);
+	    std::memcpy(into + n, from, avail);
+	    consumed += avail;
+	    n += avail;
+	}
+
+	return n;
+    }
+
+    const unsigned char* Resource::at(size_t offset, size_t length,
+                                      size_t* avail) const
+      noexcept(true) {
+	if (offset >= length) {
+	    *avail = 0;
+	    return nullptr;
+	}
+	if (chunks == nullptr) {
+	    *avail = length - offset;
+	    return content + offset;
+	}
+
+	auto in = offset % chunk_length;
+	*avail  = std::min(chunk_length - in, length - offset);
+	return chunks[offset / chunk_length] + in;
+    }
+}; // namespace res
+`[1:]
+
+var lz4ResourceHdrTmp = `
+#ifndef PHX_RES
+#define PHX_RES
+
+#include "lz4frame.h"
+
+namespace res {
+    class Resource {
+    public:
+	// The default constructor is meaningless.  Every Resource must
+	// be created with a reference to a static array with an
+	// uncompressed length.
+	Resource() = delete;
+
+	// To construct a Resource, pass it an initialized LZ4F decoder
+	// context, an array containing LZ4 compressed bytes, and the
+	// size (in bytes) of the uncompressed resource.  If the decoder
+	// is null, the array contains the uncompressed bytes.  If the
+	// bytes are split into chunks, chunks points to an array of
+	// them, each chunk_length bytes long except the last.
+	//
+	// Most users should simply use Mapper::Fetch.
+	Resource(LZ4F_dctx*, const unsigned char*,
+	         size_t                      compressed_length,
+	         size_t                      decompressed_length,
+	         const unsigned char* const* chunks       = nullptr,
+	         size_t                      chunk_length = 0) noexcept(true);
+	~Resource() noexcept(false);
+
+	// Len returns the full decompressed size of the asset.
+	const size_t Len() noexcept(true);
+
+	// BlockSize returns the maximum required size of a block which
+	// may be written to by a single partial Read.
+	const size_t BlockSize() noexcept(false);
+
+	// Read ingests up to len bytes into the target buffer.  For the
+	// best performance, the user should pass a buffer sized to the
+	// full size of the resource, given by Len(), or to the block
+	// size, given by BlockSize().  A smaller buffer may also be
+	// used.
+	//
+	// Reset() may be called to begin from the beginning.
+	const size_t Read(char* into, size_t len) noexcept(false);
+
+	// Reset returns the state of the Res to its initial state,
+	// ready to begin filling a new target buffer.
+	void Reset() noexcept(true);
+
+    private:
+	// copy copies stored content, as Read does.
+	const size_t copy(char* into, size_t len) noexcept(true);
+
+	// at returns the content at the given offset of the given
+	// length of content, and sets avail to the number of bytes
+	// after it in the same chunk.
+	const unsigned char* at(size_t offset, size_t length,
+	                        size_t* avail) const noexcept(true);
+
+	LZ4F_dctx* decoder;
+	size_t     consumed;
+	size_t     next_read_size;
+
+	const size_t                compressed_content_length;
+	const size_t                decompressed_content_length;
+	const unsigned char*        content;
+	const unsigned char* const* chunks;
+	const size_t                chunk_length;
+    };
+}; // namespace res
+
+#endif
+`[1:]
+
+var lz4CMakeTmp = `
+# Build LZ4 and LZ4F from the sources of the LZ4 library in lz4, unless
+# the project defines LZ4F itself.
+if(NOT TARGET LZ4F)
+  add_library(LZ4F STATIC
+    lz4/lib/lz4.c
+    lz4/lib/lz4frame.c
+    lz4/lib/lz4hc.c
+    lz4/lib/xxhash.c
+  )
+  target_include_directories(LZ4F PUBLIC ${CMAKE_CURRENT_LIST_DIR}/lz4/lib)
+endif()
+`[1:]
@@ -0,0 +1,143 @@
+package cpp
+
+var noneMapperImplTmp = `
+#include <map>
+
+#include "id.hpp"
+#include "mapper.hpp"
+#include "resource.hpp"
+
+namespace res {
+    std::unique_ptr<Resource> Mapper::Fetch(ID id) noexcept(false) {
+	// This will never fail as long as every ID has a mapping.
+	auto from = mappings[id];
+
+	return std::unique_ptr<Resource>(
+	  new Resource(from.content, from.decompressed_length, from.chunks,
+	               from.chunk_length));
+    };
+}; // namespace res
+`[1:]
+
+var noneResourceImplTmp = `
+#include <algorithm>
+#include <cstring>
+
+#include "resource.hpp"
+
+namespace res {
+    const size_t Resource::Len() noexcept(true) {
+	return content_length;
+    }
+
+    Resource::Resource(const unsigned char*        content,
+                       size_t                      content_length,
+                       const unsigned char* const* chunks,
+                       size_t chunk_length) noexcept(true)
+        : consumed(0), content_length(content_length),
+          content(content), chunks(chunks),
+          chunk_length(chunk_length) {}
+
+    const size_t Resource::BlockSize() noexcept(false) {
+	return content_length;
+    }
+
+    const size_t Resource::Read(char*  into,
+                                size_t len) noexcept(false) {
+	size_t n = 0;
+	while (n < len) {
+	    // Copy up to the end of the chunk.
+	    size_t avail;
+	    auto   from = at(consumed, &avail);
+	    if (avail == 0) {
+		break;
+	    }
+
+	    avail = std::min(avail, len - n);
+	    std::memcpy(into + n, from, avail);
+	    consumed += avail;
+	    n += avail;
+	}
+
+	return n;
+    }
+
+    void Resource::Reset() noexcept(true) { consumed = 0; }
+
+    const unsigned char* Resource::at(size_t  offset,
+                                      size_t* avail) const
+      noexcept(true) {
+	if (offset >= content_length) {
+	    *avail = 0;
+	    return nullptr;
+	}
+	if (chunks == nullptr) {
+	    *avail = content_length - offset;
+	    return content + offset;
+	}
+
+	auto in = offset % chunk_length;
+	*avail  = std::min(chunk_length - in, content_length - offset);
+	return chunks[offset / chunk_length] + in;
+    }
+}; // namespace res
+`[1:]
+
+var noneResourceHdrTmp = `
+#ifndef PHX_RES
+#define PHX_RES
+
+#include <cstddef>
+
+namespace res {
+    class Resource {
+    public:
+	// The default constructor is meaningless.  Every Resource must
+	// be created with a reference to a static array with a length.
+	Resource() = delete;
+
+	// To construct a Resource, pass it an array containing the
+	// uncompressed bytes, and its size (in bytes).  If the bytes
+	// are split into chunks, chunks points to an array of them,
+	// each chunk_length bytes long except the last.
+	//
+	// Most users should simply use Mapper::Fetch.
+	Resource(const unsigned char*, size_t length,
+	         const unsigned char* const* chunks       = nullptr,
+	         size_t                      chunk_length = 0) noexcept(true);
+
+	// Len returns the full size of the asset.
+	const size_t Len() noexcept(true);
+
+	// BlockSize returns a suggested size for the buffer passed to
+	// Read.  Any size may be used.
+	const size_t BlockSize() noexcept(false);
+
+	// Read copies up to len bytes into the target buffer, and
+	// returns the number of bytes copied.  Once the resource has
+	// been fully read, Read returns 0.
+	//
+	// Reset() may be called to begin from the beginning.
+	const size_t Read(char* into, size_t len) noexcept(false);
+
+	// Reset returns the state of the Res to its initial state,
+	// ready to begin filling a new target buffer.
+	void Reset() noexcept(true);
+
+    private:
+	// at returns the content at the given offset, and sets avail to
+	// the number of bytes after it in the same chunk.
+	const unsigned char* at(size_t offset, size_t* avail) const
+	  noexcept(true);
+
+	size_t consumed;
+
+	const size_t                content_length;
+	const unsigned char*        content;
+	const unsigned char* const* chunks;
+	const size_t                chunk_length;
+    };
+}; // namespace res
+
+#endif
+`[1:]
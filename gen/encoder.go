@@ -2,9 +2,142 @@ package gen
 
 import (
 	"io"
+
+	"github.com/phoenix-engine/phx/fs"
+	"github.com/phoenix-engine/phx/gen/compress"
+	"github.com/phoenix-engine/phx/gen/cpp"
+	"github.com/phoenix-engine/phx/gen/pack"
+
+	"github.com/pkg/errors"
+)
+
+// Kinds of Encoder which a Gen can create its output with.
+const (
+	// KindCpp compiles each resource into a C++ array.
+	KindCpp = "cpp"
+
+	// KindIncbin is KindCpp, but the content of each resource is a
+	// raw binary file included by assembly, as in cpp.EmbedIncbin.
+	KindIncbin = "incbin"
+
+	// KindELF is KindCpp, but the content of each resource is
+	// written directly into an ELF object file for Gen.Arch, as in
+	// cpp.EmbedELF.
+	KindELF = "elf"
+
+	// KindPack writes all resources into a single pack file, which
+	// is loaded at runtime.
+	KindPack = "pack"
 )
 
+// encoder returns an Encoder of the Gen's Kind over the FS, which
+// disambiguates the names of resources by the given IDs.  The empty
+// kind is KindCpp.
+func (g Gen) encoder(over fs.FS, ids map[string]int) (Encoder, error) {
+	enc, err := cpp.ParseEncoding(g.Encoding)
+	if err != nil {
+		return nil, err
+	}
+
+	kind := g.Kind
+	if enc != cpp.EncodingHex && kind != "" && kind != KindCpp {
+		return nil, errors.Errorf("encoding %s does not apply to kind %q",
+			enc, kind)
+	}
+
+	if err := g.Format.Validate(); err != nil {
+		return nil, errors.Wrap(err, "format")
+	}
+	if err := g.Naming.Validate(); err != nil {
+		return nil, errors.Wrap(err, "naming")
+	}
+
+	var tmps cpp.Templates
+	if g.Templates != nil {
+		if kind == KindPack {
+			return nil, errors.Errorf("templates do not apply to kind %q",
+				kind)
+		}
+		if tmps, err = cpp.LoadTemplates(g.Templates); err != nil {
+			return nil, errors.Wrap(err, "loading templates")
+		}
+	}
+
+	switch {
+	case g.ChunkSize == 0:
+	case kind != "" && kind != KindCpp:
+		return nil, errors.Errorf("chunk size does not apply to kind %q",
+			kind)
+	case g.ChunkSize < cpp.MinChunkSize:
+		return nil, errors.Errorf("chunk size %d is less than %d",
+			g.ChunkSize, cpp.MinChunkSize)
+	}
+
+	switch kind {
+	case "", KindCpp:
+		t := cpp.PrepareTarget(over)
+		t.Encoding, t.Format, t.ChunkSize = enc, g.Format, g.ChunkSize
+		t.Naming, t.Templates, t.IDs = g.Naming, tmps, ids
+		return t, nil
+	case KindIncbin:
+		t := cpp.PrepareTarget(over)
+		t.Embed, t.Format, t.IDs = cpp.EmbedIncbin, g.Format, ids
+		t.Naming, t.Templates = g.Naming, tmps
+		return t, nil
+	case KindELF:
+		m, err := cpp.MachineFor(g.Arch)
+		if err != nil {
+			return nil, err
+		}
+		t := cpp.PrepareTarget(over)
+		t.Embed, t.Machine, t.Format = cpp.EmbedELF, m, g.Format
+		t.Naming, t.Templates, t.IDs = g.Naming, tmps, ids
+		return t, nil
+	case KindPack:
+		// The pack is only written by Finalize.
+		if g.SkipFinalize {
+			return nil, errors.Errorf("skipping finalize does not "+
+				"apply to kind %q", kind)
+		}
+		t := pack.PrepareTarget(over)
+		t.Format, t.Naming, t.IDs = g.Format, g.Naming, ids
+		t.Prev = g.To
+		return t, nil
+	default:
+		return nil, errors.Errorf("unknown kind %q", kind)
+	}
+}
+
+// names returns the Names which the resources of the Gen's Kind must
+// follow.  The resources of KindPack only name an ID.
+func (g Gen) names() cpp.Names {
+	if g.Kind == KindPack {
+		return cpp.Names{Naming: g.Naming}
+	}
+	return cpp.Names{
+		Members: true,
+		Chunked: g.ChunkSize > 0,
+		Naming:  g.Naming,
+	}
+}
+
+// Encoder creates the output for each resource, compressing it with
+// Compressors from the given Maker, and then finalizes the output once
+// all resources are created.  A resource may be created again once its
+// writer is closed, which replaces its output.
 type Encoder interface {
-	Create(name string) (io.WriteCloser, error)
+	Create(name string, using compress.Maker) (io.WriteCloser, error)
 	Finalize() error
 }
+
+// Reuser is an Encoder which can keep its output from a previous run
+// for a resource which has not changed, instead of encoding it again.
+type Reuser interface {
+	// Outputs returns the paths of the files the Encoder creates
+	// for the named resource, stored with the given codec and sizes.
+	Outputs(name, codec string, size, compressedSize int64) []string
+
+	// Reuse registers the named resource as unchanged, with the
+	// codec and sizes recorded when it was last encoded.
+	Reuse(name, codec string, size, compressedSize int64)
+}
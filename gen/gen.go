@@ -14,56 +14,206 @@ import (
 	"github.com/pkg/errors"
 )
 
-// Gen uses Operate to process files in the FS given as From, and copies
-// its output to To after processing is completed successfully.  It only
-// operates on names matched by the Matcher.  It uses a temporary buffer
-// for staging before completion.
+// DefaultMaxRatio is the MaxRatio used by "phx gen".  Resources which
+// compression doesn't make smaller are stored uncompressed.
+const DefaultMaxRatio = 1.0
+
+// Source is a set of files to be processed by a Gen.  The From tree is
+// walked recursively, and only files whose slash-separated path relative
+// to From is matched by the Matcher are included.  They are compressed
+// using the Maker.
+type Source struct {
+	From fs.FS
+	path.Matcher
+	compress.Maker
+
+	// MaxRatio, if positive, is the ratio of compressed to
+	// uncompressed size which compression must get under for a
+	// resource to be stored compressed.  Otherwise, such as for
+	// already-compressed images, the resource is stored uncompressed
+	// so it costs nothing to decode.
+	MaxRatio float64
+}
+
+// Gen uses Operate to process the files of each of its Sources, and
+// copies its output to To after processing is completed successfully.
+// It stages its output in memory before completion, or in a temporary
+// directory if the resources are very large.  If To is an fs.Real, a
+// failure to commit the output leaves it as it was, and so does a crash,
+// once the next Gen with the same To runs.  Its contents are not
+// replaced atomically, though, so they may be seen half-updated while
+// the output is committed.
 type Gen struct {
-	From, To fs.FS
-	compress.Level
+	Sources []Source
+	To      fs.FS
+
+	// Kind selects the Encoder of the output, such as KindPack.  If
+	// it is empty, KindCpp is used.
+	Kind string
+
+	// Arch is the architecture of the object files of KindELF, such
+	// as "x86-64" or "aarch64".  If it is empty, the architecture
+	// phx was built for is used.
+	Arch string
+
+	// Encoding is the name of the cpp.Encoding of the arrays of
+	// KindCpp, such as "string".  If it is empty, "hex" is used.
+	Encoding string
+
+	// Format is the formatting profile of the generated source.
+	Format cpp.Format
+
+	// Naming selects the identifiers and namespaces of the resources
+	// in the generated C++ API.
+	Naming cpp.Naming
+
+	// Templates, if set, holds templates which override the built-in
+	// templates of the C++ kinds, as in cpp.LoadTemplates.
+	Templates fs.FS
+
+	// ChunkSize, if positive, splits the array of each resource of
+	// KindCpp into arrays of ChunkSize bytes, as in cpp.Target.
+	ChunkSize int64
+
+	// Disambiguate gives resources whose C++ variable names collide,
+	// or are not valid, names with a suffix which is derived from
+	// their path, as in cpp.Names.Disambiguate.  Otherwise, they are
+	// reported as errors.
+	Disambiguate bool
 
+	// SkipFinalize leaves the Encoder's output unfinalized, with only
+	// the outputs of each resource, such as without the Mapper of
+	// KindCpp.  It does not apply to KindPack.
 	SkipFinalize bool
 
-	path.Matcher
+	// StageOnDisk forces the output to be staged in a temporary
+	// directory.  Otherwise, a temporary directory is only used if
+	// the total size of the resources exceeds StageThreshold, or
+	// DefaultStageThreshold if it is zero.
+	StageOnDisk    bool
+	StageThreshold int64
+
+	// Force causes every resource to be processed, even if the
+	// manifest in To shows it is unchanged.
+	Force bool
+
+	// NoPrune keeps files in To which were generated by a previous
+	// run, but which are no longer generated, such as the outputs of
+	// removed resources.  Otherwise, they are removed.
+	NoPrune bool
+
 	// TODO: Verbosity
 }
 
-// Operate processes files as in the description of the type.
-func (g Gen) Operate() error {
-	// TODO: Describe pipelines with a graph file.
-	// TODO: Generate and check resource manifest for changes.
-	prefis, err := g.From.ReadDir("")
+// Operate processes files as in the description of the type.  It holds
+// an exclusive lock on To while it runs, so concurrent Gens with the
+// same output don't interleave.
+func (g Gen) Operate() (err error) {
+	// Each codec needs a C++ runtime to decode it.
+	for _, src := range g.Sources {
+		if _, err := cpp.RuntimeFor(src.Maker.Name()); err != nil {
+			return err
+		}
+	}
+
+	unlock, err := g.lock()
 	if err != nil {
-		return errors.Wrapf(err, "reading %s", g.From)
+		return errors.Wrap(err, "locking output")
+	}
+	defer func() {
+		if uerr := unlock(); err == nil {
+			err = uerr
+		}
+	}()
+
+	if err := g.restore(); err != nil {
+		return errors.Wrap(err, "recovering output")
 	}
 
-	var fis []os.FileInfo
-	for _, fi := range prefis {
-		if g.Match(fi.Name()) {
-			fis = append(fis, fi)
+	var (
+		jobs   []Job
+		byName = make(map[string]Job)
+		names  []string
+		total  int64
+	)
+
+	for _, src := range g.Sources {
+		all, err := fs.Files(src.From, "")
+		if err != nil {
+			return errors.Wrapf(err, "reading %s", src.From)
+		}
+
+		for _, name := range all {
+			if !src.Match(name) {
+				continue
+			}
+
+			if _, ok := byName[name]; ok {
+				return errors.Errorf("resource %s is in more than one source", name)
+			}
+
+			fi, err := src.From.Lstat(name)
+			if err != nil {
+				return errors.Wrapf(err, "checking %s", name)
+			}
+			total += fi.Size()
+
+			j := Job{Name: name, Source: src}
+			jobs = append(jobs, j)
+			byName[name] = j
+			names = append(names, name)
 		}
 	}
 
+	// Resources in different directories must not map to the same
+	// C++ variable name, unless they are disambiguated.
+	var ids map[string]int
+	if g.Disambiguate {
+		ids = g.names().Disambiguate(names)
+	}
+	if err := g.names().Check(names, ids); err != nil {
+		return errors.Wrap(err, "checking resource names")
+	}
+
 	// In workers, open each file, zip and translate it into a
 	// static array, and close it.  When each is done, it should be
 	// in the tmp destination.  After they're all done, move them
 	// all into the target destination.
 
-	var (
-		jobs, dones, kill, errs = MakeChans()
+	tmpFS, cleanup, err := g.stage(total)
+	if err != nil {
+		return errors.Wrap(err, "preparing staging area")
+	}
+	defer func() {
+		if cerr := cleanup(); err == nil {
+			err = errors.Wrap(cerr, "cleaning up staging area")
+		}
+	}()
 
-		tmpFS   = fs.MakeSyncMem()
-		maker   = compress.LZ4Maker{Level: g.Level}
-		encoder = cpp.PrepareTarget(tmpFS, maker)
-	)
+	encoder, err := g.encoder(tmpFS, ids)
+	if err != nil {
+		return err
+	}
+
+	jobc, dones, kill, errs := MakeChans()
+
+	// Check the manifest from the last run for resources which have
+	// not changed since then.  Their output is kept as it is.
+	old, err := ReadManifest(g.To)
+	if err != nil {
+		return errors.Wrap(err, "reading manifest")
+	}
+
+	entries, changed, err := g.checkManifest(old, jobs, encoder)
+	if err != nil {
+		return errors.Wrap(err, "checking manifest")
+	}
 
 	for i := 0; i < runtime.NumCPU(); i++ {
-		// TODO: Use real tmpdir for very large resources.
 		// TODO: Figure out how to manage large / complicated
 		// deps, such as git repos
 		go Work{
-			from:    g.From,
-			Jobs:    jobs,
+			Jobs:    jobc,
 			Done:    dones,
 			Kill:    kill,
 			Errs:    errs,
@@ -72,19 +222,25 @@ func (g Gen) Operate() error {
 	}
 
 	go func() {
-		for _, fi := range fis {
-			// TODO: Check for nested resource dirs.
-			// if fi.IsDir() { ... }
-			jobs <- Job{Name: fi.Name()}
+		for _, j := range changed {
+			jobc <- j
 		}
 
-		close(jobs)
+		close(jobc)
 	}()
 
+	none := compress.NoMaker{}.Name()
 	tw := new(tabwriter.Writer)
 	tw.Init(os.Stdout, 0, 8, 0, '\t', 0)
 
-	for i := 0; i < len(fis); i++ {
+	for _, j := range jobs {
+		if e := entries[j.Name]; !e.changed {
+			fmt.Fprintf(tw, "%s:\t%s\tunchanged\n",
+				j.Name, e.StoredCodec())
+		}
+	}
+
+	for i := 0; i < len(changed); i++ {
 		select {
 		case err := <-errs:
 			close(kill)
@@ -92,14 +248,26 @@ func (g Gen) Operate() error {
 
 		case d := <-dones:
 			sizeStr := renderSize(d.Size)
-			if cs := d.CompressedSize; cs != 0 {
+			if cs := d.CompressedSize; cs != 0 && d.Codec != none {
 				sizeStr += fmt.Sprintf(
 					" / %s compressed (%.2f%%)",
 					renderSize(cs),
 					100*(1-(float64(cs)/float64(d.Size))),
 				)
 			}
-			fmt.Fprintf(tw, "%s:\t%s\n", d.Name, sizeStr)
+			fmt.Fprintf(tw, "%s:\t%s\t%s\n", d.Name, d.Codec, sizeStr)
+
+			e := entries[d.Name]
+			e.CompressedSize = d.CompressedSize
+			if d.Codec != e.Codec {
+				e.Stored = d.Codec
+			}
+			if r, ok := encoder.(Reuser); ok {
+				// The outputs may depend on the sizes.
+				e.Outputs = r.Outputs(d.Name, d.Codec,
+					d.Size, d.CompressedSize)
+			}
+			entries[d.Name] = e
 		}
 	}
 
@@ -115,23 +283,165 @@ func (g Gen) Operate() error {
 	// All finished tmpfiles are now in the tmp destination and
 	// shall be moved over to the target.
 
-	tmpFis, err := tmpFS.ReadDir("")
+	staged, err := fs.Files(tmpFS, "")
 	if err != nil {
-		return errors.Wrap(err, "reading tempdir")
+		return errors.Wrap(err, "reading staging area")
 	}
 
-	// TODO: Make this concurrent.
-	for _, fi := range tmpFis {
-		name := fi.Name()
-		if err := fs.Move(tmpFS, g.To, name, name); err != nil {
-			return errors.Wrapf(err, "finalizing %s", name)
+	var (
+		encoded = make(map[string]bool)
+		owned   = append([]string(nil), staged...)
+	)
+	for _, j := range jobs {
+		e := entries[j.Name]
+		for _, out := range e.Outputs {
+			if e.changed {
+				encoded[out] = true
+			} else {
+				owned = append(owned, out)
+			}
 		}
 	}
+	if g.SkipFinalize {
+		// The Encoder's finalized output from the last run is
+		// still owned, even though it wasn't generated again.
+		owned = append(owned, old.finalized()...)
+	}
+
+	// Record what was generated, so the next run can skip it, and
+	// knows which files it owns.
+	m := Manifest{Version: Version, Files: owned}
+	for _, j := range jobs {
+		m.Resources = append(m.Resources, entries[j.Name].ManifestEntry)
+	}
+
+	// Files from the last run which are no longer generated are
+	// removed, unless pruning is disabled.  Then they are still
+	// owned, so a later run can remove them.
+	stale := old.Stale(m)
+	if g.NoPrune {
+		m.Files, stale = append(m.Files, stale...), nil
+	}
+
+	if err := WriteManifest(tmpFS, m); err != nil {
+		return errors.Wrap(err, "writing manifest")
+	}
+	staged = append(staged, ManifestName)
+
+	if err := g.commit(tmpFS, staged, encoded, stale); err != nil {
+		return err
+	}
+
+	for _, name := range stale {
+		fmt.Printf("removed %s\n", name)
+	}
 
-	// TODO: If we used a real tmpdir, remove it now.
 	return nil
 }
 
+type entry struct {
+	ManifestEntry
+	changed bool
+}
+
+// checkManifest hashes the file of each Job and compares it against
+// the old manifest from g.To.  Unchanged resources whose outputs are
+// all still present are passed to the Encoder's Reuse, if it is a
+// Reuser.  The new entries are returned by name, along with the Jobs
+// which must be processed.
+func (g Gen) checkManifest(
+	old Manifest,
+	jobs []Job,
+	encoder Encoder,
+) (map[string]entry, []Job, error) {
+	var (
+		prev    = old.Lookup()
+		entries = make(map[string]entry)
+		changed []Job
+
+		reuser, canReuse = encoder.(Reuser)
+
+		// Only the Arch of KindELF, and the Encoding and
+		// ChunkSize of KindCpp, change the output.
+		kind, arch, enc = g.Kind, "", ""
+		chunkSize       int64
+
+		// The output also depends on any templates overriding
+		// the built-in ones.
+		tmps string
+	)
+	if t, ok := encoder.(cpp.Target); ok {
+		tmps = t.Templates.Sum()
+	}
+	switch kind {
+	case "", KindCpp:
+		kind, chunkSize = KindCpp, g.ChunkSize
+		if g.Encoding != cpp.EncodingHex.String() {
+			enc = g.Encoding
+		}
+	case KindELF:
+		arch = g.Arch
+	}
+
+	for _, j := range jobs {
+		name := j.Name
+
+		size, sum, err := HashFile(j.From, name)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		e := entry{ManifestEntry: ManifestEntry{
+			Name:      name,
+			Size:      size,
+			Hash:      sum,
+			Codec:     j.Maker.Name(),
+			Level:     compress.LevelOf(j.Maker),
+			MaxRatio:  j.MaxRatio,
+			Kind:      kind,
+			Arch:      arch,
+			Encoding:  enc,
+			ChunkSize: chunkSize,
+			Namespace: g.Naming.Namespace,
+			Templates: tmps,
+		}}
+		if g.Format != (cpp.Format{}) {
+			f := g.Format
+			e.Format = &f
+		}
+		p, ok := prev[name]
+		if canReuse && ok {
+			// If the resource is unchanged, it was stored as
+			// recorded in the manifest.
+			e.Outputs = reuser.Outputs(name, p.StoredCodec(),
+				p.Size, p.CompressedSize)
+		}
+
+		e.changed = g.Force || !canReuse || !ok || !e.Unchanged(p)
+		if !e.changed {
+			for _, out := range e.Outputs {
+				if _, err := g.To.Lstat(out); err != nil {
+					// The output is missing.
+					e.changed = true
+					break
+				}
+			}
+		}
+
+		if e.changed {
+			changed = append(changed, j)
+		} else {
+			e.CompressedSize = p.CompressedSize
+			e.Stored = p.Stored
+			reuser.Reuse(name, p.StoredCodec(), size, p.CompressedSize)
+		}
+
+		entries[name] = e
+	}
+
+	return entries, changed, nil
+}
+
 // Size constants.
 const (
 	KB = 2 << 9
@@ -0,0 +1,817 @@
+package gen_test
+
+import (
+	"bytes"
+	"debug/elf"
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/phoenix-engine/phx/fs"
+	"github.com/phoenix-engine/phx/gen"
+	"github.com/phoenix-engine/phx/gen/compress"
+	"github.com/phoenix-engine/phx/gen/cpp"
+	"github.com/phoenix-engine/phx/gen/pack"
+)
+
+type matchAny struct{}
+
+func (matchAny) Match(string) bool { return true }
+
+// makeTree creates a temporary directory containing the given files,
+// keyed by slash-separated path.  The returned func removes it.
+func makeTree(t *testing.T, files map[string]string) (string, func()) {
+	t.Helper()
+
+	tmp, err := ioutil.TempDir("", "phx-gen-test")
+	if err != nil {
+		t.Fatalf("expected nil error, got %#v", err)
+	}
+
+	for name, content := range files {
+		writeFile(t, tmp, name, content)
+	}
+
+	return tmp, func() { os.RemoveAll(tmp) }
+}
+
+func writeFile(t *testing.T, root, name, content string) {
+	t.Helper()
+
+	p := filepath.Join(root, filepath.FromSlash(name))
+	if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+		t.Fatalf("expected nil error, got %#v", err)
+	}
+	if err := ioutil.WriteFile(p, []byte(content), 0644); err != nil {
+		t.Fatalf("expected nil error, got %#v", err)
+	}
+}
+
+func makeGen(from, to string) gen.Gen {
+	return gen.Gen{
+		Sources: []gen.Source{{
+			From:    fs.Real{Where: from},
+			Matcher: matchAny{},
+			Maker:   compress.LZ4Maker{},
+		}},
+		To: fs.Real{Where: to},
+	}
+}
+
+func TestGenNested(t *testing.T) {
+	from, rmFrom := makeTree(t, map[string]string{
+		"top.txt":                "top",
+		"textures/ui/button.png": "button",
+		"shaders/a.glsl":         "shader",
+	})
+	defer rmFrom()
+	to, rmTo := makeTree(t, nil)
+	defer rmTo()
+
+	if err := makeGen(from, to).Operate(); err != nil {
+		t.Fatalf("expected nil error, got %#v", err)
+	}
+
+	for _, name := range []string{
+		"res/top_txt_real.cxx",
+		"res/textures/ui/textures_ui_button_png_real.cxx",
+		"res/shaders/shaders_a_glsl_decl.cxx",
+		"mappings.cxx",
+	} {
+		if _, err := os.Stat(filepath.Join(to, name)); err != nil {
+			t.Errorf("expected %s to exist, got %#v", name, err)
+		}
+	}
+}
+
+func TestGenCodec(t *testing.T) {
+	from, rmFrom := makeTree(t, map[string]string{
+		"a.txt": "some text",
+	})
+	defer rmFrom()
+	to, rmTo := makeTree(t, nil)
+	defer rmTo()
+
+	for _, test := range []struct {
+		maker   compress.Maker
+		include string
+	}{
+		{compress.LZ4Maker{}, `#include "lz4frame.h"`},
+		{compress.DeflateMaker{Level: compress.High}, `#include "zlib.h"`},
+		{compress.NoMaker{}, `#include <cstddef>`},
+	} {
+		g := makeGen(from, to)
+		g.Sources[0].Maker = test.maker
+		if err := g.Operate(); err != nil {
+			t.Fatalf("%s: expected nil error, got %#v", test.maker.Name(), err)
+		}
+
+		bs, err := ioutil.ReadFile(filepath.Join(to, "resource.hpp"))
+		if err != nil {
+			t.Fatalf("%s: expected nil error, got %#v", test.maker.Name(), err)
+		}
+		if !strings.Contains(string(bs), test.include) {
+			t.Errorf("%s: expected resource.hpp to contain %q",
+				test.maker.Name(), test.include)
+		}
+
+		m, err := gen.ReadManifest(fs.Real{Where: to})
+		if err != nil {
+			t.Fatalf("%s: expected nil error, got %#v", test.maker.Name(), err)
+		}
+		if c := m.Resources[0].Codec; c != test.maker.Name() {
+			t.Errorf("expected codec %s in manifest, got %s",
+				test.maker.Name(), c)
+		}
+	}
+}
+
+// nopeMaker is a Maker whose codec has no C++ runtime.
+type nopeMaker struct{ compress.NoMaker }
+
+func (nopeMaker) Name() string { return "nope" }
+
+func TestGenCodecWithoutRuntime(t *testing.T) {
+	from, rmFrom := makeTree(t, map[string]string{
+		"a.txt": "some text",
+	})
+	defer rmFrom()
+	to, rmTo := makeTree(t, nil)
+	defer rmTo()
+
+	g := makeGen(from, to)
+	g.Sources[0].Maker = nopeMaker{}
+	err := g.Operate()
+	if expect := `no C++ runtime for codec "nope"`; err == nil || err.Error() != expect {
+		t.Errorf("expected error %q, got %#v", expect, err)
+	}
+
+	if fis, err := ioutil.ReadDir(to); err != nil || len(fis) != 0 {
+		t.Errorf("expected no output, got %#v, %#v", fis, err)
+	}
+}
+
+func TestGenMaxRatio(t *testing.T) {
+	noise := make([]byte, 4096)
+	rand.New(rand.NewSource(1)).Read(noise)
+
+	from, rmFrom := makeTree(t, map[string]string{
+		"noise.bin": string(noise),
+		"text.txt":  strings.Repeat("some rather repetitive text ", 100),
+	})
+	defer rmFrom()
+	to, rmTo := makeTree(t, nil)
+	defer rmTo()
+
+	g := makeGen(from, to)
+	g.Sources[0].MaxRatio = gen.DefaultMaxRatio
+
+	// The second run reuses both resources, and must keep their
+	// codecs.
+	for run := 0; run < 2; run++ {
+		if err := g.Operate(); err != nil {
+			t.Fatalf("%d: expected nil error, got %#v", run, err)
+		}
+
+		m, err := gen.ReadManifest(fs.Real{Where: to})
+		if err != nil {
+			t.Fatalf("%d: expected nil error, got %#v", run, err)
+		}
+		for _, e := range m.Resources {
+			expect := map[string]string{
+				"noise.bin": "none",
+				"text.txt":  "lz4",
+			}[e.Name]
+			if got := e.StoredCodec(); got != expect {
+				t.Errorf("%d: %s: expected codec %s, got %s",
+					run, e.Name, expect, got)
+			}
+		}
+
+		bs, err := ioutil.ReadFile(filepath.Join(to, "mappings.cxx"))
+		if err != nil {
+			t.Fatalf("%d: expected nil error, got %#v", run, err)
+		}
+		for _, expect := range []string{
+			`{ "none", 0, noise_bin_len, noise_bin }`,
+			`{ "lz4", `,
+		} {
+			if !strings.Contains(string(bs), expect) {
+				t.Errorf("%d: expected mappings.cxx to contain %q:\n%s",
+					run, expect, bs)
+			}
+		}
+	}
+}
+
+// TestGenMaxRatioReplace checks that the compressed output of a resource
+// which is stored uncompressed is replaced by each Kind.
+func TestGenMaxRatioReplace(t *testing.T) {
+	noise := make([]byte, cpp.MinChunkSize)
+	rand.New(rand.NewSource(1)).Read(noise)
+
+	from, rmFrom := makeTree(t, map[string]string{"noise.bin": string(noise)})
+	defer rmFrom()
+
+	for _, kind := range []string{gen.KindCpp, gen.KindPack} {
+		to, rmTo := makeTree(t, nil)
+		defer rmTo()
+
+		// Compressed, the noise is larger than a chunk, so it has
+		// a second chunk, which is removed when it is stored.
+		g := makeGen(from, to)
+		g.Sources[0].MaxRatio = gen.DefaultMaxRatio
+		g.Kind = kind
+		if kind == gen.KindCpp {
+			g.ChunkSize = cpp.MinChunkSize
+		}
+		if err := g.Operate(); err != nil {
+			t.Fatalf("%s: expected nil error, got %#v", kind, err)
+		}
+
+		m, err := gen.ReadManifest(fs.Real{Where: to})
+		if err != nil {
+			t.Fatalf("%s: expected nil error, got %#v", kind, err)
+		}
+		if len(m.Resources) != 1 || m.Resources[0].StoredCodec() != "none" {
+			t.Errorf("%s: expected noise.bin to be stored, got %#v",
+				kind, m.Resources)
+		}
+
+		if kind == gen.KindCpp {
+			for name, expect := range map[string]bool{
+				"res/noise_bin_0_real.cxx": true,
+				"res/noise_bin_1_real.cxx": false,
+			} {
+				_, err := os.Stat(filepath.Join(to, name))
+				if got := err == nil; got != expect {
+					t.Errorf("expected %s to exist: %t, got %#v",
+						name, expect, err)
+				}
+			}
+			continue
+		}
+
+		r, err := pack.Open(filepath.Join(to, pack.Name))
+		if err != nil {
+			t.Fatalf("expected nil error, got %#v", err)
+		}
+		if es := r.Entries(); len(es) != 1 || es[0].Codec != "none" {
+			t.Errorf("expected one stored entry, got %#v", es)
+		}
+		r.Close()
+	}
+}
+
+func TestGenPack(t *testing.T) {
+	from, rmFrom := makeTree(t, map[string]string{
+		"a.txt":     "some text",
+		"sub/b.txt": strings.Repeat("more text ", 100),
+	})
+	defer rmFrom()
+	to, rmTo := makeTree(t, nil)
+	defer rmTo()
+
+	checkPack := func(run int, expect map[string]string) {
+		t.Helper()
+
+		r, err := pack.Open(filepath.Join(to, pack.Name))
+		if err != nil {
+			t.Fatalf("%d: expected nil error, got %#v", run, err)
+		}
+		defer r.Close()
+
+		if es := r.Entries(); len(es) != len(expect) {
+			t.Errorf("%d: expected %d entries, got %#v", run, len(expect), es)
+		}
+		for name, content := range expect {
+			rc, err := r.Open(name)
+			if err != nil {
+				t.Fatalf("%d: expected nil error, got %#v", run, err)
+			}
+			bs, err := ioutil.ReadAll(rc)
+			rc.Close()
+			if err != nil {
+				t.Fatalf("%d: expected nil error, got %#v", run, err)
+			}
+			if string(bs) != content {
+				t.Errorf("%d: expected %s to round-trip, got %q", run, name, bs)
+			}
+		}
+	}
+
+	g := makeGen(from, to)
+	g.Kind = gen.KindPack
+
+	// The next run copies the resources which are unchanged from the
+	// last pack, without keeping any blobs beside it.
+	for run, change := range []func(){
+		func() {},
+		func() {},
+		func() { writeFile(t, from, "a.txt", "changed") },
+		func() { os.Remove(filepath.Join(from, "a.txt")) },
+	} {
+		change()
+		if err := g.Operate(); err != nil {
+			t.Fatalf("%d: expected nil error, got %#v", run, err)
+		}
+
+		expect := map[string]string{
+			"a.txt":     "some text",
+			"sub/b.txt": strings.Repeat("more text ", 100),
+		}
+		switch run {
+		case 2:
+			expect["a.txt"] = "changed"
+		case 3:
+			delete(expect, "a.txt")
+		}
+		checkPack(run, expect)
+
+		if _, err := os.Stat(filepath.Join(to, ".blobs")); !os.IsNotExist(err) {
+			t.Errorf("%d: expected no blobs, got %#v", run, err)
+		}
+	}
+
+	// Without the last pack, every resource is encoded again.
+	if err := os.Remove(filepath.Join(to, pack.Name)); err != nil {
+		t.Fatalf("expected nil error, got %#v", err)
+	}
+	if err := g.Operate(); err != nil {
+		t.Fatalf("expected nil error, got %#v", err)
+	}
+	checkPack(4, map[string]string{
+		"sub/b.txt": strings.Repeat("more text ", 100),
+	})
+
+	g.SkipFinalize = true
+	if err := g.Operate(); err == nil || !strings.Contains(err.Error(),
+		`skipping finalize does not apply to kind "pack"`) {
+		t.Errorf("expected skip finalize error, got %v", err)
+	}
+
+	g.Kind, g.SkipFinalize = "nope", false
+	if err := g.Operate(); err == nil || !strings.Contains(err.Error(), `unknown kind "nope"`) {
+		t.Errorf("expected unknown kind error, got %v", err)
+	}
+}
+
+func TestGenIncbin(t *testing.T) {
+	content := strings.Repeat("more text ", 100)
+	from, rmFrom := makeTree(t, map[string]string{
+		"a.txt":     "some text",
+		"sub/b.txt": content,
+	})
+	defer rmFrom()
+	to, rmTo := makeTree(t, nil)
+	defer rmTo()
+
+	g := makeGen(from, to)
+	g.Kind = gen.KindIncbin
+	if err := g.Operate(); err != nil {
+		t.Fatalf("expected nil error, got %#v", err)
+	}
+
+	f, err := os.Open(filepath.Join(to, "res/sub/sub_b_txt_real.bin"))
+	if err != nil {
+		t.Fatalf("expected nil error, got %#v", err)
+	}
+	defer f.Close()
+
+	codec, err := compress.Lookup("")
+	if err != nil {
+		t.Fatalf("expected nil error, got %#v", err)
+	}
+	rc, err := codec.Reader(f)
+	if err != nil {
+		t.Fatalf("expected nil error, got %#v", err)
+	}
+	defer rc.Close()
+
+	bs, err := ioutil.ReadAll(rc)
+	if err != nil {
+		t.Fatalf("expected nil error, got %#v", err)
+	}
+	if string(bs) != content {
+		t.Errorf("expected content to round-trip, got %q", bs)
+	}
+
+	for _, name := range []string{
+		"res/sub/sub_b_txt_real.S",
+		"res/sub/sub_b_txt_decl.cxx",
+	} {
+		if _, err := os.Stat(filepath.Join(to, name)); err != nil {
+			t.Errorf("expected %s to exist, got %#v", name, err)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(to, "res/sub/sub_b_txt_real.cxx")); !os.IsNotExist(err) {
+		t.Errorf("expected no array literal, got %#v", err)
+	}
+
+	// Switching back to arrays encodes every resource again, and
+	// removes the assembly output.
+	g.Kind = gen.KindCpp
+	if err := g.Operate(); err != nil {
+		t.Fatalf("expected nil error, got %#v", err)
+	}
+	for name, exist := range map[string]bool{
+		"res/sub/sub_b_txt_real.cxx": true,
+		"res/sub/sub_b_txt_real.bin": false,
+		"res/sub/sub_b_txt_real.S":   false,
+	} {
+		_, err := os.Stat(filepath.Join(to, name))
+		if exist && err != nil {
+			t.Errorf("expected %s to exist, got %#v", name, err)
+		} else if !exist && !os.IsNotExist(err) {
+			t.Errorf("expected %s to be removed, got %#v", name, err)
+		}
+	}
+}
+
+func TestGenELF(t *testing.T) {
+	from, rmFrom := makeTree(t, map[string]string{
+		"a.txt":     "some text",
+		"sub/b.txt": strings.Repeat("more text ", 100),
+	})
+	defer rmFrom()
+	to, rmTo := makeTree(t, nil)
+	defer rmTo()
+
+	g := makeGen(from, to)
+	g.Kind, g.Arch = gen.KindELF, "aarch64"
+	if err := g.Operate(); err != nil {
+		t.Fatalf("expected nil error, got %#v", err)
+	}
+
+	all, err := fs.Files(fs.Real{Where: filepath.Join(to, "res")}, "")
+	if err != nil {
+		t.Fatalf("expected nil error, got %#v", err)
+	}
+	if len(all) != 2 || all[0] != "a_txt_real.o" || all[1] != "sub/sub_b_txt_real.o" {
+		t.Errorf("expected only object files, got %v", all)
+	}
+
+	f, err := elf.Open(filepath.Join(to, "res/sub/sub_b_txt_real.o"))
+	if err != nil {
+		t.Fatalf("expected nil error, got %#v", err)
+	}
+	defer f.Close()
+	if f.Machine != elf.EM_AARCH64 {
+		t.Errorf("expected aarch64 object, got %s", f.Machine)
+	}
+
+	// Changing the architecture encodes every resource again.
+	g.Arch = "x86-64"
+	if err := g.Operate(); err != nil {
+		t.Fatalf("expected nil error, got %#v", err)
+	}
+	f2, err := elf.Open(filepath.Join(to, "res/a_txt_real.o"))
+	if err != nil {
+		t.Fatalf("expected nil error, got %#v", err)
+	}
+	defer f2.Close()
+	if f2.Machine != elf.EM_X86_64 {
+		t.Errorf("expected x86-64 object, got %s", f2.Machine)
+	}
+
+	g.Arch = "mips"
+	if err := g.Operate(); err == nil || !strings.Contains(err.Error(), `unsupported architecture "mips"`) {
+		t.Errorf("expected unsupported architecture error, got %v", err)
+	}
+}
+
+func TestGenEncoding(t *testing.T) {
+	from, rmFrom := makeTree(t, map[string]string{
+		"a.txt": strings.Repeat("some text\n", 10),
+	})
+	defer rmFrom()
+	to, rmTo := makeTree(t, nil)
+	defer rmTo()
+
+	g := makeGen(from, to)
+	for _, test := range []struct {
+		encoding     string
+		expectPrefix string
+	}{
+		{"string", `"`},
+		{"", "0x"},
+		{"decimal", "4,"},
+	} {
+		g.Encoding = test.encoding
+		if err := g.Operate(); err != nil {
+			t.Fatalf("%q: expected nil error, got %#v", test.encoding, err)
+		}
+
+		bs, err := ioutil.ReadFile(filepath.Join(to, "res/a_txt_real.cxx"))
+		if err != nil {
+			t.Fatalf("%q: expected nil error, got %#v", test.encoding, err)
+		}
+		if !strings.HasPrefix(string(bs), test.expectPrefix) {
+			t.Errorf("%q: expected array to start with %q, got %q",
+				test.encoding, test.expectPrefix, bs)
+		}
+	}
+
+	g.Kind, g.Encoding = gen.KindPack, "string"
+	if err := g.Operate(); err == nil || !strings.Contains(err.Error(), `encoding string does not apply to kind "pack"`) {
+		t.Errorf("expected encoding error, got %v", err)
+	}
+}
+
+func TestGenFormat(t *testing.T) {
+	from, rmFrom := makeTree(t, map[string]string{
+		"a.txt": strings.Repeat("some text\n", 10),
+	})
+	defer rmFrom()
+	to, rmTo := makeTree(t, nil)
+	defer rmTo()
+
+	g := makeGen(from, to)
+	g.Format = cpp.Format{NoComment: true, CRLF: true}
+	if err := g.Operate(); err != nil {
+		t.Fatalf("expected nil error, got %#v", err)
+	}
+
+	for _, name := range []string{
+		"res/a_txt_real.cxx",
+		"res/a_txt_decl.cxx",
+		"mapper.hpp",
+		"mapper.cxx",
+		"CMakeLists.txt",
+	} {
+		bs, err := ioutil.ReadFile(filepath.Join(to, name))
+		if err != nil {
+			t.Fatalf("%s: expected nil error, got %#v", name, err)
+		}
+		if lf, crlf := bytes.Count(bs, []byte("\n")), bytes.Count(bs, []byte("\r\n")); lf == 0 || lf != crlf {
+			t.Errorf("%s: expected only CRLF newlines, got %d of %d",
+				name, crlf, lf)
+		}
+		if bytes.Contains(bs, []byte("// |")) {
+			t.Errorf("%s: expected no ASCII comments", name)
+		}
+	}
+
+	// Changing the format encodes the resource again.
+	g.Format = cpp.Format{}
+	if err := g.Operate(); err != nil {
+		t.Fatalf("expected nil error, got %#v", err)
+	}
+	bs, err := ioutil.ReadFile(filepath.Join(to, "res/a_txt_real.cxx"))
+	if err != nil {
+		t.Fatalf("expected nil error, got %#v", err)
+	}
+	if bytes.Contains(bs, []byte("\r\n")) || !bytes.Contains(bs, []byte("// |")) {
+		t.Errorf("expected default format, got %q", bs)
+	}
+
+	g.Format = cpp.Format{Width: 4}
+	if err := g.Operate(); err == nil || !strings.Contains(err.Error(), "format: width 4") {
+		t.Errorf("expected format error, got %v", err)
+	}
+}
+
+func TestGenChunked(t *testing.T) {
+	content := make([]byte, 10000)
+	rand.New(rand.NewSource(1)).Read(content)
+
+	from, rmFrom := makeTree(t, map[string]string{
+		"a.bin": string(content),
+	})
+	defer rmFrom()
+	to, rmTo := makeTree(t, nil)
+	defer rmTo()
+
+	g := makeGen(from, to)
+	g.Sources[0].Maker = compress.NoMaker{}
+
+	check := func(chunkSize int, expect ...int) {
+		t.Helper()
+
+		g.ChunkSize = int64(chunkSize)
+		if err := g.Operate(); err != nil {
+			t.Fatalf("%d: expected nil error, got %#v", chunkSize, err)
+		}
+
+		for i, n := range expect {
+			name := fmt.Sprintf("res/a_bin_%d_real.cxx", i)
+			bs, err := ioutil.ReadFile(filepath.Join(to, name))
+			if err != nil {
+				t.Fatalf("%d: expected nil error, got %#v", chunkSize, err)
+			}
+			if got := bytes.Count(bs, []byte("0x")); got != n {
+				t.Errorf("%d: expected %s to have %d bytes, got %d",
+					chunkSize, name, n, got)
+			}
+		}
+
+		// There are no other chunks, and no unchunked array.
+		name := fmt.Sprintf("res/a_bin_%d_real.cxx", len(expect))
+		for _, name := range []string{name, "res/a_bin_real.cxx"} {
+			if _, err := os.Stat(filepath.Join(to, name)); !os.IsNotExist(err) {
+				t.Errorf("%d: expected %s not to exist, got %v",
+					chunkSize, name, err)
+			}
+		}
+	}
+
+	check(4096, 4096, 4096, 1808)
+
+	// The chunks are reused, and removed when the chunk size
+	// changes.
+	check(4096, 4096, 4096, 1808)
+	check(5000, 5000, 5000)
+
+	bs, err := ioutil.ReadFile(filepath.Join(to, "mappings.cxx"))
+	if err != nil {
+		t.Fatalf("expected nil error, got %#v", err)
+	}
+	if !bytes.Contains(bs, []byte("a_bin_chunks, 5000 }")) {
+		t.Errorf("expected mappings to use the chunk table, got:\n%s", bs)
+	}
+
+	g.ChunkSize = 100
+	if err := g.Operate(); err == nil || !strings.Contains(err.Error(), "chunk size 100 is less than 4096") {
+		t.Errorf("expected chunk size error, got %v", err)
+	}
+
+	g.Kind, g.ChunkSize = gen.KindIncbin, 4096
+	if err := g.Operate(); err == nil || !strings.Contains(err.Error(), `chunk size does not apply to kind "incbin"`) {
+		t.Errorf("expected chunk size error, got %v", err)
+	}
+}
+
+func TestGenDisambiguate(t *testing.T) {
+	from, rmFrom := makeTree(t, map[string]string{
+		"a-b.txt": "dash",
+		"a_b.txt": "underscore",
+		"int":     "keyword",
+		"c.txt":   "fine",
+	})
+	defer rmFrom()
+	to, rmTo := makeTree(t, nil)
+	defer rmTo()
+
+	g := makeGen(from, to)
+	err := g.Operate()
+	if err == nil {
+		t.Fatal("expected an error, got nil")
+	}
+	for _, expect := range []string{
+		"resource int maps to int, which is a C++ keyword",
+		"resources a-b.txt and a_b.txt both map to a_b_txt",
+	} {
+		if !strings.Contains(err.Error(), expect) {
+			t.Errorf("expected error to contain %q, got %v", expect, err)
+		}
+	}
+
+	g.Disambiguate = true
+	if err := g.Operate(); err != nil {
+		t.Fatalf("expected nil error, got %#v", err)
+	}
+
+	bs, err := ioutil.ReadFile(filepath.Join(to, "id.hpp"))
+	if err != nil {
+		t.Fatalf("expected nil error, got %#v", err)
+	}
+
+	// The disambiguated names are the same on every run.
+	ids := cpp.Names{Members: true}.Disambiguate(
+		[]string{"a-b.txt", "a_b.txt", "int", "c.txt"},
+	)
+	for _, name := range []string{"a-b.txt", "a_b.txt", "int", "c.txt"} {
+		v := cpp.Resource{Name: name, ID: ids[name]}.VarName()
+		if !bytes.Contains(bs, []byte("\t"+v+", // "+name+"\n")) {
+			t.Errorf("expected ID %s for %s, got:\n%s", v, name, bs)
+		}
+		if _, err := os.Stat(filepath.Join(to, "res", v+"_decl.cxx")); err != nil {
+			t.Errorf("expected nil error, got %#v", err)
+		}
+	}
+	if _, ok := ids["c.txt"]; ok {
+		t.Errorf("expected c.txt not to be disambiguated")
+	}
+}
+
+func TestGenNaming(t *testing.T) {
+	from, rmFrom := makeTree(t, map[string]string{
+		"a.txt":    "top",
+		"ui/b.txt": "nested",
+	})
+	defer rmFrom()
+	to, rmTo := makeTree(t, nil)
+	defer rmTo()
+
+	g := makeGen(from, to)
+	if err := g.Operate(); err != nil {
+		t.Fatalf("expected nil error, got %#v", err)
+	}
+
+	// Changing the namespace encodes the resources again, since
+	// their declarations are in it.
+	g.Naming = cpp.Naming{Namespace: "game", Nested: true, StripExt: true}
+	if err := g.Operate(); err != nil {
+		t.Fatalf("expected nil error, got %#v", err)
+	}
+
+	for name, expect := range map[string][]string{
+		"res/a_txt_decl.cxx":       {"namespace game {", "Mapper::a_txt_len"},
+		"res/ui/ui_b_txt_decl.cxx": {"namespace game {"},
+		"id.hpp": {
+			"\ta, // a.txt\n",
+			"namespace ui {\n    enum class ID {\n\tb = 1, // ui/b.txt\n",
+		},
+		"mappings.cxx": {"static_cast<ID>(ui::ID::b),"},
+		"mapper.hpp":   {"Fetch(ui::ID id)"},
+		"resource.hpp": {"namespace game {", "}; // namespace game"},
+	} {
+		bs, err := ioutil.ReadFile(filepath.Join(to, name))
+		if err != nil {
+			t.Fatalf("expected nil error, got %#v", err)
+		}
+		for _, e := range expect {
+			if !bytes.Contains(bs, []byte(e)) {
+				t.Errorf("expected %s to contain %q, got:\n%s", name, e, bs)
+			}
+		}
+	}
+
+	g.Naming = cpp.Naming{Style: "kebab"}
+	if err := g.Operate(); err == nil || !strings.Contains(err.Error(), `naming: unknown naming style "kebab"`) {
+		t.Errorf("expected naming error, got %v", err)
+	}
+}
+
+func TestGenTemplates(t *testing.T) {
+	from, rmFrom := makeTree(t, map[string]string{"a.txt": "hello"})
+	defer rmFrom()
+	to, rmTo := makeTree(t, nil)
+	defer rmTo()
+	tmps, rmTmps := makeTree(t, map[string]string{
+		"decl.cxx.tmpl": "// {{.Name}}: {{size .Size}}\n",
+		"README.md":     "Not a template.",
+	})
+	defer rmTmps()
+
+	g := makeGen(from, to)
+	g.Templates = fs.Real{Where: tmps}
+	if err := g.Operate(); err != nil {
+		t.Fatalf("expected nil error, got %#v", err)
+	}
+
+	read := func(name string) string {
+		bs, err := ioutil.ReadFile(filepath.Join(to, name))
+		if err != nil {
+			t.Fatalf("expected nil error, got %#v", err)
+		}
+		return string(bs)
+	}
+	if got, expect := read("res/a_txt_decl.cxx"), "// a.txt: 5 B\n"; got != expect {
+		t.Errorf("expected %q, got %q", expect, got)
+	}
+
+	// Changing a template encodes the resources again.
+	err := ioutil.WriteFile(filepath.Join(tmps, "decl.cxx.tmpl"),
+		[]byte("// {{upper .Name}}\n"), 0644)
+	if err != nil {
+		t.Fatalf("expected nil error, got %#v", err)
+	}
+	if err := g.Operate(); err != nil {
+		t.Fatalf("expected nil error, got %#v", err)
+	}
+	if got, expect := read("res/a_txt_decl.cxx"), "// A.TXT\n"; got != expect {
+		t.Errorf("expected %q, got %q", expect, got)
+	}
+
+	// So does going back to the built-in templates.
+	g.Templates = nil
+	if err := g.Operate(); err != nil {
+		t.Fatalf("expected nil error, got %#v", err)
+	}
+	if got := read("res/a_txt_decl.cxx"); !strings.Contains(got, "Mapper::a_txt_len") {
+		t.Errorf("expected the built-in declaration, got:\n%s", got)
+	}
+
+	err = ioutil.WriteFile(filepath.Join(tmps, "id.hpp.tmpl"),
+		[]byte("{{range .}}{{.Path}} {{.Len}}{{end}}"), 0644)
+	if err != nil {
+		t.Fatalf("expected nil error, got %#v", err)
+	}
+	g.Templates = fs.Real{Where: tmps}
+	expect := "loading templates: template id.hpp.tmpl, line 1: " +
+		"Resource has no field or method Len"
+	if err := g.Operate(); err == nil || err.Error() != expect {
+		t.Errorf("expected %q, got %v", expect, err)
+	}
+
+	g.Kind = gen.KindPack
+	expect = `templates do not apply to kind "pack"`
+	if err := g.Operate(); err == nil || err.Error() != expect {
+		t.Errorf("expected %q, got %v", expect, err)
+	}
+}
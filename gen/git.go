@@ -1,13 +1,10 @@
 package gen
 
 import (
-	"bytes"
-	"fmt"
-	"io"
 	"os"
-	"os/exec"
 	"path/filepath"
 	"strings"
+	"unicode"
 
 	"github.com/pkg/errors"
 )
@@ -15,96 +12,423 @@ import (
 // GitModule is an optional job which can be added to a Gen pipeline to
 // clone a given Git repository into the local repo.
 type GitModule struct {
+	// Overwrite resets a checkout with local modifications to the
+	// pinned revision, discarding the modifications.
 	Overwrite bool
 
 	// Remote specifies the full path to the remote, including e.g.
 	// protocol.  Local is the local name that the repo will be
 	// cloned into.  Revision (optional) defines a specific revision
 	// to be checked out, such as a tag, commit id, or branch.  If
-	// Branch is set, it will be used in git submodule commands.
+	// Branch is set, it will be used in git submodule commands, and
+	// it is checked out if Revision is not set.
 	Remote, Local, Branch, Revision string
+
+	// Runner runs git.  If it is nil, git is run using an ExecRunner
+	// with the DefaultTimeout.
+	Runner Runner
 }
 
-func runOut(w io.Writer, command string, args ...interface{}) (bool, error) {
-	cc := fmt.Sprintf(command, args...)
-	elements := strings.Fields(cc)
-	proc := exec.Command(elements[0], elements[1:]...)
-	proc.Stdout = w
+// Drift is a set of ways in which the checkout of a GitModule differs
+// from its pinned revision.
+type Drift int
 
-	err := errors.Wrapf(proc.Run(), "running %v", cc)
-	success := proc.ProcessState.Success()
+// Drift flags.
+const (
+	// DriftMissing is set if the Local path isn't a checkout of the
+	// GitModule, or a submodule.
+	DriftMissing Drift = 1 << iota
 
-	switch errors.Cause(err).(type) {
-	case nil:
-	case *exec.ExitError:
-	default:
-		return success, err
+	// DriftUninitialized is set if the Local path is a submodule
+	// which isn't initialized, as in a new clone of the Git repo.
+	DriftUninitialized
+
+	// DriftCommit is set if another commit is checked out.
+	DriftCommit
+
+	// DriftModified is set if tracked files have local modifications.
+	DriftModified
+
+	// DriftSubmodules is set if any nested submodules aren't
+	// initialized, or aren't at the commits the checkout records.
+	DriftSubmodules
+)
+
+var driftNames = []string{
+	"missing", "uninitialized", "commit", "modified", "submodules",
+}
+
+// String implements fmt.Stringer on Drift, such as "commit,modified",
+// or "none" if no flags are set.
+func (d Drift) String() string {
+	var names []string
+	for i, name := range driftNames {
+		if d&(1<<uint(i)) != 0 {
+			names = append(names, name)
+		}
+	}
+	if len(names) == 0 {
+		return "none"
 	}
-	return success, nil
+	return strings.Join(names, ",")
 }
 
-func run(command string, args ...interface{}) (bool, error) {
-	return runOut(os.Stdout, command, args...)
+// ModuleStatus describes the checkout of a GitModule.
+type ModuleStatus struct {
+	// Drift is how the checkout differed from its pinned revision.
+	Drift Drift
+
+	// Commit is the commit checked out, if any.  Expected is the
+	// commit the pinned revision names, if the GitModule has one and
+	// it is known locally.
+	Commit, Expected string
 }
 
-// Operate checks for the presence of the Git submodule in the given
-// relative path.  If the working directory is not in a Git repo, the
-// GitModule is cloned directly into the target root.
-//
-// If the working directory is in a Git repo, Operate checks for the
-// GitModule as a submodule of the Git repo, in the given path.  If it
-// is not a submodule in the given path, or if g.Overwrite is true, the
-// GitModule is added there as a git submodule using git from the shell.
+func (g GitModule) runner() Runner {
+	if g.Runner != nil {
+		return g.Runner
+	}
+	return ExecRunner{Timeout: DefaultTimeout}
+}
+
+// git runs git with the given arguments in dir, using the GitModule's
+// Runner, and returns its output without trailing space.
+func (g GitModule) git(dir string, args ...string) (string, error) {
+	out, err := g.runner().Run(dir, append([]string{"git"}, args...)...)
+	return strings.TrimRightFunc(string(out), unicode.IsSpace), err
+}
+
+// rev returns the revision the GitModule is pinned to, if any.
+func (g GitModule) rev() string {
+	if g.Revision != "" {
+		return g.Revision
+	}
+	return g.Branch
+}
+
+// checkRev returns an error if the revision would be taken as an option
+// of git.
+func checkRev(rev string) error {
+	if strings.HasPrefix(rev, "-") {
+		return errors.Errorf("invalid revision %q", rev)
+	}
+	return nil
+}
+
+func (g GitModule) outpath() string {
+	return filepath.ToSlash(filepath.Clean(g.Local))
+}
+
+// Check returns the ModuleStatus of the GitModule's checkout in its Local
+// path, relative to the given root directory, without changing it.  If
+// the root is in a Git repo, the GitModule is expected to be a submodule
+// of it.  The pinned revision is resolved as of the last fetch, with a
+// branch resolved to its head in the remote.
+func (g GitModule) Check(root string) (ModuleStatus, error) {
+	var (
+		st      ModuleStatus
+		outpath = g.outpath()
+		dir     = filepath.Join(root, g.Local)
+	)
+
+	// Are we in a git repo?
+	if is, err := g.inRepo(root); err != nil {
+		return st, err
+	} else if is {
+		// Yes.  Is the desired GitModule already a submodule?
+		out, err := g.git(root, "submodule", "status", "--", outpath)
+		switch {
+		case exited(err):
+			st.Drift = DriftMissing
+			return st, nil
+		case err != nil:
+			return st, errors.Wrapf(err, "checking git submodule %s", outpath)
+		case strings.HasPrefix(out, "-"):
+			st.Drift = DriftUninitialized
+			return st, nil
+		}
+	} else if _, err := os.Stat(filepath.Join(dir, ".git")); err != nil {
+		// No, and it wasn't cloned yet.
+		st.Drift = DriftMissing
+		return st, nil
+	}
+
+	// A repo without commits has no HEAD.
+	head, err := g.git(dir, "rev-parse", "--verify", "HEAD")
+	switch {
+	case err == nil:
+		st.Commit = head
+	case !exited(err):
+		return st, errors.Wrapf(err, "checking %s", outpath)
+	}
+
+	if rev := g.rev(); rev != "" {
+		if st.Expected, err = g.resolveLocal(dir, rev); err != nil {
+			return st, err
+		}
+		if st.Commit != st.Expected {
+			st.Drift |= DriftCommit
+		}
+	}
+
+	out, err := g.git(dir, "status", "--porcelain",
+		"--untracked-files=no", "--ignore-submodules=all")
+	if err != nil {
+		return st, errors.Wrapf(err, "checking %s for modifications", outpath)
+	} else if out != "" {
+		st.Drift |= DriftModified
+	}
+
+	out, err = g.git(dir, "submodule", "status", "--recursive")
+	if err != nil {
+		return st, errors.Wrapf(err, "checking submodules of %s", outpath)
+	}
+	for _, line := range strings.Split(out, "\n") {
+		if line != "" && line[0] != ' ' {
+			st.Drift |= DriftSubmodules
+		}
+	}
+
+	return st, nil
+}
+
+// Operate makes the Local path, relative to the given root directory,
+// where git is run, a checkout of the GitModule at its pinned revision,
+// including its nested submodules.  It returns the ModuleStatus of the
+// checkout as it was found, with the Commit which is checked out now.
 //
-// If it is present, and Overwrite is false, it is ignored.
+// If the root is not in a Git repo, the GitModule is cloned directly
+// into the Local path.  If the root is in a Git repo, the GitModule is
+// added there as a git submodule, or initialized if it is a submodule
+// already.  Git is run using the GitModule's Runner, which passes the
+// Remote and Local path to it as they are.
 //
-// TODO: Check for a particular revision.
-func (g GitModule) Operate(root string) error {
-	outpath := filepath.Join(root, g.Local)
+// If the GitModule has no pinned revision, whatever is checked out is
+// kept.  Otherwise, the pinned revision is checked out, fetching it if
+// it isn't known locally.  A checkout with local modifications is only
+// reset to the pinned revision if Overwrite is set, and is an error
+// otherwise, unless the pinned revision is checked out already.
+func (g GitModule) Operate(root string) (ModuleStatus, error) {
+	var (
+		outpath = g.outpath()
+		dir     = filepath.Join(root, g.Local)
+	)
 
-	// Are we in a git repo?
-	if is, err := runOut(nil, "git rev-parse --is-inside-work-tree"); err != nil {
-		return errors.Wrap(err, "creating git status check")
-	} else if !is {
-		// No.  Clone the repo into the target root.
-		ok, err := run("git clone %s %s", g.Remote, outpath)
+	rev := g.rev()
+	if err := checkRev(rev); err != nil {
+		return ModuleStatus{}, err
+	}
+
+	found, err := g.Check(root)
+	if err != nil {
+		return found, err
+	}
+
+	st := found
+	switch {
+	case found.Drift&DriftMissing != 0:
+		if err := g.add(root); err != nil {
+			return found, err
+		}
+	case found.Drift&DriftUninitialized != 0:
+		_, err := g.git(root, "submodule", "update", "--quiet",
+			"--init", "--recursive", "--", outpath)
 		if err != nil {
-			return errors.Wrapf(err, "cloning git remote %s", g.Remote)
+			return found, errors.Wrapf(err, "initializing submodule %s", outpath)
 		}
-		if !ok {
-			return errors.Errorf("cloning git remote %s failed", g.Remote)
+	}
+	if found.Drift&(DriftMissing|DriftUninitialized) != 0 {
+		if st, err = g.Check(root); err != nil {
+			return found, err
 		}
-		return nil
 	}
 
-	// Yes, we are in a git repo.
+	if rev != "" && st.Expected == "" {
+		// The pinned revision isn't known locally.
+		if err := g.fetch(dir); err != nil {
+			return found, err
+		}
+		if st.Expected, err = g.resolveLocal(dir, rev); err != nil {
+			return found, err
+		} else if st.Expected == "" {
+			return found, errors.Errorf("no revision %s in %s", rev, g.Remote)
+		}
+	}
 
-	// Is the desired GitModule already a submodule?
-	var buf bytes.Buffer
-	isSubm, err := runOut(&buf, "git submodule status %s", outpath)
+	target := st.Expected
+	if target == "" {
+		target = st.Commit
+	}
+	changed := true
+	switch dirty := st.Drift&DriftModified != 0; {
+	case dirty && g.Overwrite:
+		_, err = g.git(dir, "reset", "--quiet", "--hard", target)
+		err = errors.Wrapf(err, "resetting %s", outpath)
+	case st.Commit == target:
+		changed = false
+	case dirty:
+		err = errors.Errorf("%s has local modifications, so it can't "+
+			"be checked out at %s without overwriting them", outpath, rev)
+	default:
+		_, err = g.git(dir, "checkout", "--quiet", target)
+		err = errors.Wrapf(err, "checking out %s in %s", rev, outpath)
+	}
 	if err != nil {
-		return errors.Wrapf(err, "checking git submodule %s", outpath)
-	} else if isSubm {
-		// Yes, check whether its state matches expected.
-		return nil
+		return found, err
 	}
 
-	// No, add it as a submodule.
+	if changed || st.Drift&DriftSubmodules != 0 {
+		args := []string{"submodule", "update", "--quiet", "--init", "--recursive"}
+		if g.Overwrite {
+			args = append(args, "--force")
+		}
+		if _, err := g.git(dir, args...); err != nil {
+			return found, errors.Wrapf(err, "updating submodules of %s", outpath)
+		}
+	}
+
+	found.Commit = target
+	if found.Expected == "" {
+		found.Expected = st.Expected
+	}
+	return found, nil
+}
+
+// add clones the GitModule into its Local path, relative to the given
+// root, or adds it as a submodule there if the root is in a Git repo.
+func (g GitModule) add(root string) error {
+	outpath := g.outpath()
+
+	if is, err := g.inRepo(root); err != nil {
+		return err
+	} else if !is {
+		_, err := g.git(root, "clone", "--quiet", "--recursive",
+			"--", g.Remote, outpath)
+		return errors.Wrapf(err, "cloning git remote %s", g.Remote)
+	}
 
 	// If it has a branch set, use that branch.
-	var b string
-	if gb := g.Branch; gb != "" {
-		b = "-b " + gb + " "
+	args := []string{"submodule", "add", "--quiet"}
+	if g.Branch != "" {
+		args = append(args, "-b", g.Branch)
+	}
+	_, err := g.git(root, append(args, "--", g.Remote, outpath)...)
+	if err != nil {
+		return errors.Wrapf(err, "adding submodule %s from %s", outpath, g.Remote)
+	}
+
+	_, err = g.git(root, "submodule", "update", "--quiet",
+		"--init", "--recursive", "--", outpath)
+	return errors.Wrapf(err, "initializing submodules of %s", outpath)
+}
+
+func (g GitModule) inRepo(root string) (bool, error) {
+	_, err := g.git(root, "rev-parse", "--is-inside-work-tree")
+	switch {
+	case err == nil:
+		return true, nil
+	case exited(err):
+		return false, nil
+	}
+	return false, errors.Wrap(err, "creating git status check")
+}
+
+func (g GitModule) fetch(dir string) error {
+	_, err := g.git(dir, "fetch", "--quiet", "--tags", "origin")
+	return errors.Wrapf(err, "fetching %s", g.Remote)
+}
+
+// resolveLocal returns the commit the revision names in the checkout in
+// dir, as of its last fetch, or "" if it names none.  A branch names its
+// head in the remote.
+func (g GitModule) resolveLocal(dir, rev string) (string, error) {
+	for _, r := range []string{"origin/" + rev, rev} {
+		commit, err := g.git(dir, "rev-parse", "--verify", "--quiet", r+"^{commit}")
+		switch {
+		case err == nil:
+			return commit, nil
+		case !exited(err):
+			return "", errors.Wrapf(err, "resolving %s", rev)
+		}
+	}
+	return "", nil
+}
+
+// Resolve fetches the GitModule's remote into its Local path, relative
+// to the given root, and returns the ID of the commit the given
+// revision names there.  A branch is resolved to its head in the
+// remote, rather than in the Local checkout.  An empty revision is
+// resolved to the Branch, or to the head of the remote.
+func (g GitModule) Resolve(root, rev string) (string, error) {
+	if err := checkRev(rev); err != nil {
+		return "", err
+	}
+
+	dir := filepath.Join(root, g.Local)
+	if err := g.fetch(dir); err != nil {
+		return "", err
+	}
+
+	if rev == "" {
+		rev = g.Branch
+	}
+	if rev == "" {
+		rev = "HEAD"
 	}
+	commit, err := g.resolveLocal(dir, rev)
+	if err == nil && commit == "" {
+		err = errors.Errorf("no revision %s in %s", rev, g.Remote)
+	}
+	return commit, err
+}
+
+// Remove removes the GitModule's Local path, relative to the given root.
+// If it is a submodule of the Git repo the root is in, it is removed
+// from the repo, along with its clone in the repo's .git, so that it
+// can be added again.
+func (g GitModule) Remove(root string) error {
+	outpath := g.outpath()
 
-	ok, err := run("git submodule add %s%s %s", b, g.Remote, outpath)
+	is, err := g.inRepo(root)
 	if err != nil {
-		msg := "adding submodule %s from %s"
-		return errors.Wrapf(err, msg, outpath, g.Remote)
-	} else if ok {
-		// The submodule was added successfully.
-		return nil
+		return err
+	}
+	if is {
+		_, err := g.git(root, "submodule", "status", "--", outpath)
+		switch {
+		case err == nil:
+			return g.removeSubmodule(root)
+		case !exited(err):
+			return errors.Wrapf(err, "checking git submodule %s", outpath)
+		}
+	}
+
+	return errors.Wrapf(os.RemoveAll(filepath.Join(root, g.Local)),
+		"removing %s", outpath)
+}
+
+func (g GitModule) removeSubmodule(root string) error {
+	outpath := g.outpath()
+
+	// The clone of the submodule is named by its path in the repo.
+	gitDir, err := g.git(root, "rev-parse", "--absolute-git-dir")
+	if err != nil {
+		return errors.Wrap(err, "finding git dir")
+	}
+	prefix, err := g.git(root, "rev-parse", "--show-prefix")
+	if err != nil {
+		return errors.Wrap(err, "finding git dir")
+	}
+	clone := filepath.Join(gitDir, "modules", filepath.FromSlash(prefix+outpath))
+
+	for _, args := range [][]string{
+		{"submodule", "deinit", "--quiet", "--force", "--", outpath},
+		{"rm", "--quiet", "--force", "--", outpath},
+	} {
+		if _, err := g.git(root, args...); err != nil {
+			return errors.Wrapf(err, "removing submodule %s", outpath)
+		}
 	}
 
-	return errors.Errorf("failed to add submodule %s from %s", outpath, g.Remote)
+	return errors.Wrapf(os.RemoveAll(clone), "removing %s", clone)
 }
@@ -0,0 +1,202 @@
+package gen_test
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/phoenix-engine/phx/gen"
+)
+
+// git runs git in the given directory, allowing local remotes to be
+// used for submodules.
+func git(t *testing.T, dir string, args ...string) string {
+	t.Helper()
+
+	cmd := exec.Command("git", append([]string{
+		"-c", "protocol.file.allow=always",
+		"-c", "user.name=phx", "-c", "user.email=phx@example.com",
+	}, args...)...)
+	cmd.Dir = dir
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("git %s: %v\n%s", strings.Join(args, " "), err, out)
+	}
+	return strings.TrimSpace(string(out))
+}
+
+func TestDriftString(t *testing.T) {
+	for given, expect := range map[gen.Drift]string{
+		0:                                     "none",
+		gen.DriftMissing:                      "missing",
+		gen.DriftCommit | gen.DriftModified:   "commit,modified",
+		gen.DriftSubmodules | gen.DriftCommit: "commit,submodules",
+	} {
+		if got := given.String(); got != expect {
+			t.Errorf("expected %q, got %q", expect, got)
+		}
+	}
+}
+
+func TestGitModule(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+
+	// Submodules of local remotes are only allowed by config.
+	for k, v := range map[string]string{
+		"GIT_CONFIG_COUNT":   "1",
+		"GIT_CONFIG_KEY_0":   "protocol.file.allow",
+		"GIT_CONFIG_VALUE_0": "always",
+	} {
+		defer os.Setenv(k, os.Getenv(k))
+		os.Setenv(k, v)
+	}
+
+	tmp, cleanup := makeTree(t, map[string]string{
+		"lib/f":    "v1",
+		"my app/f": "app",
+	})
+	defer cleanup()
+
+	// The app has the lib as a nested submodule.  Its path has a space,
+	// which is passed to git as part of the remote.
+	lib, app := filepath.Join(tmp, "lib"), filepath.Join(tmp, "my app")
+	git(t, lib, "init", "--quiet")
+	git(t, lib, "add", "f")
+	git(t, lib, "commit", "--quiet", "-m", "v1")
+	git(t, lib, "tag", "v1")
+	writeFile(t, lib, "f", "v2")
+	git(t, lib, "commit", "--quiet", "-am", "v2")
+
+	git(t, app, "init", "--quiet")
+	git(t, app, "submodule", "--quiet", "add", lib, "lib")
+	git(t, filepath.Join(app, "lib"), "checkout", "--quiet", "v1")
+	git(t, app, "add", ".")
+	git(t, app, "commit", "--quiet", "-m", "app")
+	pinned := git(t, app, "rev-parse", "HEAD")
+
+	checkFile := func(name, expect string) {
+		t.Helper()
+		bs, err := ioutil.ReadFile(name)
+		if err != nil {
+			t.Errorf("expected nil error, got %#v", err)
+		} else if string(bs) != expect {
+			t.Errorf("expected %s to be %q, got %q", name, expect, bs)
+		}
+	}
+	check := func(st gen.ModuleStatus, err error, expect gen.Drift) {
+		t.Helper()
+		if err != nil {
+			t.Fatalf("expected nil error, got %#v", err)
+		}
+		if st.Drift != expect {
+			t.Errorf("expected drift %s, got %s", expect, st.Drift)
+		}
+	}
+
+	for _, inRepo := range []bool{false, true} {
+		root := filepath.Join(tmp, "clone")
+		if inRepo {
+			root = filepath.Join(tmp, "super")
+		}
+		if err := os.Mkdir(root, 0755); err != nil {
+			t.Fatalf("expected nil error, got %#v", err)
+		}
+		if inRepo {
+			git(t, root, "init", "--quiet")
+		}
+		t.Logf("in a Git repo: %t", inRepo)
+
+		var (
+			g      = gen.GitModule{Remote: app, Local: "dep", Revision: "master"}
+			nested = filepath.Join(root, "dep", "lib")
+		)
+
+		// A missing module is checked out with its nested
+		// submodules.
+		st, err := g.Check(root)
+		check(st, err, gen.DriftMissing)
+		st, err = g.Operate(root)
+		check(st, err, gen.DriftMissing)
+		if st.Commit != pinned || st.Expected != pinned {
+			t.Errorf("expected %s to be checked out, got %#v", pinned, st)
+		}
+		checkFile(filepath.Join(nested, "f"), "v1")
+
+		st, err = g.Check(root)
+		check(st, err, 0)
+
+		// Nested submodules are updated.
+		git(t, nested, "checkout", "--quiet", "master")
+		st, err = g.Check(root)
+		check(st, err, gen.DriftSubmodules)
+		st, err = g.Operate(root)
+		check(st, err, gen.DriftSubmodules)
+		checkFile(filepath.Join(nested, "f"), "v1")
+
+		// A Revision which isn't known locally is fetched, and
+		// replaces the commit which is checked out.
+		g.Revision = pinned
+		writeFile(t, app, "f", "app2")
+		git(t, app, "commit", "--quiet", "-am", "app2")
+		moved := gen.GitModule{
+			Remote: app, Local: "dep", Revision: git(t, app, "rev-parse", "HEAD"),
+		}
+		st, err = moved.Operate(root)
+		check(st, err, gen.DriftCommit)
+		checkFile(filepath.Join(root, "dep", "f"), "app2")
+
+		st, err = g.Operate(root)
+		check(st, err, gen.DriftCommit)
+		checkFile(filepath.Join(root, "dep", "f"), "app")
+
+		// Local modifications are kept, unless the checkout has to
+		// move, which requires Overwrite.
+		writeFile(t, root, "dep/f", "mod")
+		st, err = g.Operate(root)
+		check(st, err, gen.DriftModified)
+		checkFile(filepath.Join(root, "dep", "f"), "mod")
+
+		_, err = moved.Operate(root)
+		if err == nil || !strings.Contains(err.Error(), "dep has local modifications") {
+			t.Errorf("expected an error about local modifications, got %#v", err)
+		}
+
+		moved.Overwrite = true
+		st, err = moved.Operate(root)
+		check(st, err, gen.DriftCommit|gen.DriftModified)
+		checkFile(filepath.Join(root, "dep", "f"), "app2")
+
+		g.Overwrite = true
+		st, err = g.Operate(root)
+		check(st, err, gen.DriftCommit)
+		checkFile(filepath.Join(root, "dep", "f"), "app")
+
+		// An unknown revision is an error.
+		g.Revision = "nope"
+		_, err = g.Operate(root)
+		if err == nil || !strings.Contains(err.Error(), "no revision nope in") {
+			t.Errorf("expected an error about revision nope, got %#v", err)
+		}
+		git(t, app, "reset", "--quiet", "--hard", pinned)
+
+		if !inRepo {
+			continue
+		}
+
+		// A submodule in a new clone of the repo is initialized.
+		git(t, root, "commit", "--quiet", "-m", "super")
+		git(t, tmp, "clone", "--quiet", root, "super2")
+		g.Revision = pinned
+		root2 := filepath.Join(tmp, "super2")
+		st, err = g.Check(root2)
+		check(st, err, gen.DriftUninitialized)
+		st, err = g.Operate(root2)
+		check(st, err, gen.DriftUninitialized)
+		checkFile(filepath.Join(root2, "dep", "lib", "f"), "v1")
+	}
+}
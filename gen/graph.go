@@ -0,0 +1,270 @@
+package gen
+
+import (
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/phoenix-engine/phx/fs"
+	"github.com/phoenix-engine/phx/gen/compress"
+	"github.com/phoenix-engine/phx/gen/cpp"
+	"github.com/phoenix-engine/phx/path"
+
+	"github.com/pkg/errors"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// Graph describes a set of named Pipelines, each of which feeds the
+// resources it matches into one of a set of named Targets.  Each
+// Target is operated as a Gen whose Sources are its Pipelines, and all
+// Targets are operated concurrently.
+//
+// A Graph is usually read from a project file using ReadGraph:
+//
+//	targets:
+//	  assets:
+//	    to: gen
+//	pipelines:
+//	  textures:
+//	    from: res
+//	    match: ["textures/**/*.png"]
+//	    level: 9
+//	    max_ratio: 0.9
+//	    target: assets
+//	  shaders:
+//	    from: res
+//	    match: ["shaders/*"]
+//	    target: assets
+type Graph struct {
+	Targets   map[string]GraphTarget `yaml:"targets"`
+	Pipelines map[string]Pipeline    `yaml:"pipelines"`
+}
+
+// GraphTarget is an output of a Graph.  Kind selects the Encoder, Arch
+// the architecture of KindELF, Encoding and ChunkSize the arrays of
+// KindCpp, Format the formatting of the generated source, Naming its
+// identifiers and namespaces, Templates the directory of templates
+// overriding the built-in ones, and Disambiguate the handling of
+// colliding names, as in Gen.
+type GraphTarget struct {
+	To           string     `yaml:"to"`
+	Kind         string     `yaml:"kind"`
+	Arch         string     `yaml:"arch"`
+	Encoding     string     `yaml:"encoding"`
+	ChunkSize    int64      `yaml:"chunk_size"`
+	Format       cpp.Format `yaml:"format"`
+	Naming       cpp.Naming `yaml:"naming"`
+	Templates    string     `yaml:"templates"`
+	Disambiguate bool       `yaml:"disambiguate"`
+}
+
+// Pipeline selects the files under From which match any of the Match
+// globs (or all files, if there are none), compresses them using Codec
+// at Level, and feeds them into the named Target.  Codec is the name of
+// a registered compress.Codec, and defaults to compress.DefaultCodec.
+// Level is the numeric level used by "phx gen --level".  Resources which
+// don't compress to under MaxRatio of their size are stored
+// uncompressed; a MaxRatio of 0 disables this.
+type Pipeline struct {
+	From   string   `yaml:"from"`
+	Match  []string `yaml:"match"`
+	Codec  string   `yaml:"codec"`
+	Level  int      `yaml:"level"`
+	Target string   `yaml:"target"`
+
+	// MaxRatio is the MaxRatio of the Source.  If it is not set,
+	// DefaultMaxRatio is used.
+	MaxRatio *float64 `yaml:"max_ratio"`
+}
+
+// ReadGraph decodes a Graph from YAML.
+func ReadGraph(from io.Reader) (Graph, error) {
+	var g Graph
+
+	bs, err := ioutil.ReadAll(from)
+	if err != nil {
+		return g, errors.Wrap(err, "reading graph")
+	}
+
+	if err := yaml.UnmarshalStrict(bs, &g); err != nil {
+		return g, errors.Wrap(err, "decoding graph")
+	}
+
+	return g, nil
+}
+
+// Gens validates the Graph and returns a Gen for each of its Targets,
+// ordered by Target name.  The Sources of each Gen are ordered by
+// Pipeline name.  Relative paths in the Graph are relative to root.
+func (g Graph) Gens(root string) ([]Gen, error) {
+	var (
+		sources = make(map[string][]Source)
+		pnames  []string
+		tnames  []string
+	)
+
+	for name := range g.Pipelines {
+		pnames = append(pnames, name)
+	}
+	sort.Strings(pnames)
+
+	for _, name := range pnames {
+		p := g.Pipelines[name]
+
+		if _, ok := g.Targets[p.Target]; !ok {
+			return nil, errors.Errorf("pipeline %s: unknown target %q",
+				name, p.Target)
+		}
+
+		src, err := p.source(root)
+		if err != nil {
+			return nil, errors.Wrapf(err, "pipeline %s", name)
+		}
+
+		sources[p.Target] = append(sources[p.Target], src)
+	}
+
+	for name := range g.Targets {
+		tnames = append(tnames, name)
+	}
+	sort.Strings(tnames)
+
+	var (
+		gens []Gen
+		tos  = make(map[string]string)
+	)
+	for _, name := range tnames {
+		t := g.Targets[name]
+
+		var tmps fs.FS
+		if t.Templates != "" {
+			tmps = fs.Real{Where: under(root, t.Templates)}
+		}
+
+		tg := Gen{
+			Kind:      t.Kind,
+			Arch:      t.Arch,
+			Encoding:  t.Encoding,
+			ChunkSize: t.ChunkSize,
+			Format:    t.Format,
+			Naming:    t.Naming,
+			Templates: tmps,
+		}
+		if _, err := tg.encoder(nil, nil); err != nil {
+			return nil, errors.Wrapf(err, "target %s", name)
+		}
+
+		to := under(root, t.To)
+		if other, ok := tos[to]; ok {
+			return nil, errors.Errorf("targets %s and %s both write to %s",
+				other, name, t.To)
+		}
+		tos[to] = name
+
+		if len(sources[name]) == 0 {
+			return nil, errors.Errorf("target %s has no pipelines", name)
+		}
+
+		// The C++ runtime of a target decodes a single codec,
+		// besides uncompressed resources.
+		var (
+			none  = compress.NoMaker{}.Name()
+			codec = none
+		)
+		for _, src := range sources[name] {
+			switch c := src.Maker.Name(); {
+			case c == none, c == codec:
+			case codec == none:
+				codec = c
+			default:
+				return nil, errors.Errorf(
+					"target %s: pipelines use codecs %q and %q",
+					name, codec, c)
+			}
+		}
+		if _, err := cpp.RuntimeFor(codec); err != nil {
+			return nil, errors.Wrapf(err, "target %s", name)
+		}
+
+		gens = append(gens, Gen{
+			Sources:   sources[name],
+			To:        fs.Real{Where: to},
+			Kind:      t.Kind,
+			Arch:      t.Arch,
+			Encoding:  t.Encoding,
+			ChunkSize: t.ChunkSize,
+			Format:    t.Format,
+			Naming:    t.Naming,
+			Templates: tmps,
+
+			Disambiguate: t.Disambiguate,
+		})
+	}
+
+	return gens, nil
+}
+
+func (p Pipeline) source(root string) (Source, error) {
+	var src Source
+
+	codec, err := compress.Lookup(p.Codec)
+	if err != nil {
+		return src, err
+	}
+
+	var matcher path.Matcher = matchAll{}
+	if len(p.Match) > 0 {
+		if matcher, err = path.MakeGlob(p.Match...); err != nil {
+			return src, err
+		}
+	}
+
+	maxRatio := DefaultMaxRatio
+	if p.MaxRatio != nil {
+		maxRatio = *p.MaxRatio
+	}
+
+	return Source{
+		From:     fs.Real{Where: under(root, p.From)},
+		Matcher:  matcher,
+		Maker:    codec.Maker(compress.LevelFromInt(p.Level)),
+		MaxRatio: maxRatio,
+	}, nil
+}
+
+// under returns p relative to root, unless it is absolute.
+func under(root, p string) string {
+	if filepath.IsAbs(p) {
+		return p
+	}
+	return filepath.Join(root, p)
+}
+
+type matchAll struct{}
+
+func (matchAll) Match(string) bool { return true }
+
+// OperateGraph operates each of the given Gens concurrently, and
+// returns all of their errors together.
+func OperateGraph(gens []Gen) error {
+	errs := make(chan error)
+	for _, g := range gens {
+		go func(g Gen) {
+			errs <- errors.Wrapf(g.Operate(), "generating %s", g.To)
+		}(g)
+	}
+
+	var msgs []string
+	for range gens {
+		if err := <-errs; err != nil {
+			msgs = append(msgs, err.Error())
+		}
+	}
+
+	if msgs == nil {
+		return nil
+	}
+	return errors.New(strings.Join(msgs, "; "))
+}
@@ -0,0 +1,219 @@
+package gen_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/phoenix-engine/phx/gen"
+	"github.com/phoenix-engine/phx/gen/compress"
+	pt "github.com/phoenix-engine/phx/testing"
+)
+
+func TestGraphGens(t *testing.T) {
+	for i, test := range []struct {
+		should    string
+		given     string
+		expectLen int
+		expectErr string
+	}{{
+		should: "make one Gen per target",
+		given: `
+targets:
+  a: {to: gen/a}
+  b: {to: gen/b}
+pipelines:
+  one: {from: res, target: a}
+  two: {from: res, target: b, match: ["*.png"]}
+  three: {from: res, target: b, match: ["*.glsl"], level: 9}
+`,
+		expectLen: 2,
+	}, {
+		should: "reject an unknown field",
+		given: `
+pipelines:
+  one: {from: res, target: a, nope: 1}
+`,
+		expectErr: "decoding graph",
+	}, {
+		should: "reject an unknown target",
+		given: `
+targets:
+  a: {to: gen}
+pipelines:
+  one: {from: res, target: b}
+`,
+		expectErr: `unknown target "b"`,
+	}, {
+		should: "accept a pack target",
+		given: `
+targets:
+  a: {to: gen, kind: pack}
+pipelines:
+  one: {from: res, target: a}
+`,
+		expectLen: 1,
+	}, {
+		should: "reject an unknown kind",
+		given: `
+targets:
+  a: {to: gen, kind: nope}
+pipelines:
+  one: {from: res, target: a}
+`,
+		expectErr: `target a: unknown kind "nope"`,
+	}, {
+		should: "reject an unsupported architecture",
+		given: `
+targets:
+  a: {to: gen, kind: elf, arch: mips}
+pipelines:
+  one: {from: res, target: a}
+`,
+		expectErr: `target a: unsupported architecture "mips"`,
+	}, {
+		should: "reject an unknown codec",
+		given: `
+targets:
+  a: {to: gen}
+pipelines:
+  one: {from: res, target: a, codec: nope}
+`,
+		expectErr: `unknown codec "nope"`,
+	}, {
+		should: "accept a registered codec",
+		given: `
+targets:
+  a: {to: gen}
+pipelines:
+  one: {from: res, target: a, codec: deflate}
+  two: {from: res, target: a, codec: deflate, level: 9}
+`,
+		expectLen: 1,
+	}, {
+		should: "accept uncompressed pipelines alongside a codec",
+		given: `
+targets:
+  a: {to: gen}
+pipelines:
+  one: {from: res, target: a, codec: none}
+  two: {from: res, target: a, codec: deflate, max_ratio: 0.5}
+`,
+		expectLen: 1,
+	}, {
+		should: "reject mixed codecs in one target",
+		given: `
+targets:
+  a: {to: gen}
+pipelines:
+  one: {from: res, target: a, codec: lz4}
+  two: {from: res, target: a, codec: deflate}
+`,
+		expectErr: `target a: pipelines use codecs "lz4" and "deflate"`,
+	}, {
+		should: "reject two targets writing to the same place",
+		given: `
+targets:
+  a: {to: gen}
+  b: {to: ./gen}
+pipelines:
+  one: {from: res, target: a}
+  two: {from: res, target: b}
+`,
+		expectErr: "targets a and b both write to",
+	}, {
+		should: "reject a target without pipelines",
+		given: `
+targets:
+  a: {to: gen}
+`,
+		expectErr: "target a has no pipelines",
+	}, {
+		should: "reject a missing template directory",
+		given: `
+targets:
+  a: {to: gen, templates: tmpl}
+pipelines:
+  one: {from: res, target: a}
+`,
+		expectErr: "target a: loading templates: reading templates",
+	}, {
+		should: "reject templates for a pack target",
+		given: `
+targets:
+  a: {to: gen, kind: pack, templates: tmpl}
+pipelines:
+  one: {from: res, target: a}
+`,
+		expectErr: `target a: templates do not apply to kind "pack"`,
+	}} {
+		t.Logf("test %d: should %s", i, test.should)
+
+		g, err := gen.ReadGraph(strings.NewReader(test.given))
+		if err == nil {
+			var gens []gen.Gen
+			gens, err = g.Gens("root")
+			if err == nil {
+				pt.CheckEq(t, len(gens), test.expectLen)
+			}
+		}
+
+		pt.CheckErrMatches(t, err, test.expectErr)
+	}
+}
+
+func TestOperateGraph(t *testing.T) {
+	root, rm := makeTree(t, map[string]string{
+		"res/textures/a.png": "texture",
+		"res/shaders/a.glsl": "shader",
+		"res/other.txt":      "other",
+	})
+	defer rm()
+
+	g, err := gen.ReadGraph(strings.NewReader(`
+targets:
+  assets: {to: gen}
+pipelines:
+  textures: {from: res, match: ["textures/**"], level: 9, target: assets}
+  shaders: {from: res, match: ["shaders/*"], target: assets}
+`))
+	if err != nil {
+		t.Fatalf("expected nil error, got %#v", err)
+	}
+
+	gens, err := g.Gens(root)
+	if err != nil {
+		t.Fatalf("expected nil error, got %#v", err)
+	}
+
+	if err := gen.OperateGraph(gens); err != nil {
+		t.Fatalf("expected nil error, got %#v", err)
+	}
+
+	m, err := gen.ReadManifest(gens[0].To)
+	if err != nil {
+		t.Fatalf("expected nil error, got %#v", err)
+	}
+
+	levels := make(map[string]compress.Level)
+	for _, e := range m.Resources {
+		levels[e.Name] = e.Level
+	}
+	pt.CheckEq(t, len(levels), 2)
+	pt.CheckEq(t, levels["textures/a.png"], compress.LZ4HC)
+	pt.CheckEq(t, levels["shaders/a.glsl"], compress.Fastest)
+
+	bs, err := ioutil.ReadFile(filepath.Join(root, "gen", "id.hpp"))
+	if err != nil {
+		t.Fatalf("expected nil error, got %#v", err)
+	}
+	if strings.Contains(string(bs), "other_txt") {
+		t.Errorf("expected unmatched other.txt to be left out")
+	}
+
+	if _, err := os.Stat(filepath.Join(root, "gen", "res", "textures")); err != nil {
+		t.Errorf("expected nil error, got %#v", err)
+	}
+}
@@ -3,16 +3,22 @@ package gen
 import (
 	"io"
 
-	"github.com/phoenix-engine/phx/fs"
 	"github.com/phoenix-engine/phx/gen/compress"
 
 	"github.com/pkg/errors"
 )
 
-type Job struct{ Name string }
+// Job is a resource to be processed from the given Source.
+type Job struct {
+	Name string
+	Source
+}
 type Done struct {
 	Name                 string
 	Size, CompressedSize int64
+
+	// Codec is the name of the codec the resource was stored with.
+	Codec string
 }
 
 func MakeChans() (chan Job, chan Done, chan struct{}, chan error) {
@@ -23,8 +29,6 @@ func MakeChans() (chan Job, chan Done, chan struct{}, chan error) {
 }
 
 type Work struct {
-	from fs.FS
-
 	Jobs <-chan Job
 	Done chan<- Done
 	Kill <-chan struct{}
@@ -46,7 +50,7 @@ func (w Work) Run() {
 				return
 			}
 
-			done, err := w.Process(j.Name)
+			done, err := w.Process(j)
 			if err != nil {
 				select {
 				case w.Errs <- err:
@@ -64,16 +68,36 @@ func (w Work) Run() {
 	}
 }
 
-// Process encodes the file into a buffer using LZ4 and returns it.
-// When it is finished, the finished file is in w.tmp.
-func (w Work) Process(path string) (none Done, err error) {
-	ff, err := w.from.Open(path)
+// Process encodes the Job's file using the Encoder, compressing it with
+// the Maker of the Job's Source.  If it doesn't compress well enough for
+// the Source's MaxRatio, it is encoded again uncompressed, replacing the
+// compressed output.
+func (w Work) Process(j Job) (none Done, err error) {
+	done, err := w.encode(j, j.Maker)
+	if err != nil {
+		return none, err
+	}
+
+	if j.MaxRatio > 0 && done.Codec != (compress.NoMaker{}).Name() &&
+		float64(done.CompressedSize) >= j.MaxRatio*float64(done.Size) {
+		return w.encode(j, compress.NoMaker{})
+	}
+	return done, nil
+}
+
+// encode encodes the Job's file using the Encoder, compressing it with
+// the given Maker.
+func (w Work) encode(j Job, maker compress.Maker) (none Done, err error) {
+	path := j.Name
+
+	ff, err := j.From.Open(path)
 	if err != nil {
 		return none, errors.Wrapf(err, "opening %s", path)
 	}
 
-	out, err := w.Encoder.Create(path)
+	out, err := w.Encoder.Create(path, maker)
 	if err != nil {
+		ff.Close()
 		return none, errors.Wrapf(err, "opening tempfile %s", path)
 	}
 
@@ -94,7 +118,7 @@ func (w Work) Process(path string) (none Done, err error) {
 		return none, errors.Wrapf(err, "flushing compressor from %s", path)
 	}
 
-	done := Done{Name: path, Size: n}
+	done := Done{Name: path, Size: n, Codec: maker.Name()}
 
 	// Check for a compression counter.
 	if c, ok := out.(compress.Counter); ok {
@@ -0,0 +1,261 @@
+package gen
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"os"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/phoenix-engine/phx/fs"
+	"github.com/phoenix-engine/phx/gen/compress"
+	"github.com/phoenix-engine/phx/gen/cpp"
+
+	"github.com/pkg/errors"
+)
+
+// Version is the version of phx.  Generated output is only reused when
+// it was created by the same version.
+const Version = "0.1.0"
+
+// ManifestName is the name of the manifest file written into the root
+// of the Gen output.
+const ManifestName = ".phx-manifest.json"
+
+// Manifest records the inputs and settings used to generate each
+// resource in the Gen output, so that unchanged resources can be
+// skipped on the next run.
+type Manifest struct {
+	Version   string          `json:"version"`
+	Resources []ManifestEntry `json:"resources"`
+
+	// Files are all of the files the Gen owns in its output, other
+	// than the manifest itself.
+	Files []string `json:"files,omitempty"`
+}
+
+// ManifestEntry describes a single resource in a Manifest.
+type ManifestEntry struct {
+	// Name is the slash-separated path of the resource relative to
+	// the Gen input.
+	Name string `json:"name"`
+
+	Size           int64  `json:"size"`
+	CompressedSize int64  `json:"compressed_size"`
+	Hash           string `json:"hash"`
+
+	Codec    string         `json:"codec"`
+	Level    compress.Level `json:"level"`
+	MaxRatio float64        `json:"max_ratio,omitempty"`
+
+	// Kind, Arch, Encoding and ChunkSize are the settings of the
+	// Gen's Encoder.
+	Kind      string `json:"kind,omitempty"`
+	Arch      string `json:"arch,omitempty"`
+	Encoding  string `json:"encoding,omitempty"`
+	ChunkSize int64  `json:"chunk_size,omitempty"`
+
+	// Namespace is the root namespace of the Gen's Naming, which the
+	// declarations of the resource are in.
+	Namespace string `json:"namespace,omitempty"`
+
+	// Templates is the Sum of the templates which overrode the
+	// built-in templates, if there were any.
+	Templates string `json:"templates,omitempty"`
+
+	// Format is the formatting profile of the generated source, if
+	// it is not the default.
+	Format *cpp.Format `json:"format,omitempty"`
+
+	// Stored is the codec the resource was actually stored with, if
+	// it is not Codec.
+	Stored string `json:"stored,omitempty"`
+
+	// Outputs are the files the Encoder created for the resource,
+	// relative to the Gen output.
+	Outputs []string `json:"outputs,omitempty"`
+}
+
+// Unchanged returns true if the resource described by e can be reused
+// in place of the one described by from.  Only the inputs and settings
+// are compared.
+func (e ManifestEntry) Unchanged(from ManifestEntry) bool {
+	return e.Name == from.Name &&
+		e.Size == from.Size &&
+		e.Hash == from.Hash &&
+		e.Codec == from.Codec &&
+		e.Level == from.Level &&
+		e.MaxRatio == from.MaxRatio &&
+		e.Kind == from.Kind &&
+		e.Arch == from.Arch &&
+		e.Encoding == from.Encoding &&
+		e.ChunkSize == from.ChunkSize &&
+		e.Namespace == from.Namespace &&
+		e.Templates == from.Templates &&
+		e.format() == from.format()
+}
+
+func (e ManifestEntry) format() cpp.Format {
+	if e.Format == nil {
+		return cpp.Format{}
+	}
+	return *e.Format
+}
+
+// StoredCodec returns the codec the resource was stored with.
+func (e ManifestEntry) StoredCodec() string {
+	if e.Stored != "" {
+		return e.Stored
+	}
+	return e.Codec
+}
+
+// Lookup returns a map of the Manifest's entries by name.  If the
+// Manifest was written by a different Version, the map is empty.
+func (m Manifest) Lookup() map[string]ManifestEntry {
+	entries := make(map[string]ManifestEntry)
+	if m.Version != Version {
+		return entries
+	}
+
+	for _, e := range m.Resources {
+		entries[e.Name] = e
+	}
+	return entries
+}
+
+// Owned returns the set of files owned according to the Manifest.  If
+// it has no Files, the Outputs of its Resources are used.
+func (m Manifest) Owned() map[string]bool {
+	owned := make(map[string]bool)
+	for _, f := range m.Files {
+		owned[f] = true
+	}
+	for _, e := range m.Resources {
+		for _, out := range e.Outputs {
+			owned[out] = true
+		}
+	}
+	return owned
+}
+
+// finalized returns the Files which are not Outputs of any resource.
+func (m Manifest) finalized() []string {
+	outputs := make(map[string]bool)
+	for _, e := range m.Resources {
+		for _, out := range e.Outputs {
+			outputs[out] = true
+		}
+	}
+
+	var files []string
+	for _, f := range m.Files {
+		if !outputs[f] {
+			files = append(files, f)
+		}
+	}
+	return files
+}
+
+// Stale returns the files owned according to m which are not owned
+// according to next, in lexical order.  Paths which would leave the
+// output directory are never returned.
+func (m Manifest) Stale(next Manifest) []string {
+	var (
+		keep  = next.Owned()
+		stale []string
+	)
+
+	for f := range m.Owned() {
+		switch {
+		case keep[f], f == ManifestName:
+		case path.IsAbs(f), f == "..", strings.HasPrefix(f, "../"):
+		case path.Clean(f) != f:
+		default:
+			stale = append(stale, f)
+		}
+	}
+
+	sort.Strings(stale)
+	return stale
+}
+
+// ReadManifest reads the Manifest from the root of the given FS.  If it
+// does not exist, an empty Manifest is returned.
+func ReadManifest(from fs.FS) (Manifest, error) {
+	var m Manifest
+
+	f, err := from.Open(ManifestName)
+	switch {
+	case os.IsNotExist(errors.Cause(err)):
+		return m, nil
+	case err != nil:
+		return m, errors.Wrapf(err, "opening %s", ManifestName)
+	}
+
+	if err := json.NewDecoder(f).Decode(&m); err != nil {
+		f.Close()
+		return m, errors.Wrapf(err, "decoding %s", ManifestName)
+	}
+
+	return m, errors.Wrapf(f.Close(), "closing %s", ManifestName)
+}
+
+// WriteManifest writes the Manifest into the root of the given FS.  Its
+// entries are sorted by name so the output is stable, and its Files are
+// sorted and listed once each, since resources may share an output.
+func WriteManifest(into fs.FS, m Manifest) error {
+	sort.Slice(m.Resources, func(i, j int) bool {
+		return m.Resources[i].Name < m.Resources[j].Name
+	})
+	sort.Strings(m.Files)
+	var files []string
+	for _, f := range m.Files {
+		if len(files) == 0 || f != files[len(files)-1] {
+			files = append(files, f)
+		}
+	}
+	m.Files = files
+
+	bs, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return errors.Wrap(err, "encoding manifest")
+	}
+
+	f, err := into.Create(ManifestName)
+	if err != nil {
+		return errors.Wrapf(err, "creating %s", ManifestName)
+	}
+
+	if _, err := f.Write(append(bs, '\n')); err != nil {
+		f.Close()
+		return errors.Wrapf(err, "writing %s", ManifestName)
+	}
+
+	return errors.Wrapf(f.Close(), "closing %s", ManifestName)
+}
+
+// HashFile returns the size and hex-encoded SHA-256 hash of the named
+// file in the given FS.
+func HashFile(from fs.FS, name string) (int64, string, error) {
+	f, err := from.Open(name)
+	if err != nil {
+		return 0, "", errors.Wrapf(err, "opening %s", name)
+	}
+
+	h := sha256.New()
+	n, err := io.Copy(h, f)
+	if err != nil {
+		f.Close()
+		return 0, "", errors.Wrapf(err, "hashing %s", name)
+	}
+
+	if err := f.Close(); err != nil {
+		return 0, "", errors.Wrapf(err, "closing %s", name)
+	}
+
+	return n, hex.EncodeToString(h.Sum(nil)), nil
+}
@@ -0,0 +1,141 @@
+package gen_test
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/phoenix-engine/phx/fs"
+	"github.com/phoenix-engine/phx/gen"
+)
+
+func TestManifestRoundTrip(t *testing.T) {
+	mem := fs.MakeMem()
+	m := gen.Manifest{
+		Version: gen.Version,
+		Resources: []gen.ManifestEntry{
+			{Name: "b.txt", Size: 2, Hash: "bb", Codec: "lz4"},
+			{Name: "a.txt", Size: 1, Hash: "aa", Codec: "lz4"},
+		},
+	}
+
+	if err := gen.WriteManifest(mem, m); err != nil {
+		t.Fatalf("expected nil error, got %#v", err)
+	}
+
+	got, err := gen.ReadManifest(mem)
+	if err != nil {
+		t.Fatalf("expected nil error, got %#v", err)
+	}
+
+	if !reflect.DeepEqual(got, m) {
+		t.Errorf("expected %#v, got %#v", m, got)
+	}
+	if got.Resources[0].Name != "a.txt" {
+		t.Errorf("expected entries sorted by name, got %#v", got)
+	}
+
+	got.Version = "0.0.0"
+	if l := got.Lookup(); len(l) != 0 {
+		t.Errorf("expected no entries from another version, got %#v", l)
+	}
+
+	// Files shared by resources are listed once.
+	m.Files = []string{"res.pack", "a", "res.pack"}
+	if err := mem.Remove(gen.ManifestName); err != nil {
+		t.Fatalf("expected nil error, got %#v", err)
+	}
+	if err := gen.WriteManifest(mem, m); err != nil {
+		t.Fatalf("expected nil error, got %#v", err)
+	}
+	if got, err = gen.ReadManifest(mem); err != nil {
+		t.Fatalf("expected nil error, got %#v", err)
+	}
+	if expect := []string{"a", "res.pack"}; !reflect.DeepEqual(got.Files, expect) {
+		t.Errorf("expected files %#v, got %#v", expect, got.Files)
+	}
+}
+
+func TestGenIncremental(t *testing.T) {
+	from, rmFrom := makeTree(t, map[string]string{
+		"a.txt": "some text",
+		"b.txt": "more text",
+	})
+	defer rmFrom()
+	to, rmTo := makeTree(t, nil)
+	defer rmTo()
+
+	if err := makeGen(from, to).Operate(); err != nil {
+		t.Fatalf("expected nil error, got %#v", err)
+	}
+
+	// Backdate the outputs so any rewrite is detectable.
+	past := time.Now().Add(-time.Hour)
+	for _, name := range []string{
+		"res/a_txt_real.cxx", "res/b_txt_real.cxx", "mapper.hpp",
+	} {
+		p := filepath.Join(to, name)
+		if err := os.Chtimes(p, past, past); err != nil {
+			t.Fatalf("expected nil error, got %#v", err)
+		}
+	}
+
+	writeFile(t, from, "b.txt", "changed text")
+
+	if err := makeGen(from, to).Operate(); err != nil {
+		t.Fatalf("expected nil error, got %#v", err)
+	}
+
+	for name, expectTouched := range map[string]bool{
+		"res/a_txt_real.cxx": false,
+		"res/b_txt_real.cxx": true,
+		"mapper.hpp":         false,
+	} {
+		fi, err := os.Stat(filepath.Join(to, name))
+		if err != nil {
+			t.Fatalf("expected nil error, got %#v", err)
+		}
+		if touched := fi.ModTime().After(past); touched != expectTouched {
+			t.Errorf("%s: expected touched %t, got %t",
+				name, expectTouched, touched)
+		}
+	}
+
+	m, err := gen.ReadManifest(fs.Real{Where: to})
+	if err != nil {
+		t.Fatalf("expected nil error, got %#v", err)
+	}
+	if len(m.Resources) != 2 || m.Resources[1].Size != 12 {
+		t.Errorf("unexpected manifest %#v", m)
+	}
+}
+
+func TestManifestStale(t *testing.T) {
+	for i, test := range []struct {
+		given, next gen.Manifest
+		expect      []string
+	}{{
+		given:  gen.Manifest{Files: []string{"a", "b", gen.ManifestName}},
+		next:   gen.Manifest{Files: []string{"a"}},
+		expect: []string{"b"},
+	}, {
+		given: gen.Manifest{Resources: []gen.ManifestEntry{{
+			Name: "x", Outputs: []string{"res/x_real.cxx"},
+		}}},
+		next:   gen.Manifest{},
+		expect: []string{"res/x_real.cxx"},
+	}, {
+		given: gen.Manifest{Files: []string{
+			"../outside", "/abs", "res/../a", "res/ok",
+		}},
+		next: gen.Manifest{Resources: []gen.ManifestEntry{{
+			Name: "ok", Outputs: []string{"res/ok"},
+		}}},
+	}} {
+		if got := test.given.Stale(test.next); !reflect.DeepEqual(got, test.expect) {
+			t.Errorf("%d: expected %#v, got %#v", i, test.expect, got)
+		}
+	}
+}
@@ -0,0 +1,133 @@
+// Package pack implements a binary resource pack: a single indexed file
+// containing the compressed content of many resources.  Target writes
+// packs as a gen Encoder, along with a C++ loader, and Reader reads them.
+//
+// All integers in a pack are little-endian.  A pack begins with a
+// Header, which is followed by a table of contents of one fixed-size
+// Entry per resource, the string table holding their names and codecs,
+// and finally the stored content of each resource.
+package pack
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+
+	"github.com/pkg/errors"
+)
+
+// Magic identifies a pack.
+const Magic = "PHXPACK\x00"
+
+// Version is the version of the pack format.
+const Version = 1
+
+// Sizes of the fixed-size parts of a pack.
+const (
+	HeaderSize = 32
+	EntrySize  = 48
+)
+
+// Name is the name of the pack file written by Target.
+const Name = "res.pack"
+
+// Header is the first part of a pack.
+//
+//	magic       [8]byte
+//	version     uint32
+//	count       uint32  number of entries
+//	stringsLen  uint64  length of the string table
+//	dataOffset  uint64  offset of the first stored resource
+type Header struct {
+	Count      uint32
+	StringsLen uint64
+	DataOffset uint64
+}
+
+// Entry describes a resource in a pack.  Strings are referred to by
+// their offset into the string table, where each is terminated by a
+// NUL byte which is not counted in its length.
+//
+//	offset      uint64  offset of the stored content in the pack
+//	storedSize  uint64  size of the stored content
+//	size        uint64  size of the content once decompressed
+//	nameOffset  uint32
+//	nameLen     uint32
+//	codecOffset uint32
+//	codecLen    uint32
+//	id          uint32  index of the resource in the generated ID enum
+//	reserved    uint32
+type Entry struct {
+	Name, Codec string
+
+	ID                      uint32
+	Offset, StoredSize      uint64
+	Size                    uint64
+	nameOffset, codecOffset uint32
+}
+
+// layout assigns the string and data offsets of the entries, and
+// returns the Header and string table for them.  The stored content
+// follows the string table, in the order of the entries.
+func layout(entries []Entry) (Header, []byte) {
+	var (
+		strs    bytes.Buffer
+		offsets = make(map[string]uint32)
+	)
+	intern := func(s string) uint32 {
+		if off, ok := offsets[s]; ok {
+			return off
+		}
+		off := uint32(strs.Len())
+		strs.WriteString(s)
+		strs.WriteByte(0)
+		offsets[s] = off
+		return off
+	}
+
+	for i := range entries {
+		entries[i].nameOffset = intern(entries[i].Name)
+		entries[i].codecOffset = intern(entries[i].Codec)
+	}
+
+	h := Header{
+		Count:      uint32(len(entries)),
+		StringsLen: uint64(strs.Len()),
+	}
+	h.DataOffset = HeaderSize + EntrySize*uint64(h.Count) + h.StringsLen
+
+	off := h.DataOffset
+	for i := range entries {
+		entries[i].Offset = off
+		off += entries[i].StoredSize
+	}
+
+	return h, strs.Bytes()
+}
+
+// writeIndex writes everything in a pack up to the stored content.
+func writeIndex(w io.Writer, h Header, entries []Entry, strs []byte) error {
+	buf := make([]byte, HeaderSize+EntrySize*len(entries), int(h.DataOffset))
+
+	copy(buf, Magic)
+	le := binary.LittleEndian
+	le.PutUint32(buf[8:], Version)
+	le.PutUint32(buf[12:], h.Count)
+	le.PutUint64(buf[16:], h.StringsLen)
+	le.PutUint64(buf[24:], h.DataOffset)
+
+	for i, e := range entries {
+		b := buf[HeaderSize+EntrySize*i:]
+		le.PutUint64(b[0:], e.Offset)
+		le.PutUint64(b[8:], e.StoredSize)
+		le.PutUint64(b[16:], e.Size)
+		le.PutUint32(b[24:], e.nameOffset)
+		le.PutUint32(b[28:], uint32(len(e.Name)))
+		le.PutUint32(b[32:], e.codecOffset)
+		le.PutUint32(b[36:], uint32(len(e.Codec)))
+		le.PutUint32(b[40:], e.ID)
+	}
+
+	_, err := w.Write(append(buf, strs...))
+	return errors.Wrap(err, "writing pack index")
+}
@@ -0,0 +1,298 @@
+package pack_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"io/ioutil"
+	"math"
+	"math/rand"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/phoenix-engine/phx/fs"
+	"github.com/phoenix-engine/phx/gen"
+	"github.com/phoenix-engine/phx/gen/compress"
+	"github.com/phoenix-engine/phx/gen/pack"
+	pt "github.com/phoenix-engine/phx/testing"
+)
+
+var _ = gen.Encoder(pack.Target{})
+
+// writePack encodes the given resources into a pack using a Target over
+// a memory FS, and returns the FS.
+func writePack(t *testing.T, resources map[string]string, using map[string]compress.Maker) fs.FS {
+	t.Helper()
+
+	mem := fs.MakeSyncMem()
+	tgt := pack.PrepareTarget(mem)
+
+	for name, content := range resources {
+		w, err := tgt.Create(name, using[name])
+		if err != nil {
+			t.Fatalf("expected nil error, got %#v", err)
+		}
+		if _, err := io.Copy(w, strings.NewReader(content)); err != nil {
+			t.Fatalf("expected nil error, got %#v", err)
+		}
+		if err := w.Close(); err != nil {
+			t.Fatalf("expected nil error, got %#v", err)
+		}
+	}
+
+	if err := tgt.Finalize(); err != nil {
+		t.Fatalf("expected nil error, got %#v", err)
+	}
+	return mem
+}
+
+func readAll(t *testing.T, f fs.FS, name string) []byte {
+	t.Helper()
+
+	r, err := f.Open(name)
+	if err != nil {
+		t.Fatalf("expected nil error, got %#v", err)
+	}
+	defer r.Close()
+
+	bs, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatalf("expected nil error, got %#v", err)
+	}
+	return bs
+}
+
+func TestTargetRoundTrip(t *testing.T) {
+	noise := make([]byte, 1000)
+	rand.New(rand.NewSource(1)).Read(noise)
+
+	resources := map[string]string{
+		"b.txt":        strings.Repeat("text ", 100),
+		"a/noise.bin":  string(noise),
+		"shaders/x.fs": "void main() {}",
+	}
+	mem := writePack(t, resources, map[string]compress.Maker{
+		"b.txt":        compress.DeflateMaker{},
+		"a/noise.bin":  compress.NoMaker{},
+		"shaders/x.fs": compress.DeflateMaker{Level: compress.High},
+	})
+
+	files, err := fs.Files(mem, "")
+	if err != nil {
+		t.Fatalf("expected nil error, got %#v", err)
+	}
+	pt.CheckEq(t, strings.Join(files, " "), strings.Join([]string{
+		".clang-format", ".gitignore", "CMakeLists.txt", "id.hpp",
+		"mapper.cxx", "mapper.hpp", "pack.cxx", "res.pack",
+		"resource.cxx", "resource.hpp",
+	}, " "))
+
+	bs := readAll(t, mem, pack.Name)
+	r, err := pack.NewReader(bytes.NewReader(bs), int64(len(bs)))
+	if err != nil {
+		t.Fatalf("expected nil error, got %#v", err)
+	}
+
+	// Entries are ordered by their C++ variable names, as in id.hpp.
+	var names []string
+	for i, e := range r.Entries() {
+		pt.CheckEq(t, e.ID, uint32(i))
+		names = append(names, e.Name)
+	}
+	pt.CheckEq(t, strings.Join(names, " "), "a/noise.bin b.txt shaders/x.fs")
+
+	for name, content := range resources {
+		rc, err := r.Open(name)
+		if err != nil {
+			t.Fatalf("%s: expected nil error, got %#v", name, err)
+		}
+		got, err := ioutil.ReadAll(rc)
+		if err != nil {
+			t.Fatalf("%s: expected nil error, got %#v", name, err)
+		}
+		rc.Close()
+
+		if string(got) != content {
+			t.Errorf("%s: expected content to round-trip", name)
+		}
+
+		e, _ := r.Lookup(name)
+		pt.CheckEq(t, e.Size, uint64(len(content)))
+	}
+
+	e, _ := r.Lookup("a/noise.bin")
+	pt.CheckEq(t, e.Codec, "none")
+	pt.CheckEq(t, e.StoredSize, e.Size)
+
+	if _, err := r.Open("nope"); !os.IsNotExist(err) {
+		t.Errorf("expected a not-exist error, got %#v", err)
+	}
+
+	id := string(readAll(t, mem, "id.hpp"))
+	if !strings.Contains(id, "a_noise_bin, // a/noise.bin") {
+		t.Errorf("unexpected id.hpp:\n%s", id)
+	}
+	loader := string(readAll(t, mem, "pack.cxx"))
+	if !strings.Contains(loader, "const uint32_t count      = 3;") {
+		t.Errorf("unexpected pack.cxx:\n%s", loader)
+	}
+	cmake := string(readAll(t, mem, "CMakeLists.txt"))
+	if !strings.Contains(cmake, "target_link_libraries(Resource ZLIB::ZLIB)") {
+		t.Errorf("unexpected CMakeLists.txt:\n%s", cmake)
+	}
+}
+
+func TestTargetReuse(t *testing.T) {
+	prev := writePack(t, map[string]string{
+		"a": strings.Repeat("text ", 100),
+		"b": "old",
+	}, map[string]compress.Maker{
+		"a": compress.LZ4Maker{},
+		"b": compress.LZ4Maker{},
+	})
+	bs := readAll(t, prev, pack.Name)
+	r, err := pack.NewReader(bytes.NewReader(bs), int64(len(bs)))
+	if err != nil {
+		t.Fatalf("expected nil error, got %#v", err)
+	}
+	a, _ := r.Lookup("a")
+
+	for i, test := range []struct {
+		should    string
+		reuse     pack.Entry
+		expectErr string
+	}{{
+		should: "copy a reused entry from the previous pack",
+		reuse:  a,
+	}, {
+		should:    "reject an entry missing from the previous pack",
+		reuse:     pack.Entry{Name: "c", Codec: "lz4"},
+		expectErr: "reusing c: not in the previous pack",
+	}, {
+		should: "reject an entry stored differently",
+		reuse: pack.Entry{Name: "a", Codec: "lz4",
+			Size: a.Size, StoredSize: a.StoredSize + 1},
+		expectErr: "reusing a: stored differently in the previous pack",
+	}} {
+		t.Logf("test %d: should %s", i, test.should)
+
+		mem := fs.MakeSyncMem()
+		tgt := pack.PrepareTarget(mem)
+		tgt.Prev = prev
+
+		e := test.reuse
+		tgt.Reuse(e.Name, e.Codec, int64(e.Size), int64(e.StoredSize))
+
+		w, err := tgt.Create("b", compress.LZ4Maker{})
+		if err != nil {
+			t.Fatalf("expected nil error, got %#v", err)
+		}
+		if _, err := io.WriteString(w, "new"); err != nil {
+			t.Fatalf("expected nil error, got %#v", err)
+		}
+		if err := w.Close(); err != nil {
+			t.Fatalf("expected nil error, got %#v", err)
+		}
+
+		err = tgt.Finalize()
+		pt.CheckErrMatches(t, err, test.expectErr)
+		if err != nil {
+			continue
+		}
+
+		bs := readAll(t, mem, pack.Name)
+		r, err := pack.NewReader(bytes.NewReader(bs), int64(len(bs)))
+		if err != nil {
+			t.Fatalf("expected nil error, got %#v", err)
+		}
+		for name, content := range map[string]string{
+			"a": strings.Repeat("text ", 100),
+			"b": "new",
+		} {
+			rc, err := r.Open(name)
+			if err != nil {
+				t.Fatalf("%s: expected nil error, got %#v", name, err)
+			}
+			got, err := ioutil.ReadAll(rc)
+			rc.Close()
+			if err != nil {
+				t.Fatalf("%s: expected nil error, got %#v", name, err)
+			}
+			pt.CheckEq(t, string(got), content)
+		}
+	}
+}
+
+func TestTargetMixedCodecs(t *testing.T) {
+	mem := fs.MakeSyncMem()
+	tgt := pack.PrepareTarget(mem)
+
+	for name, maker := range map[string]compress.Maker{
+		"a": compress.LZ4Maker{},
+		"b": compress.DeflateMaker{},
+	} {
+		w, err := tgt.Create(name, maker)
+		if err != nil {
+			t.Fatalf("expected nil error, got %#v", err)
+		}
+		if err := w.Close(); err != nil {
+			t.Fatalf("expected nil error, got %#v", err)
+		}
+	}
+
+	pt.CheckErrMatches(t, tgt.Finalize(), "all resources must use the same codec")
+}
+
+func TestNewReaderErrors(t *testing.T) {
+	mem := writePack(t, map[string]string{"a": "some text"},
+		map[string]compress.Maker{"a": compress.LZ4Maker{}})
+	good := readAll(t, mem, pack.Name)
+
+	for i, test := range []struct {
+		should    string
+		given     func([]byte) []byte
+		expectErr string
+	}{{
+		should: "read a good pack",
+		given:  func(bs []byte) []byte { return bs },
+	}, {
+		should:    "reject a bad magic number",
+		given:     func(bs []byte) []byte { bs[0] = 'X'; return bs },
+		expectErr: "not a pack",
+	}, {
+		should:    "reject another version",
+		given:     func(bs []byte) []byte { bs[8] = 9; return bs },
+		expectErr: "unsupported pack version 9",
+	}, {
+		should:    "reject a truncated index",
+		given:     func(bs []byte) []byte { return bs[:pack.HeaderSize+10] },
+		expectErr: "pack index is truncated",
+	}, {
+		should: "reject a string table length which overflows",
+		given: func(bs []byte) []byte {
+			binary.LittleEndian.PutUint64(bs[16:], math.MaxUint64-10)
+			return bs
+		},
+		expectErr: "pack index is truncated",
+	}, {
+		should: "reject an entry size which overflows",
+		given: func(bs []byte) []byte {
+			binary.LittleEndian.PutUint64(bs[pack.HeaderSize+8:], math.MaxUint64)
+			return bs
+		},
+		expectErr: "entry a is out of range",
+	}, {
+		should: "reject truncated content",
+		given: func(bs []byte) []byte {
+			return bs[:len(bs)-1]
+		},
+		expectErr: "entry a is out of range",
+	}} {
+		t.Logf("test %d: should %s", i, test.should)
+
+		bs := test.given(append([]byte(nil), good...))
+		_, err := pack.NewReader(bytes.NewReader(bs), int64(len(bs)))
+		pt.CheckErrMatches(t, err, test.expectErr)
+	}
+}
@@ -0,0 +1,172 @@
+package pack
+
+import (
+	"encoding/binary"
+	"io"
+	"os"
+
+	"github.com/phoenix-engine/phx/gen/compress"
+
+	"github.com/pkg/errors"
+)
+
+// Reader reads the resources in a pack.
+type Reader struct {
+	from    io.ReaderAt
+	entries []Entry
+	byName  map[string]int
+
+	closer io.Closer
+}
+
+// Open opens the pack file at the given path.  The Reader must be
+// closed when it is no longer needed.
+func Open(path string) (*Reader, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "opening %s", path)
+	}
+
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, errors.Wrapf(err, "checking %s", path)
+	}
+
+	r, err := NewReader(f, fi.Size())
+	if err != nil {
+		f.Close()
+		return nil, errors.Wrapf(err, "reading %s", path)
+	}
+
+	r.closer = f
+	return r, nil
+}
+
+// NewReader reads the index of the pack of the given size from the
+// ReaderAt.
+func NewReader(from io.ReaderAt, size int64) (*Reader, error) {
+	hdr := make([]byte, HeaderSize)
+	if _, err := from.ReadAt(hdr, 0); err != nil {
+		return nil, errors.Wrap(err, "reading pack header")
+	}
+
+	le := binary.LittleEndian
+	switch {
+	case string(hdr[:8]) != Magic:
+		return nil, errors.New("not a pack")
+	case le.Uint32(hdr[8:]) != Version:
+		return nil, errors.Errorf("unsupported pack version %d",
+			le.Uint32(hdr[8:]))
+	}
+
+	h := Header{
+		Count:      le.Uint32(hdr[12:]),
+		StringsLen: le.Uint64(hdr[16:]),
+		DataOffset: le.Uint64(hdr[24:]),
+	}
+	// The bounds are checked by subtraction, so they can't overflow.
+	tableLen := HeaderSize + EntrySize*uint64(h.Count)
+	if tableLen > uint64(size) || h.StringsLen > uint64(size)-tableLen {
+		return nil, errors.New("pack index is truncated")
+	}
+	indexLen := tableLen + h.StringsLen
+	if h.DataOffset < indexLen {
+		return nil, errors.New("pack index is truncated")
+	}
+
+	index := make([]byte, indexLen-HeaderSize)
+	if _, err := from.ReadAt(index, HeaderSize); err != nil {
+		return nil, errors.Wrap(err, "reading pack index")
+	}
+	strs := index[EntrySize*h.Count:]
+
+	str := func(off, n uint32) (string, error) {
+		if uint64(off)+uint64(n) >= uint64(len(strs)) {
+			return "", errors.New("string out of range")
+		}
+		return string(strs[off : off+n]), nil
+	}
+
+	r := &Reader{
+		from:    from,
+		entries: make([]Entry, h.Count),
+		byName:  make(map[string]int),
+	}
+	for i := range r.entries {
+		b := index[EntrySize*i:]
+		e := Entry{
+			Offset:      le.Uint64(b[0:]),
+			StoredSize:  le.Uint64(b[8:]),
+			Size:        le.Uint64(b[16:]),
+			nameOffset:  le.Uint32(b[24:]),
+			codecOffset: le.Uint32(b[32:]),
+			ID:          le.Uint32(b[40:]),
+		}
+
+		var err error
+		if e.Name, err = str(e.nameOffset, le.Uint32(b[28:])); err != nil {
+			return nil, errors.Wrapf(err, "reading entry %d", i)
+		}
+		if e.Codec, err = str(e.codecOffset, le.Uint32(b[36:])); err != nil {
+			return nil, errors.Wrapf(err, "reading entry %s", e.Name)
+		}
+		if e.Offset < h.DataOffset || e.Offset > uint64(size) ||
+			e.StoredSize > uint64(size)-e.Offset {
+			return nil, errors.Errorf("entry %s is out of range", e.Name)
+		}
+
+		r.entries[i] = e
+		r.byName[e.Name] = i
+	}
+
+	return r, nil
+}
+
+// Entries returns the Entries of the pack, in order.
+func (r *Reader) Entries() []Entry { return r.entries }
+
+// Lookup returns the Entry of the named resource.
+func (r *Reader) Lookup(name string) (Entry, bool) {
+	i, ok := r.byName[name]
+	if !ok {
+		return Entry{}, false
+	}
+	return r.entries[i], true
+}
+
+// Raw returns a reader over the stored content of the named resource,
+// without decompressing it.
+func (r *Reader) Raw(name string) (*io.SectionReader, error) {
+	e, ok := r.Lookup(name)
+	if !ok {
+		return nil, &os.PathError{Op: "open", Path: name, Err: os.ErrNotExist}
+	}
+	return io.NewSectionReader(r.from, int64(e.Offset), int64(e.StoredSize)), nil
+}
+
+// Open returns a reader over the decompressed content of the named
+// resource.
+func (r *Reader) Open(name string) (io.ReadCloser, error) {
+	raw, err := r.Raw(name)
+	if err != nil {
+		return nil, err
+	}
+
+	e, _ := r.Lookup(name)
+	codec, err := compress.Lookup(e.Codec)
+	if err != nil {
+		return nil, errors.Wrapf(err, "opening %s", name)
+	}
+
+	rc, err := codec.Reader(raw)
+	return rc, errors.Wrapf(err, "opening %s", name)
+}
+
+// Close closes the pack file, if the Reader was created by Open.
+func (r *Reader) Close() error {
+	if r.closer == nil {
+		return nil
+	}
+	return r.closer.Close()
+}
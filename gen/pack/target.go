@@ -0,0 +1,392 @@
+package pack
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"sort"
+	"sync"
+
+	"github.com/phoenix-engine/phx/fs"
+	"github.com/phoenix-engine/phx/gen/compress"
+	"github.com/phoenix-engine/phx/gen/cpp"
+
+	"github.com/pkg/errors"
+)
+
+// blobDir is where the compressed content of each resource is kept
+// until Finalize writes it into the pack.
+const blobDir = ".blobs"
+
+// PrepareTarget returns a Target which writes into the given FS.
+func PrepareTarget(over fs.FS) Target {
+	return Target{
+		FS:        over,
+		WaitGroup: new(sync.WaitGroup),
+		Pools:     compress.MakePools(),
+
+		created: &created{latest: make(map[string]int)},
+		done:    make(chan staged),
+	}
+}
+
+// Target is a gen Encoder which writes all of its resources into a
+// single pack file, instead of compiling them into C++ arrays.  It also
+// creates a C++ loader library which maps the pack into memory, with
+// the same Mapper and Resource interface as the cpp Target.
+//
+// The compressed content of each resource is kept in the FS until
+// Finalize, which must be called to create the pack.
+type Target struct {
+	fs.FS
+	*sync.WaitGroup
+	*compress.Pools
+
+	// Format is the formatting profile of the loader's source.
+	Format cpp.Format
+
+	// Naming selects the identifiers and namespaces of the resources
+	// in the C++ API, as in cpp.Target.
+	Naming cpp.Naming
+
+	// IDs are the IDs of the named resources which disambiguate
+	// their names in the ID enum, as in cpp.Target.
+	IDs map[string]int
+
+	// Prev, if set, holds the output of the last run, whose pack
+	// the content of the resources which are reused is copied from.
+	Prev fs.FS
+
+	created *created
+	done    chan staged
+}
+
+// created counts the times a Target created each resource.  A resource
+// may be created again, replacing its blob, such as to store it
+// uncompressed if it doesn't compress well enough.
+type created struct {
+	sync.Mutex
+	latest map[string]int
+}
+
+// add counts a new creation of the named resource, and returns its
+// number.
+func (c *created) add(name string) int {
+	c.Lock()
+	defer c.Unlock()
+	c.latest[name]++
+	return c.latest[name]
+}
+
+// replaced returns true if the given Entry was created, and then
+// replaced by one created later.
+func (c *created) replaced(s staged) bool {
+	c.Lock()
+	defer c.Unlock()
+	return s.gen != 0 && s.gen != c.latest[s.Name]
+}
+
+// staged is an Entry whose blob is staged for Finalize, with the number
+// of its creation, or which is reused from Prev.
+type staged struct {
+	Entry
+	gen    int
+	reused bool
+}
+
+// Create implements gen.Encoder on Target.  If the named resource was
+// created before, and its writer closed, its blob is replaced.
+func (t Target) Create(name string, using compress.Maker) (io.WriteCloser, error) {
+	p := path.Join(blobDir, name)
+	gen := t.created.add(name)
+	if gen > 1 {
+		if err := t.FS.Remove(p); err != nil && !os.IsNotExist(err) {
+			return nil, errors.Wrapf(err, "replacing blob %s", name)
+		}
+	}
+
+	f, err := t.FS.Create(p)
+	if err != nil {
+		return nil, errors.Wrapf(err, "creating blob %s", name)
+	}
+
+	pool := t.For(using)
+	comp := pool.Get().(compress.Compressor)
+	ct := &compress.WCounter{Writer: f}
+	comp.Reset(ct)
+
+	t.Add(1)
+	return &blob{
+		Entry: Entry{Name: name, Codec: using.Name()},
+		comp:  comp,
+		ct:    ct,
+		into:  f,
+		finish: func(e Entry) {
+			comp.Reset(nil)
+			pool.Put(comp)
+
+			// t.done is unbuffered, so it is sent on in the
+			// background, and consumed in Finalize.
+			go func() {
+				defer t.Done()
+				t.done <- staged{Entry: e, gen: gen}
+			}()
+		},
+	}, nil
+}
+
+// blob compresses a resource into its blob file.
+type blob struct {
+	Entry
+
+	comp   compress.Compressor
+	ct     *compress.WCounter
+	into   io.Closer
+	finish func(Entry)
+}
+
+func (b *blob) Write(some []byte) (int, error) {
+	n, err := b.comp.Write(some)
+	b.Size += uint64(n)
+	return n, err
+}
+
+func (b *blob) Count() int64 { return int64(b.StoredSize) }
+
+func (b *blob) Close() error {
+	// The Entry is finished even if closing fails, so Finalize
+	// doesn't wait for it forever.
+	defer func() { b.finish(b.Entry) }()
+
+	if err := b.comp.Close(); err != nil {
+		b.into.Close()
+		return errors.Wrapf(err, "closing compressor for %s", b.Name)
+	}
+	if err := b.into.Close(); err != nil {
+		return errors.Wrapf(err, "closing blob %s", b.Name)
+	}
+
+	b.StoredSize = uint64(b.ct.Count())
+	return nil
+}
+
+// Outputs implements gen.Reuser on Target.  The output of a resource is
+// its entry in the pack.
+func (t Target) Outputs(name, codec string, size, compressedSize int64) []string {
+	return []string{Name}
+}
+
+// Reuse implements gen.Reuser on Target.  The content of the named
+// resource is copied from the pack in Prev when the pack is written.
+func (t Target) Reuse(name, codec string, size, compressedSize int64) {
+	t.Add(1)
+
+	go func() {
+		defer t.Done()
+		t.done <- staged{Entry: Entry{
+			Name:       name,
+			Codec:      codec,
+			Size:       uint64(size),
+			StoredSize: uint64(compressedSize),
+		}, reused: true}
+	}()
+}
+
+// Finalize implements gen.Encoder on Target.  It writes the pack from
+// the blobs of all resources, removing them, and creates the loader.
+func (t Target) Finalize() error {
+	var (
+		entries   []Entry
+		reused    = make(map[string]bool)
+		collected = make(chan struct{})
+	)
+	go func() {
+		defer close(collected)
+		for s := range t.done {
+			if !t.created.replaced(s) {
+				entries = append(entries, s.Entry)
+				reused[s.Name] = s.reused
+			}
+		}
+	}()
+
+	t.Wait()
+	close(t.done)
+	<-collected
+
+	// The entries are in the same order as the generated ID enum, so
+	// the ID of each is its index.
+	varName := func(e Entry) string {
+		return cpp.Resource{Name: e.Name, ID: t.IDs[e.Name]}.VarName()
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return varName(entries[i]) < varName(entries[j])
+	})
+
+	res := make(cpp.Resources, len(entries))
+	for i, e := range entries {
+		entries[i].ID = uint32(i)
+		res[i] = cpp.Resource{
+			Name:      e.Name,
+			ID:        t.IDs[e.Name],
+			Codec:     e.Codec,
+			Size:      int64(e.Size),
+			CompCount: int64(e.StoredSize),
+			Naming:    t.Naming,
+		}
+	}
+
+	codec, err := res.Codec()
+	if err != nil {
+		return err
+	}
+	rt, err := cpp.RuntimeFor(codec)
+	if err != nil {
+		return err
+	}
+	if rt, err = rt.In(res.Root()); err != nil {
+		return err
+	}
+
+	if err := t.writePack(entries, reused); err != nil {
+		return err
+	}
+
+	text := t.Format.Over(t.FS)
+	if err := cpp.CreateImplementations(text, rt); err != nil {
+		return errors.Wrap(err, "creating implementation files")
+	}
+
+	for _, c := range []cpp.Creator{
+		cpp.ID(res),
+		creator{"mapper.hpp", mapperHdrTmp, res},
+		creator{"pack.cxx", loaderTmp, loaderArgs{
+			Resources:  res,
+			Version:    Version,
+			HeaderSize: HeaderSize,
+			EntrySize:  EntrySize,
+		}},
+		creator{"CMakeLists.txt", cmakeTmp, struct {
+			Resources cpp.Resources
+			cpp.Runtime
+		}{res, rt}},
+	} {
+		if err := c.Create(text); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+type loaderArgs struct {
+	Resources cpp.Resources
+
+	Version, HeaderSize, EntrySize int
+}
+
+// writePack writes the pack, moving the content of each blob into it.
+// The content of reused entries is copied from the pack in Prev.
+func (t Target) writePack(entries []Entry, reused map[string]bool) error {
+	var prev *Reader
+	for _, e := range entries {
+		if reused[e.Name] {
+			var err error
+			if prev, err = t.openPrev(); err != nil {
+				return err
+			}
+			defer prev.Close()
+			break
+		}
+	}
+
+	h, strs := layout(entries)
+
+	f, err := t.FS.Create(Name)
+	if err != nil {
+		return errors.Wrapf(err, "creating %s", Name)
+	}
+
+	if err := writeIndex(f, h, entries, strs); err != nil {
+		f.Close()
+		return err
+	}
+
+	for _, e := range entries {
+		if reused[e.Name] {
+			err = copyEntry(f, prev, e)
+		} else {
+			err = t.appendBlob(f, e.Name)
+		}
+		if err != nil {
+			f.Close()
+			return err
+		}
+	}
+
+	return errors.Wrapf(f.Close(), "closing %s", Name)
+}
+
+// openPrev opens the pack from the last run in Prev.
+func (t Target) openPrev() (*Reader, error) {
+	if t.Prev == nil {
+		return nil, errors.New("no previous pack to reuse")
+	}
+	if r, ok := t.Prev.(fs.Real); ok {
+		return Open(r.Join(r.Where, Name))
+	}
+
+	f, err := t.Prev.Open(Name)
+	if err != nil {
+		return nil, errors.Wrapf(err, "opening previous %s", Name)
+	}
+	bs, err := ioutil.ReadAll(f)
+	f.Close()
+	if err != nil {
+		return nil, errors.Wrapf(err, "reading previous %s", Name)
+	}
+
+	r, err := NewReader(bytes.NewReader(bs), int64(len(bs)))
+	return r, errors.Wrapf(err, "reading previous %s", Name)
+}
+
+// copyEntry copies the stored content of the given Entry from the pack
+// read by prev.  It must be stored the same way in both packs.
+func copyEntry(to io.Writer, prev *Reader, e Entry) error {
+	old, ok := prev.Lookup(e.Name)
+	switch {
+	case !ok:
+		return errors.Errorf("reusing %s: not in the previous pack", e.Name)
+	case old.Codec != e.Codec || old.StoredSize != e.StoredSize:
+		return errors.Errorf("reusing %s: stored differently in the "+
+			"previous pack", e.Name)
+	}
+
+	raw, err := prev.Raw(e.Name)
+	if err != nil {
+		return errors.Wrapf(err, "reusing %s", e.Name)
+	}
+	_, err = io.Copy(to, raw)
+	return errors.Wrapf(err, "reusing %s", e.Name)
+}
+
+func (t Target) appendBlob(to io.Writer, name string) error {
+	p := path.Join(blobDir, name)
+
+	b, err := t.FS.Open(p)
+	if err != nil {
+		return errors.Wrapf(err, "opening blob %s", name)
+	}
+
+	if _, err := io.Copy(to, b); err != nil {
+		b.Close()
+		return errors.Wrapf(err, "writing blob %s", name)
+	}
+	if err := b.Close(); err != nil {
+		return errors.Wrapf(err, "closing blob %s", name)
+	}
+
+	return errors.Wrapf(t.FS.Remove(p), "removing blob %s", name)
+}
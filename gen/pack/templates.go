@@ -0,0 +1,247 @@
+package pack
+
+import (
+	"text/template"
+
+	"github.com/phoenix-engine/phx/fs"
+	"github.com/phoenix-engine/phx/gen/cpp"
+
+	"github.com/pkg/errors"
+)
+
+// creator is a cpp.Creator which executes a template into a file.
+type creator struct {
+	name, tmp string
+	args      interface{}
+}
+
+func (c creator) Create(f fs.FS) error {
+	tmp, err := template.New(c.name).Parse(c.tmp)
+	if err != nil {
+		return errors.Wrapf(err, "parsing %s template", c.name)
+	}
+
+	return cpp.Execute(f, tmp, c.args)
+}
+
+var mapperHdrTmp = `
+#ifndef PHX_RES_MAPPER
+#define PHX_RES_MAPPER
+
+#include <memory>
+#include <map>
+
+#include "id.hpp"
+#include "resource.hpp"
+
+{{.Root.Open}}
+    // Mapper encapsulates implementation details of the mapping of IDs
+    // to Resources away from the user.
+    //
+    // Load must be called once with the path of the resource pack
+    // before any Resource is fetched.  The pack stays in memory until
+    // the program exits.
+    //
+    // Fetch is used to retrieve a new Resource, which can be used to
+    // decompress an asset from the pack.  It does not create a new
+    // copy of the asset.
+    class Mapper {
+    public:
+	// Mapper may not be instantiated.
+	Mapper() = delete;
+
+	// Load maps the resource pack at the given path into memory,
+	// or reads it if it can't be mapped.
+	static void Load(const char* path) noexcept(false);
+
+	// Fetch creates and retrieves a unique smart-pointer to a
+	// Resource.
+	static std::unique_ptr<Resource> Fetch(ID) noexcept(false);
+{{- range .Nested}}
+	static std::unique_ptr<Resource> Fetch({{.}}::ID id) noexcept(false) {
+	    return Fetch(static_cast<ID>(id));
+	}{{end}}
+
+    private:
+	// The codec is the name of the codec the content is stored
+	// with, such as "none" for uncompressed content.  The content
+	// in a pack is never chunked, so chunks is always null.
+	struct resDefn {
+	    const char*          codec;
+	    size_t               compressed_length;
+	    size_t               decompressed_length;
+	    const unsigned char* content;
+
+	    const unsigned char* const* chunks;
+	    size_t                      chunk_length;
+	};
+
+	static std::map<ID, const resDefn> mappings;
+    };
+{{.Root.Close}}
+
+#endif
+`[1:]
+
+var loaderTmp = `
+#include <cstdint>
+#include <cstring>
+#include <fstream>
+#include <iterator>
+#include <map>
+#include <vector>
+
+#if defined(__unix__) || defined(__APPLE__)
+#define PHX_PACK_MMAP
+#include <fcntl.h>
+#include <sys/mman.h>
+#include <sys/stat.h>
+#include <unistd.h>
+#endif
+
+#include "id.hpp"
+#include "mapper.hpp"
+
+{{.Resources.Root.Open}}
+    std::map<ID, const Mapper::resDefn> Mapper::mappings;
+
+    namespace {
+	const char     magic[]    = "PHXPACK";
+	const uint32_t version    = {{.Version}};
+	const uint32_t count      = {{len .Resources}};
+	const size_t   headerSize = {{.HeaderSize}};
+	const size_t   entrySize  = {{.EntrySize}};
+
+	const unsigned char* pack    = nullptr;
+	size_t               packLen = 0;
+
+#ifndef PHX_PACK_MMAP
+	std::vector<unsigned char> buffer;
+#endif
+
+	uint32_t u32(const unsigned char* p) noexcept(true) {
+	    return uint32_t(p[0]) | uint32_t(p[1]) << 8 |
+	           uint32_t(p[2]) << 16 | uint32_t(p[3]) << 24;
+	}
+
+	uint64_t u64(const unsigned char* p) noexcept(true) {
+	    return uint64_t(u32(p)) | uint64_t(u32(p + 4)) << 32;
+	}
+
+	void readPack(const char* path) noexcept(false) {
+#ifdef PHX_PACK_MMAP
+	    int fd = open(path, O_RDONLY);
+	    if (fd < 0) {
+		throw "opening resource pack";
+	    }
+
+	    struct stat st;
+	    if (fstat(fd, &st) != 0) {
+		close(fd);
+		throw "checking resource pack";
+	    }
+
+	    void* m = mmap(nullptr, st.st_size, PROT_READ, MAP_PRIVATE,
+	                   fd, 0);
+	    close(fd);
+	    if (m == MAP_FAILED) {
+		throw "mapping resource pack";
+	    }
+
+	    pack    = static_cast<const unsigned char*>(m);
+	    packLen = st.st_size;
+#else
+	    std::ifstream in(path, std::ios::binary);
+	    if (!in) {
+		throw "opening resource pack";
+	    }
+
+	    buffer.assign(std::istreambuf_iterator<char>(in),
+	                  std::istreambuf_iterator<char>());
+	    pack    = buffer.data();
+	    packLen = buffer.size();
+#endif
+	}
+    }; // namespace
+
+    void Mapper::Load(const char* path) noexcept(false) {
+	if (pack != nullptr) {
+	    throw "resource pack already loaded";
+	}
+
+	readPack(path);
+
+	if (packLen < headerSize ||
+	    std::memcmp(pack, magic, sizeof(magic)) != 0) {
+	    throw "not a resource pack";
+	}
+	if (u32(pack + 8) != version) {
+	    throw "unsupported resource pack version";
+	}
+	if (u32(pack + 12) != count) {
+	    throw "resource pack does not match id.hpp";
+	}
+
+	// The bounds are checked by subtraction, so they can't overflow.
+	auto tableLen   = headerSize + entrySize * count;
+	auto stringsLen = u64(pack + 16);
+	if (tableLen > packLen || stringsLen > packLen - tableLen) {
+	    throw "resource pack is truncated";
+	}
+	auto strings = pack + tableLen;
+
+	for (uint32_t i = 0; i < count; i++) {
+	    auto entry = pack + headerSize + entrySize * i;
+
+	    auto offset      = u64(entry);
+	    auto stored      = u64(entry + 8);
+	    auto size        = u64(entry + 16);
+	    auto codecOffset = u32(entry + 32);
+	    auto id          = u32(entry + 40);
+
+	    if (offset > packLen || stored > packLen - offset ||
+	        codecOffset >= stringsLen) {
+		throw "resource pack is truncated";
+	    }
+
+	    mappings.emplace(
+	      static_cast<ID>(id),
+	      resDefn{ reinterpret_cast<const char*>(strings + codecOffset),
+	               stored, size, pack + offset });
+	}
+    }
+{{.Resources.Root.Close}}
+`[1:]
+
+var cmakeTmp = `
+cmake_minimum_required(VERSION 3.1.0 FATAL_ERROR)
+
+if(POLICY CMP0076)
+  cmake_policy(SET CMP0076 NEW)
+endif() # POLICY CMP0076
+{{with .CMake}}
+{{.}}{{end}}
+# Add Resource library.  The resource pack, res.pack, is loaded at
+# runtime using {{.Resources.Root}}::Mapper::Load.
+add_library(Resource STATIC)
+
+target_sources(Resource
+  PUBLIC
+    mapper.cxx
+    pack.cxx
+    resource.cxx
+  INTERFACE
+    id.hpp
+    resource.hpp
+    mapper.hpp
+)
+
+target_include_directories(Resource PUBLIC
+  ${CMAKE_CURRENT_LIST_DIR}
+)
+{{with .Library}}
+target_link_libraries(Resource {{.}})
+{{end}}
+set_property(TARGET Resource PROPERTY CXX_STANDARD 11)
+set_property(TARGET Resource PROPERTY CXX_STANDARD_REQUIRED ON)
+`[1:]
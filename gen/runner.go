@@ -0,0 +1,108 @@
+package gen
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// DefaultTimeout is the Timeout of the Runner a GitModule uses if it has
+// none.  It is long enough to clone a large remote.
+const DefaultTimeout = 10 * time.Minute
+
+// Runner runs commands.  A GitModule runs git using its Runner, which a
+// test may replace with a fake.
+type Runner interface {
+	// Run runs the command named by args[0] with the rest of the args
+	// in dir, or in the working directory if it is empty, and returns
+	// its standard output.  If the command runs and exits
+	// unsuccessfully, the error is an *ExitError.
+	Run(dir string, args ...string) ([]byte, error)
+}
+
+// ExitError is the error of a command which ran and exited
+// unsuccessfully.
+type ExitError struct {
+	// Args are the command and its arguments.
+	Args []string
+
+	// Code is the exit status of the command.
+	Code int
+
+	// Stderr is what the command wrote to its standard error.
+	Stderr string
+}
+
+// Error implements error on ExitError, including the Stderr of the
+// command.
+func (e *ExitError) Error() string {
+	msg := fmt.Sprintf("%s exited with status %d",
+		strings.Join(e.Args, " "), e.Code)
+	if stderr := strings.TrimSpace(e.Stderr); stderr != "" {
+		msg += ": " + stderr
+	}
+	return msg
+}
+
+// exited returns true if err is an *ExitError, meaning the command ran
+// but exited unsuccessfully.
+func exited(err error) bool {
+	_, ok := errors.Cause(err).(*ExitError)
+	return ok
+}
+
+// ExecRunner is a Runner of commands using os/exec.  The arguments of a
+// command are passed to it as they are, without a shell.
+type ExecRunner struct {
+	// Timeout, if set, is how long a command may run before it is
+	// killed, which is an error.
+	Timeout time.Duration
+}
+
+// Run implements Runner.Run on ExecRunner.
+func (r ExecRunner) Run(dir string, args ...string) ([]byte, error) {
+	if len(args) == 0 {
+		return nil, errors.New("no command to run")
+	}
+
+	ctx := context.Background()
+	if r.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, r.Timeout)
+		defer cancel()
+	}
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, args[0], args[1:]...)
+	cmd.Dir, cmd.Stdout, cmd.Stderr = dir, &stdout, &stderr
+
+	err := cmd.Run()
+	switch {
+	case err == nil:
+		return stdout.Bytes(), nil
+	case ctx.Err() == context.DeadlineExceeded:
+		msg := fmt.Sprintf("%s timed out after %s",
+			strings.Join(args, " "), r.Timeout)
+		if stderr := strings.TrimSpace(stderr.String()); stderr != "" {
+			msg += ": " + stderr
+		}
+		return stdout.Bytes(), errors.New(msg)
+	case cmd.ProcessState == nil:
+		// The command never started.
+		return nil, errors.Wrapf(err, "running %s", args[0])
+	}
+
+	if ee, ok := err.(*exec.ExitError); ok {
+		return stdout.Bytes(), &ExitError{
+			Args:   args,
+			Code:   ee.ExitCode(),
+			Stderr: stderr.String(),
+		}
+	}
+	return stdout.Bytes(), errors.Wrapf(err, "running %s", args[0])
+}
@@ -0,0 +1,311 @@
+package gen_test
+
+import (
+	"os/exec"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/phoenix-engine/phx/gen"
+
+	"github.com/pkg/errors"
+)
+
+func TestExecRunner(t *testing.T) {
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("sh is not installed")
+	}
+
+	for i, test := range []struct {
+		should string
+
+		given gen.ExecRunner
+		args  []string
+
+		expect     string
+		expectExit int
+		expectErr  string
+	}{{
+		should: "pass each argument as it is",
+		args:   []string{"sh", "-c", `printf '%s|' "$@"`, "sh", "a b", "; echo no", "$HOME"},
+		expect: "a b|; echo no|$HOME|",
+	}, {
+		should:     "include the exit status and stderr in the error",
+		args:       []string{"sh", "-c", "echo out; echo oops >&2; exit 3"},
+		expect:     "out\n",
+		expectExit: 3,
+		expectErr:  `^sh -c echo out; echo oops >&2; exit 3 exited with status 3: oops$`,
+	}, {
+		should:    "fail for a command which doesn't exist",
+		args:      []string{"phx-no-such-command"},
+		expectErr: `^running phx-no-such-command: .*not found`,
+	}, {
+		should:    "fail for no command",
+		expectErr: `^no command to run$`,
+	}, {
+		should:    "kill a command which times out",
+		given:     gen.ExecRunner{Timeout: 50 * time.Millisecond},
+		args:      []string{"sleep", "5"},
+		expectErr: `^sleep 5 timed out after 50ms$`,
+	}, {
+		should:    "include stderr in the error of a command which times out",
+		given:     gen.ExecRunner{Timeout: 50 * time.Millisecond},
+		args:      []string{"sh", "-c", "echo stuck >&2; exec sleep 5"},
+		expectErr: `^sh -c echo stuck >&2; exec sleep 5 timed out after 50ms: stuck$`,
+	}} {
+		t.Logf("test %d: should %s", i, test.should)
+
+		out, err := test.given.Run("", test.args...)
+		if got := string(out); got != test.expect {
+			t.Errorf("expected output %q, got %q", test.expect, got)
+		}
+
+		switch {
+		case test.expectErr == "" && err != nil:
+			t.Errorf("expected nil error, got %#v", err)
+		case test.expectErr == "":
+		case err == nil:
+			t.Errorf("expected error matching %s, got nil", test.expectErr)
+		case !regexp.MustCompile(test.expectErr).MatchString(err.Error()):
+			t.Errorf("expected error matching %s, got %#v", test.expectErr, err)
+		}
+
+		// Only a command which ran and failed has an ExitError.
+		ee, ok := err.(*gen.ExitError)
+		if ok != (test.expectExit != 0) {
+			t.Errorf("expected an ExitError: %t, got %#v", test.expectExit != 0, err)
+		} else if ok && ee.Code != test.expectExit {
+			t.Errorf("expected exit status %d, got %d", test.expectExit, ee.Code)
+		}
+	}
+}
+
+// fakeGit is a Runner which answers commands from a script instead of
+// running them, and records them.
+type fakeGit struct {
+	// script holds the outputs of each command, as it is recorded,
+	// in turn.  The last output is repeated.  An output beginning
+	// with "!" is the stderr of an ExitError, and one beginning with
+	// "!!" is another error.  A command without outputs exits with
+	// status 1.
+	script map[string][]string
+
+	// calls are the commands, such as "root$ git status", where root
+	// is the directory it ran in.
+	calls []string
+}
+
+func (f *fakeGit) Run(dir string, args ...string) ([]byte, error) {
+	call := dir + "$ " + strings.Join(args, " ")
+	f.calls = append(f.calls, call)
+
+	outs := f.script[call]
+	if len(outs) == 0 {
+		return nil, &gen.ExitError{Args: args, Code: 1}
+	}
+	out := outs[0]
+	if len(outs) > 1 {
+		f.script[call] = outs[1:]
+	}
+
+	switch {
+	case strings.HasPrefix(out, "!!"):
+		return nil, errors.New(out[2:])
+	case strings.HasPrefix(out, "!"):
+		return nil, &gen.ExitError{Args: args, Code: 128, Stderr: out[1:]}
+	}
+	return []byte(out + "\n"), nil
+}
+
+func TestGitModuleFake(t *testing.T) {
+	const (
+		inRepo = "root$ git rev-parse --is-inside-work-tree"
+		status = "root$ git submodule status -- dep"
+		head   = "root/dep$ git rev-parse --verify HEAD"
+		mods   = "root/dep$ git status --porcelain --untracked-files=no --ignore-submodules=all"
+		subs   = "root/dep$ git submodule status --recursive"
+		origin = "root/dep$ git rev-parse --verify --quiet origin/v1^{commit}"
+		local  = "root/dep$ git rev-parse --verify --quiet v1^{commit}"
+		update = "root/dep$ git submodule update --quiet --init --recursive"
+	)
+
+	for i, test := range []struct {
+		should string
+
+		given  gen.GitModule
+		script map[string][]string
+
+		expect      gen.ModuleStatus
+		expectCalls []string
+		expectErr   string
+	}{{
+		should: "pass the remote and branch of a new submodule as arguments",
+		given: gen.GitModule{
+			Remote: "-u evil remote", Local: "dep", Branch: "my branch",
+		},
+		script: map[string][]string{
+			inRepo: {"true"},
+			status: {"!", " abc dep (heads/my branch)"},
+			"root$ git submodule add --quiet -b my branch -- -u evil remote dep": {""},
+			"root$ git submodule update --quiet --init --recursive -- dep":       {""},
+			head: {"abc"},
+			"root/dep$ git rev-parse --verify --quiet origin/my branch^{commit}": {"abc"},
+			mods: {""},
+			subs: {""},
+		},
+
+		expect: gen.ModuleStatus{
+			Drift: gen.DriftMissing, Commit: "abc", Expected: "abc",
+		},
+		expectCalls: []string{
+			inRepo, status, inRepo,
+			"root$ git submodule add --quiet -b my branch -- -u evil remote dep",
+			"root$ git submodule update --quiet --init --recursive -- dep",
+			inRepo, status, head,
+			"root/dep$ git rev-parse --verify --quiet origin/my branch^{commit}",
+			mods, subs,
+		},
+	}, {
+		should: "reject a revision which would be an option",
+		given: gen.GitModule{
+			Remote: "r", Local: "dep", Revision: "--upload-pack=x",
+		},
+
+		expectErr: `^invalid revision "--upload-pack=x"$`,
+	}, {
+		should: "include the stderr of git in the error",
+		given:  gen.GitModule{Remote: "/nope", Local: "dep"},
+		script: map[string][]string{
+			inRepo: {"true"},
+			"root$ git submodule add --quiet -- /nope dep": {
+				"!fatal: repository '/nope' does not exist",
+			},
+		},
+
+		expectCalls: []string{
+			inRepo, status, inRepo,
+			"root$ git submodule add --quiet -- /nope dep",
+		},
+		expectErr: `^adding submodule dep from /nope: ` +
+			`git submodule add --quiet -- /nope dep exited with status 128: ` +
+			`fatal: repository '/nope' does not exist$`,
+	}, {
+		should: "fail if git can't be run",
+		given:  gen.GitModule{Remote: "r", Local: "dep"},
+		script: map[string][]string{
+			inRepo: {"!!git timed out"},
+		},
+
+		expectCalls: []string{inRepo},
+		expectErr:   `^creating git status check: git timed out$`,
+	}, {
+		should: "initialize an uninitialized submodule",
+		given:  gen.GitModule{Remote: "r", Local: "dep"},
+		script: map[string][]string{
+			inRepo: {"true"},
+			status: {"-abc dep", " abc dep"},
+			"root$ git submodule update --quiet --init --recursive -- dep": {""},
+			head: {"abc"},
+			mods: {""},
+			subs: {""},
+		},
+
+		expect: gen.ModuleStatus{Drift: gen.DriftUninitialized, Commit: "abc"},
+		expectCalls: []string{
+			inRepo, status,
+			"root$ git submodule update --quiet --init --recursive -- dep",
+			inRepo, status, head, mods, subs,
+		},
+	}, {
+		should: "fetch and check out a revision which isn't known locally",
+		given:  gen.GitModule{Remote: "r", Local: "dep", Revision: "v1"},
+		script: map[string][]string{
+			inRepo: {"true"},
+			status: {" abc dep"},
+			head:   {"abc"},
+			origin: {"!"},
+			local:  {"!", "def"},
+			mods:   {""},
+			subs:   {""},
+			"root/dep$ git fetch --quiet --tags origin": {""},
+			"root/dep$ git checkout --quiet def":        {""},
+			update:                                      {""},
+		},
+
+		expect: gen.ModuleStatus{
+			Drift: gen.DriftCommit, Commit: "def", Expected: "def",
+		},
+		expectCalls: []string{
+			inRepo, status, head, origin, local, mods, subs,
+			"root/dep$ git fetch --quiet --tags origin",
+			origin, local,
+			"root/dep$ git checkout --quiet def",
+			update,
+		},
+	}, {
+		should: "not move a modified checkout without Overwrite",
+		given:  gen.GitModule{Remote: "r", Local: "dep", Revision: "v1"},
+		script: map[string][]string{
+			inRepo: {"true"},
+			status: {" abc dep"},
+			head:   {"abc"},
+			origin: {"def"},
+			mods:   {" M f"},
+			subs:   {""},
+		},
+
+		expectCalls: []string{inRepo, status, head, origin, mods, subs},
+		expectErr: `^dep has local modifications, so it can't be ` +
+			`checked out at v1 without overwriting them$`,
+	}, {
+		should: "reset a modified checkout with Overwrite",
+		given: gen.GitModule{
+			Remote: "r", Local: "dep", Revision: "v1", Overwrite: true,
+		},
+		script: map[string][]string{
+			inRepo:                                   {"true"},
+			status:                                   {" abc dep"},
+			head:                                     {"abc"},
+			origin:                                   {"def"},
+			mods:                                     {" M f"},
+			subs:                                     {"+123 lib"},
+			"root/dep$ git reset --quiet --hard def": {""},
+			"root/dep$ git submodule update --quiet --init --recursive --force": {""},
+		},
+
+		expect: gen.ModuleStatus{
+			Drift:  gen.DriftCommit | gen.DriftModified | gen.DriftSubmodules,
+			Commit: "def", Expected: "def",
+		},
+		expectCalls: []string{
+			inRepo, status, head, origin, mods, subs,
+			"root/dep$ git reset --quiet --hard def",
+			"root/dep$ git submodule update --quiet --init --recursive --force",
+		},
+	}} {
+		t.Logf("test %d: should %s", i, test.should)
+
+		f := &fakeGit{script: test.script}
+		test.given.Runner = f
+		st, err := test.given.Operate("root")
+
+		switch {
+		case test.expectErr == "" && err != nil:
+			t.Errorf("expected nil error, got %#v", err)
+		case test.expectErr == "" && st != test.expect:
+			t.Errorf("expected status %#v, got %#v", test.expect, st)
+		case test.expectErr == "":
+		case err == nil:
+			t.Errorf("expected error matching %s, got nil", test.expectErr)
+		case !regexp.MustCompile(test.expectErr).MatchString(err.Error()):
+			t.Errorf("expected error matching %s, got %#v", test.expectErr, err)
+		}
+
+		if got, expect := strings.Join(f.calls, "\n"),
+			strings.Join(test.expectCalls, "\n"); got != expect {
+			t.Errorf("\n======== expected calls:\n%s\n\n"+
+				"======== got:\n%s", expect, got)
+		}
+	}
+}
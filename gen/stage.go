@@ -0,0 +1,45 @@
+package gen
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/phoenix-engine/phx/fs"
+
+	"github.com/pkg/errors"
+)
+
+// DefaultStageThreshold is the total size of resources above which a
+// Gen stages its output on disk rather than in memory.
+const DefaultStageThreshold = 256 * MB
+
+// stage returns the FS in which g's output should be staged, given the
+// total size of its resources, and a func which removes it.
+//
+// A temporary directory is created next to g.To if it is an fs.Real,
+// so that staged files can be renamed into place.
+func (g Gen) stage(total int64) (fs.FS, func() error, error) {
+	threshold := g.StageThreshold
+	if threshold == 0 {
+		threshold = DefaultStageThreshold
+	}
+
+	if !g.StageOnDisk && total <= threshold {
+		return fs.MakeSyncMem(), func() error { return nil }, nil
+	}
+
+	var parent string
+	if to, ok := g.To.(fs.Real); ok {
+		parent = filepath.Dir(filepath.Clean(to.Where))
+	}
+
+	tmp, err := ioutil.TempDir(parent, ".phx-stage-")
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "creating temporary directory")
+	}
+
+	return fs.Real{Where: tmp}, func() error {
+		return os.RemoveAll(tmp)
+	}, nil
+}
@@ -0,0 +1,110 @@
+package gen_test
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/phoenix-engine/phx/fs"
+	"github.com/phoenix-engine/phx/gen"
+	"github.com/phoenix-engine/phx/gen/compress"
+	"github.com/phoenix-engine/phx/gen/cpp"
+)
+
+func TestGenStageOnDisk(t *testing.T) {
+	for i, test := range []struct {
+		should    string
+		stage     func(*gen.Gen)
+		maker     compress.Maker
+		expectErr bool
+	}{{
+		should: "stage on disk when forced",
+		stage:  func(g *gen.Gen) { g.StageOnDisk = true },
+	}, {
+		should: "stage on disk above the threshold",
+		stage:  func(g *gen.Gen) { g.StageThreshold = 1 },
+	}, {
+		should:    "clean up the staging area on failure",
+		stage:     func(g *gen.Gen) { g.StageOnDisk = true },
+		maker:     failMaker{},
+		expectErr: true,
+	}} {
+		t.Logf("test %d: should %s", i, test.should)
+
+		root, rm := makeTree(t, map[string]string{
+			"res/a.txt":     "some text",
+			"res/sub/b.txt": "more text",
+		})
+		defer rm()
+
+		var maker compress.Maker = compress.LZ4Maker{}
+		if test.maker != nil {
+			maker = test.maker
+		}
+
+		g := gen.Gen{
+			Sources: []gen.Source{{
+				From:    fs.Real{Where: filepath.Join(root, "res")},
+				Matcher: matchAny{},
+				Maker:   maker,
+			}},
+			To: fs.Real{Where: filepath.Join(root, "gen")},
+		}
+		test.stage(&g)
+
+		err := g.Operate()
+		if test.expectErr != (err != nil) {
+			t.Errorf("expected error %t, got %#v", test.expectErr, err)
+		}
+
+		if !test.expectErr {
+			p := filepath.Join(root, "gen", "res", "sub", "sub_b_txt_real.cxx")
+			if _, err := os.Stat(p); err != nil {
+				t.Errorf("expected nil error, got %#v", err)
+			}
+		}
+
+		// Only res, gen and the lock file should be left in the
+		// root.
+		fis, err := ioutil.ReadDir(root)
+		if err != nil {
+			t.Fatalf("expected nil error, got %#v", err)
+		}
+		for _, fi := range fis {
+			switch n := fi.Name(); n {
+			case "res", "gen", ".gen.lock":
+			default:
+				t.Errorf("expected staging area to be removed, found %s", n)
+			}
+		}
+	}
+}
+
+// failMaker makes Compressors which always fail to write.  Its codec
+// is decoded by the runtime of uncompressed resources.
+type failMaker struct{}
+
+func init() {
+	rt, err := cpp.RuntimeFor("none")
+	if err != nil {
+		panic(err)
+	}
+	codec, err := compress.Lookup("none")
+	if err != nil {
+		panic(err)
+	}
+	codec.Name = failMaker{}.Name()
+	codec.Maker = func(compress.Level) compress.Maker { return failMaker{} }
+	cpp.Register(codec, rt)
+}
+
+func (failMaker) Make() compress.Compressor { return &failComp{} }
+func (failMaker) Name() string              { return "fail" }
+
+type failComp struct{ compress.NoCompress }
+
+func (failComp) Write([]byte) (int, error) {
+	return 0, errors.New("failed to write")
+}
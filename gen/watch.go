@@ -0,0 +1,226 @@
+package gen
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/phoenix-engine/phx/fs"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/pkg/errors"
+)
+
+// DefaultDebounce is the default time a Watch waits after a change
+// before running the Gen, so that bursts of edits are processed
+// together.
+const DefaultDebounce = 250 * time.Millisecond
+
+// Watch runs the Gen once, and again each time a file in the From tree
+// of one of its Sources changes.  Each From must be an fs.Real.  Since
+// the Gen keeps a manifest of its output, only changed resources are
+// processed again.
+//
+// Changes to the output of the Gen are ignored, along with its lock
+// file and temporary directories next to it, so a To inside a From
+// doesn't make the Gen run again after each run.
+type Watch struct {
+	Gen
+
+	// Graph, if set, holds the Gens of a graph, which are all run
+	// by OperateGraph in place of Gen.
+	Graph []Gen
+
+	// Debounce is how long to wait for further changes after a
+	// change before running the Gen.  If it is zero, DefaultDebounce
+	// is used.
+	Debounce time.Duration
+
+	// Cycle, if set, is called with the result of each run of the
+	// Gen.  Otherwise, errors are printed to stderr.  Errors from the
+	// Gen do not stop the Watch.
+	Cycle func(error)
+}
+
+// Run runs the Watch until stop is closed or the watcher fails.
+func (w Watch) Run(stop <-chan struct{}) error {
+	for _, src := range w.sources() {
+		if _, ok := src.From.(fs.Real); !ok {
+			return errors.Errorf("cannot watch %T, must be fs.Real", src.From)
+		}
+	}
+
+	debounce := w.Debounce
+	if debounce == 0 {
+		debounce = DefaultDebounce
+	}
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return errors.Wrap(err, "creating watcher")
+	}
+	defer watcher.Close()
+
+	watched := make(map[string]bool)
+	for _, src := range w.sources() {
+		root := src.From.(fs.Real).Where
+		if watched[root] {
+			continue
+		}
+		if err := watchTree(watcher, root); err != nil {
+			return err
+		}
+		watched[root] = true
+	}
+
+	w.cycle()
+
+	var (
+		timer = time.NewTimer(debounce)
+		fire  <-chan time.Time
+	)
+	timer.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return nil
+
+		case err := <-watcher.Errors:
+			return errors.Wrap(err, "watching")
+
+		case ev := <-watcher.Events:
+			if !w.relevant(watcher, ev) {
+				continue
+			}
+
+			// Restart the debounce timer.
+			if !timer.Stop() && fire != nil {
+				select {
+				case <-timer.C:
+				default:
+				}
+			}
+			timer.Reset(debounce)
+			fire = timer.C
+
+		case <-fire:
+			fire = nil
+			w.cycle()
+		}
+	}
+}
+
+// gens returns the Gens which the Watch runs.
+func (w Watch) gens() []Gen {
+	if w.Graph != nil {
+		return w.Graph
+	}
+	return []Gen{w.Gen}
+}
+
+// sources returns the Sources of all of the Gens which the Watch runs.
+func (w Watch) sources() []Source {
+	var srcs []Source
+	for _, g := range w.gens() {
+		srcs = append(srcs, g.Sources...)
+	}
+	return srcs
+}
+
+// relevant returns true if the event should trigger a new cycle.  New
+// directories are added to the watcher.
+func (w Watch) relevant(watcher *fsnotify.Watcher, ev fsnotify.Event) bool {
+	if ev.Op == fsnotify.Chmod || w.generated(ev.Name) {
+		return false
+	}
+
+	if ev.Op&fsnotify.Create != 0 {
+		if fi, err := os.Lstat(ev.Name); err == nil && fi.IsDir() {
+			// Any files created in the new directory before it
+			// was watched will be picked up by the next cycle.
+			if err := watchTree(watcher, ev.Name); err != nil {
+				fmt.Fprintln(os.Stderr, err)
+			}
+			return true
+		}
+	}
+
+	if ev.Op&(fsnotify.Remove|fsnotify.Rename) != 0 {
+		// The removed path may have been a directory.
+		return true
+	}
+
+	for _, src := range w.sources() {
+		rel, err := filepath.Rel(src.From.(fs.Real).Where, ev.Name)
+		if err != nil || strings.HasPrefix(rel, "..") {
+			continue
+		}
+		if src.Match(filepath.ToSlash(rel)) {
+			return true
+		}
+	}
+	return false
+}
+
+// generated returns true if the named path is written by a Gen of the
+// Watch when it runs: its output, or its lock file, commit directories
+// or staging directories next to it.
+func (w Watch) generated(name string) bool {
+	name = filepath.Clean(name)
+	for _, g := range w.gens() {
+		to, ok := g.To.(fs.Real)
+		if !ok {
+			continue
+		}
+		dir := filepath.Clean(to.Where)
+
+		if rel, err := filepath.Rel(dir, name); err == nil &&
+			rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return true
+		}
+
+		rel, err := filepath.Rel(filepath.Dir(dir), name)
+		if err != nil {
+			continue
+		}
+		first := strings.SplitN(rel, string(filepath.Separator), 2)[0]
+		if strings.HasPrefix(first, "."+filepath.Base(dir)+".") ||
+			strings.HasPrefix(first, ".phx-stage-") {
+			return true
+		}
+	}
+	return false
+}
+
+func (w Watch) cycle() {
+	var err error
+	if w.Graph != nil {
+		err = OperateGraph(w.Graph)
+	} else {
+		err = w.Operate()
+	}
+	if w.Cycle != nil {
+		w.Cycle(err)
+		return
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+	}
+}
+
+// watchTree adds the given directory and all directories under it to
+// the watcher.
+func watchTree(watcher *fsnotify.Watcher, root string) error {
+	return filepath.Walk(root, func(p string, fi os.FileInfo, err error) error {
+		switch {
+		case err != nil:
+			return errors.Wrapf(err, "walking %s", p)
+		case !fi.IsDir():
+			return nil
+		}
+		return errors.Wrapf(watcher.Add(p), "watching %s", p)
+	})
+}
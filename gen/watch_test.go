@@ -0,0 +1,180 @@
+package gen_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/phoenix-engine/phx/gen"
+	"github.com/phoenix-engine/phx/path"
+)
+
+func TestWatch(t *testing.T) {
+	from, rmFrom := makeTree(t, map[string]string{
+		"a.txt": "some text",
+	})
+	defer rmFrom()
+	to, rmTo := makeTree(t, nil)
+	defer rmTo()
+
+	var (
+		stop   = make(chan struct{})
+		cycles = make(chan error, 16)
+		ran    = make(chan error)
+	)
+
+	w := gen.Watch{
+		Gen:      makeGen(from, to),
+		Debounce: 10 * time.Millisecond,
+		Cycle:    func(err error) { cycles <- err },
+	}
+	go func() { ran <- w.Run(stop) }()
+
+	next := func() {
+		t.Helper()
+		select {
+		case err := <-cycles:
+			if err != nil {
+				t.Fatalf("expected nil error, got %#v", err)
+			}
+		case err := <-ran:
+			t.Fatalf("watch stopped early with %#v", err)
+		case <-time.After(5 * time.Second):
+			t.Fatal("timed out waiting for a cycle")
+		}
+	}
+
+	// The first cycle runs immediately.
+	next()
+
+	if _, err := os.Stat(filepath.Join(to, "res/a_txt_real.cxx")); err != nil {
+		t.Errorf("expected a_txt_real.cxx to exist, got %#v", err)
+	}
+
+	// Creating the directory and the file may take more than one
+	// cycle to be picked up.
+	writeFile(t, from, "sub/b.txt", "new text")
+	for {
+		next()
+		_, err := os.Stat(filepath.Join(to, "res/sub/sub_b_txt_real.cxx"))
+		if err == nil {
+			break
+		}
+	}
+
+	close(stop)
+	if err := <-ran; err != nil {
+		t.Errorf("expected nil error, got %#v", err)
+	}
+}
+
+func TestWatchToInFrom(t *testing.T) {
+	from, rmFrom := makeTree(t, map[string]string{
+		"res/a.txt": "some text",
+	})
+	defer rmFrom()
+
+	// The output, and the lock and staging next to it, are in the
+	// watched tree, but aren't resources.
+	g := makeGen(from, filepath.Join(from, "gen"))
+	g.Sources[0].Matcher = path.Glob{"res/**"}
+	g.StageOnDisk = true
+
+	var (
+		stop   = make(chan struct{})
+		cycles = make(chan error, 16)
+		ran    = make(chan error)
+	)
+
+	w := gen.Watch{
+		Gen:      g,
+		Debounce: 10 * time.Millisecond,
+		Cycle:    func(err error) { cycles <- err },
+	}
+	go func() { ran <- w.Run(stop) }()
+
+	select {
+	case err := <-cycles:
+		if err != nil {
+			t.Fatalf("expected nil error, got %#v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for a cycle")
+	}
+
+	// Writing the output doesn't trigger another cycle.
+	select {
+	case err := <-cycles:
+		t.Errorf("expected no more cycles, got one with %#v", err)
+	case <-time.After(200 * time.Millisecond):
+	}
+
+	close(stop)
+	if err := <-ran; err != nil {
+		t.Errorf("expected nil error, got %#v", err)
+	}
+}
+
+func TestWatchGraph(t *testing.T) {
+	fromA, rmFromA := makeTree(t, map[string]string{"a.txt": "some text"})
+	defer rmFromA()
+	fromB, rmFromB := makeTree(t, map[string]string{"b.txt": "more text"})
+	defer rmFromB()
+	toA, rmToA := makeTree(t, nil)
+	defer rmToA()
+	toB, rmToB := makeTree(t, nil)
+	defer rmToB()
+
+	var (
+		stop   = make(chan struct{})
+		cycles = make(chan error, 16)
+		ran    = make(chan error)
+	)
+
+	w := gen.Watch{
+		Graph:    []gen.Gen{makeGen(fromA, toA), makeGen(fromB, toB)},
+		Debounce: 10 * time.Millisecond,
+		Cycle:    func(err error) { cycles <- err },
+	}
+	go func() { ran <- w.Run(stop) }()
+
+	next := func() {
+		t.Helper()
+		select {
+		case err := <-cycles:
+			if err != nil {
+				t.Fatalf("expected nil error, got %#v", err)
+			}
+		case err := <-ran:
+			t.Fatalf("watch stopped early with %#v", err)
+		case <-time.After(5 * time.Second):
+			t.Fatal("timed out waiting for a cycle")
+		}
+	}
+
+	// The first cycle runs every Gen of the graph.
+	next()
+	for _, p := range []string{
+		filepath.Join(toA, "res/a_txt_real.cxx"),
+		filepath.Join(toB, "res/b_txt_real.cxx"),
+	} {
+		if _, err := os.Stat(p); err != nil {
+			t.Errorf("expected %s to exist, got %#v", p, err)
+		}
+	}
+
+	// A change in the From of any Gen is picked up.
+	writeFile(t, fromB, "c.txt", "new text")
+	for {
+		next()
+		if _, err := os.Stat(filepath.Join(toB, "res/c_txt_real.cxx")); err == nil {
+			break
+		}
+	}
+
+	close(stop)
+	if err := <-ran; err != nil {
+		t.Errorf("expected nil error, got %#v", err)
+	}
+}
@@ -0,0 +1,61 @@
+package path
+
+import (
+	"path"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Glob matches slash-separated paths against a set of shell patterns,
+// as in path.Match.  A "**" element in a pattern matches zero or more
+// path elements.  A path is matched if any of the patterns match it.
+type Glob []string
+
+// MakeGlob returns a Glob over the given patterns, or an error if any
+// of them is malformed.
+func MakeGlob(patterns ...string) (Glob, error) {
+	for _, p := range patterns {
+		if _, err := path.Match(p, ""); err != nil {
+			return nil, errors.Wrapf(err, "parsing glob %q", p)
+		}
+	}
+	return Glob(patterns), nil
+}
+
+// Match implements Matcher on Glob.
+func (g Glob) Match(some string) bool {
+	elems := strings.Split(some, "/")
+	for _, p := range g {
+		if matchElems(strings.Split(p, "/"), elems) {
+			return true
+		}
+	}
+	return false
+}
+
+func matchElems(pattern, elems []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			// Try to match the rest of the pattern at every
+			// remaining offset, including the end.
+			for i := 0; i <= len(elems); i++ {
+				if matchElems(pattern[1:], elems[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+
+		if len(elems) == 0 {
+			return false
+		}
+		if ok, _ := path.Match(pattern[0], elems[0]); !ok {
+			return false
+		}
+
+		pattern, elems = pattern[1:], elems[1:]
+	}
+
+	return len(elems) == 0
+}
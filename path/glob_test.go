@@ -0,0 +1,62 @@
+package path_test
+
+import (
+	"testing"
+
+	"github.com/phoenix-engine/phx/path"
+	pt "github.com/phoenix-engine/phx/testing"
+)
+
+var _ = path.Matcher(path.Glob{})
+
+func TestGlob(t *testing.T) {
+	for i, test := range []struct {
+		should    string
+		patterns  []string
+		given     string
+		expect    bool
+		expectErr string
+	}{{
+		should:   "match a plain file",
+		patterns: []string{"*.png"},
+		given:    "a.png",
+		expect:   true,
+	}, {
+		should:   "not match across directories with *",
+		patterns: []string{"*.png"},
+		given:    "ui/a.png",
+	}, {
+		should:   "match across directories with **",
+		patterns: []string{"textures/**/*.png"},
+		given:    "textures/ui/big/a.png",
+		expect:   true,
+	}, {
+		should:   "match zero directories with **",
+		patterns: []string{"textures/**/*.png"},
+		given:    "textures/a.png",
+		expect:   true,
+	}, {
+		should:   "match everything under a directory",
+		patterns: []string{"shaders/**"},
+		given:    "shaders/a/b.glsl",
+		expect:   true,
+	}, {
+		should:   "match any of several patterns",
+		patterns: []string{"*.png", "*.glsl"},
+		given:    "a.glsl",
+		expect:   true,
+	}, {
+		should:    "reject a malformed pattern",
+		patterns:  []string{"[a"},
+		expectErr: "parsing glob",
+	}} {
+		t.Logf("test %d: should %s", i, test.should)
+
+		g, err := path.MakeGlob(test.patterns...)
+		if !pt.CheckErrMatches(t, err, test.expectErr) || err != nil {
+			continue
+		}
+
+		pt.CheckEq(t, g.Match(test.given), test.expect)
+	}
+}
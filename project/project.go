@@ -0,0 +1,243 @@
+// Package project creates new C++ projects which embed their resources
+// using phx.
+package project
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"text/template"
+
+	"github.com/phoenix-engine/phx/dep"
+	"github.com/phoenix-engine/phx/fs"
+	"github.com/phoenix-engine/phx/gen"
+	"github.com/phoenix-engine/phx/gen/compress"
+	"github.com/phoenix-engine/phx/gen/cpp"
+	phxpath "github.com/phoenix-engine/phx/path"
+
+	"github.com/pkg/errors"
+)
+
+// TemplateExt is the extension of the files of a project template which
+// are executed as templates.
+const TemplateExt = ".tmpl"
+
+// DefaultLZ4Remote is the Git remote of the LZ4 library, which the
+// runtime of the lz4 codec is built with.
+const DefaultLZ4Remote = "https://github.com/lz4/lz4"
+
+// Project is a new C++ project, with a res directory of resources which
+// "phx gen" generates a Resource library from, into its gen directory.
+type Project struct {
+	// Name is the name of the project, such as "game".
+	Name string
+
+	// Template, if set, holds the files of the project, instead of the
+	// built-in template.  Files with TemplateExt are executed with
+	// the project's Data, and created without the extension.  Other
+	// files are copied as they are.
+	Template fs.FS
+
+	// Codec is the name of the codec which compresses the resources.
+	// If it is empty, compress.DefaultCodec is used.
+	Codec string
+
+	// LZ4Remote is the Git remote of the LZ4 library, which is added
+	// as a submodule of the project if it uses the lz4 codec.  If it
+	// is empty, DefaultLZ4Remote is used.
+	LZ4Remote string
+
+	// NoGit skips creating a Git repo for the project, and adding its
+	// dependencies to it.
+	NoGit bool
+}
+
+// Data is what the templates of a project are executed with.
+type Data struct {
+	// Name is the name of the project, and Ident is a C++ identifier
+	// derived from it, such as for the name of its executable.
+	Name, Ident string
+
+	// Codec is the name of the codec of the project's resources.
+	Codec string
+}
+
+// Data returns the Data the templates of the Project are executed with.
+func (p Project) Data() Data {
+	codec := p.Codec
+	if codec == "" {
+		codec = compress.DefaultCodec
+	}
+
+	return Data{
+		Name:  p.Name,
+		Ident: cpp.Resource{Name: p.Name}.VarName(),
+		Codec: codec,
+	}
+}
+
+// Create creates the Project in the given directory, which must be empty
+// if it exists.  The files of its template are created, and its Resource
+// library is generated.  Then, unless NoGit is set, it is made a Git
+// repo, and the dependencies of its runtime are added as submodules,
+// declared in its config and locked, as with "phx dep add".  If it
+// fails, whatever it created is removed, so that it can be retried.
+func (p Project) Create(dir string) (err error) {
+	if p.Name == "" {
+		return errors.New("the project has no name")
+	}
+
+	infos, err := ioutil.ReadDir(dir)
+	existed := err == nil
+	switch {
+	case os.IsNotExist(err):
+	case err != nil:
+		return errors.Wrapf(err, "checking %s", dir)
+	case len(infos) > 0:
+		return errors.Errorf("%s is not empty", dir)
+	}
+
+	defer func() {
+		if err != nil {
+			removeCreated(dir, existed)
+		}
+	}()
+
+	data := p.Data()
+	c, err := compress.Lookup(data.Codec)
+	if err != nil {
+		return err
+	}
+
+	from := p.Template
+	if from == nil {
+		from = Builtin()
+	}
+	if err := p.createFiles(from, fs.Real{Where: dir}, data); err != nil {
+		return err
+	}
+
+	if !p.NoGit {
+		_, err := gen.ExecRunner{}.Run(dir, "git", "init", "--quiet")
+		if err != nil {
+			return errors.Wrap(err, "creating git repo")
+		}
+	}
+
+	// A project without resources has nothing to generate yet.
+	res := filepath.Join(dir, "res")
+	if _, err := os.Stat(res); os.IsNotExist(err) {
+		return p.addDeps(dir, data)
+	}
+
+	all, err := phxpath.MakeGlob("**")
+	if err != nil {
+		return err
+	}
+	err = gen.Gen{
+		Sources: []gen.Source{{
+			From:     fs.Real{Where: res},
+			Matcher:  all,
+			Maker:    c.Maker(compress.LevelFromInt(0)),
+			MaxRatio: gen.DefaultMaxRatio,
+		}},
+		To: fs.Real{Where: filepath.Join(dir, "gen")},
+	}.Operate()
+	if err != nil {
+		return errors.Wrap(err, "generating resources")
+	}
+
+	return p.addDeps(dir, data)
+}
+
+// removeCreated removes what Create created in dir, which is all of it,
+// keeping dir itself if it existed.  It is done on failure, so its own
+// errors are ignored.
+func removeCreated(dir string, existed bool) {
+	if !existed {
+		os.RemoveAll(dir)
+		return
+	}
+
+	infos, _ := ioutil.ReadDir(dir)
+	for _, info := range infos {
+		os.RemoveAll(filepath.Join(dir, info.Name()))
+	}
+}
+
+// addDeps adds the dependencies of the runtime of the project's codec to
+// its config, and locks them, unless NoGit is set.  The runtime of lz4
+// builds the LZ4 library in gen/lz4.
+func (p Project) addDeps(dir string, data Data) error {
+	if p.NoGit || data.Codec != "lz4" {
+		return nil
+	}
+
+	remote := p.LZ4Remote
+	if remote == "" {
+		remote = DefaultLZ4Remote
+	}
+	err := dep.Project{Root: dir}.Add("lz4", dep.Dep{
+		Remote: remote,
+		Local:  "gen/lz4",
+	})
+	return errors.Wrap(err, "adding lz4")
+}
+
+// createFiles creates the files of the template in the given FS.
+func (p Project) createFiles(from, to fs.FS, data Data) error {
+	names, err := fs.Files(from, "")
+	if err != nil {
+		return errors.Wrap(err, "reading project template")
+	}
+
+	for _, name := range names {
+		if err := createFile(from, to, name, data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func createFile(from, to fs.FS, name string, data Data) error {
+	f, err := from.Open(name)
+	if err != nil {
+		return errors.Wrapf(err, "opening %s", name)
+	}
+	bs, err := ioutil.ReadAll(f)
+	if err != nil {
+		f.Close()
+		return errors.Wrapf(err, "reading %s", name)
+	}
+	if err := f.Close(); err != nil {
+		return errors.Wrapf(err, "closing %s", name)
+	}
+
+	out, content := name, string(bs)
+	if path.Ext(name) == TemplateExt {
+		out = strings.TrimSuffix(name, TemplateExt)
+
+		tmp, err := template.New(name).Parse(content)
+		if err != nil {
+			return errors.Wrapf(err, "parsing %s", name)
+		}
+		var b strings.Builder
+		if err := tmp.Execute(&b, data); err != nil {
+			return errors.Wrapf(err, "executing %s", name)
+		}
+		content = b.String()
+	}
+
+	ff, err := to.Create(out)
+	if err != nil {
+		return errors.Wrapf(err, "creating %s", out)
+	}
+	if _, err := io.WriteString(ff, content); err != nil {
+		ff.Close()
+		return errors.Wrapf(err, "writing %s", out)
+	}
+	return errors.Wrapf(ff.Close(), "closing %s", out)
+}
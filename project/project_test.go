@@ -0,0 +1,219 @@
+package project_test
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/phoenix-engine/phx/fs"
+	"github.com/phoenix-engine/phx/project"
+	pt "github.com/phoenix-engine/phx/testing"
+)
+
+func makeTemplate(t *testing.T, files map[string]string) fs.FS {
+	t.Helper()
+
+	m := fs.MakeMem()
+	for name, content := range files {
+		f, err := m.Create(name)
+		if err != nil {
+			t.Fatalf("expected nil error, got %#v", err)
+		}
+		if _, err := io.WriteString(f, content); err != nil {
+			t.Fatalf("expected nil error, got %#v", err)
+		}
+		if err := f.Close(); err != nil {
+			t.Fatalf("expected nil error, got %#v", err)
+		}
+	}
+	return m
+}
+
+func readFile(t *testing.T, name string) string {
+	t.Helper()
+
+	bs, err := ioutil.ReadFile(name)
+	if err != nil {
+		t.Errorf("expected nil error, got %#v", err)
+	}
+	return string(bs)
+}
+
+func TestCreate(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "phx-project-test")
+	if err != nil {
+		t.Fatalf("expected nil error, got %#v", err)
+	}
+	defer os.RemoveAll(tmp)
+
+	if err := os.Mkdir(filepath.Join(tmp, "full"), 0755); err != nil {
+		t.Fatalf("expected nil error, got %#v", err)
+	}
+	err = ioutil.WriteFile(filepath.Join(tmp, "full", "x"), nil, 0644)
+	if err != nil {
+		t.Fatalf("expected nil error, got %#v", err)
+	}
+	if err := os.Mkdir(filepath.Join(tmp, "empty"), 0755); err != nil {
+		t.Fatalf("expected nil error, got %#v", err)
+	}
+
+	for i, test := range []struct {
+		should string
+
+		given project.Project
+		dir   string
+
+		expect      map[string]string
+		expectExist []string
+		expectErr   string
+	}{{
+		should: "fail without a name",
+		given:  project.Project{NoGit: true},
+		dir:    "nameless",
+
+		expectErr: `^the project has no name$`,
+	}, {
+		should: "fail for a directory which isn't empty",
+		given:  project.Project{Name: "full", NoGit: true},
+		dir:    "full",
+
+		expectErr: `full is not empty$`,
+	}, {
+		should: "fail for an unknown codec",
+		given:  project.Project{Name: "x", Codec: "nope", NoGit: true},
+		dir:    "codec",
+
+		expectErr: `nope`,
+	}, {
+		should: "create the built-in project and generate its resources",
+		given: project.Project{
+			Name: "my-game", Codec: "deflate", NoGit: true,
+		},
+		dir: "builtin",
+
+		expect: map[string]string{
+			"res/hello.txt": "Hello from my-game!\n",
+		},
+		expectExist: []string{
+			".phx.yaml", ".gitignore", ".clang-format",
+			"CMakeLists.txt", "main.cxx",
+			"gen/id.hpp", "gen/resource.hpp", "gen/res/hello_txt_decl.cxx",
+		},
+	}, {
+		should: "execute the .tmpl files of a custom template",
+		given: project.Project{
+			Name: "my-game",
+			Template: makeTemplate(t, map[string]string{
+				"README.md.tmpl": "# {{.Name}} ({{.Ident}}, {{.Codec}})",
+				"raw/x.tmpl.txt": "{{.Name}}",
+			}),
+			NoGit: true,
+		},
+		dir: "custom",
+
+		expect: map[string]string{
+			"README.md":      "# my-game (my_game, lz4)",
+			"raw/x.tmpl.txt": "{{.Name}}",
+		},
+	}, {
+		should: "fail for a template which doesn't execute, removing the project",
+		given: project.Project{
+			Name: "x",
+			Template: makeTemplate(t, map[string]string{
+				"a/ok.txt": "ok",
+				"bad.tmpl": "{{.Nope}}",
+			}),
+			NoGit: true,
+		},
+		dir: "bad",
+
+		expectErr: `^executing bad\.tmpl: .*Nope`,
+	}, {
+		should: "fail in an empty directory, keeping it empty",
+		given: project.Project{
+			Name: "x",
+			Template: makeTemplate(t, map[string]string{
+				"a/ok.txt": "ok",
+				"bad.tmpl": "{{.Nope}}",
+			}),
+			NoGit: true,
+		},
+		dir: "empty",
+
+		expectErr: `^executing bad\.tmpl: .*Nope`,
+	}} {
+		t.Logf("test %d: should %s", i, test.should)
+
+		dir := filepath.Join(tmp, test.dir)
+		err := test.given.Create(dir)
+		if !pt.CheckErrMatches(t, err, test.expectErr) {
+			continue
+		}
+
+		// A project which fails leaves only what was there before.
+		if err != nil {
+			infos, rerr := ioutil.ReadDir(dir)
+			switch {
+			case test.dir == "empty":
+				pt.CheckErrMatches(t, rerr, "")
+				pt.CheckEq(t, len(infos), 0)
+			case test.dir != "full" && !os.IsNotExist(rerr):
+				t.Errorf("expected %s to be removed, got %#v", dir, rerr)
+			}
+			continue
+		}
+
+		for name, content := range test.expect {
+			got := readFile(t, filepath.Join(dir, name))
+			pt.CheckEq(t, got, content)
+		}
+		for _, name := range test.expectExist {
+			if _, err := os.Stat(filepath.Join(dir, name)); err != nil {
+				t.Errorf("expected %s to exist, got %#v", name, err)
+			}
+		}
+	}
+}
+
+// TestCreateCMake configures the CMake build of the built-in project with
+// the layout of the sources of the LZ4 library.
+func TestCreateCMake(t *testing.T) {
+	if _, err := exec.LookPath("cmake"); err != nil {
+		t.Skip("cmake is not installed")
+	}
+
+	tmp, err := ioutil.TempDir("", "phx-project-test")
+	if err != nil {
+		t.Fatalf("expected nil error, got %#v", err)
+	}
+	defer os.RemoveAll(tmp)
+
+	dir := filepath.Join(tmp, "game")
+	err = project.Project{Name: "game", Codec: "lz4", NoGit: true}.Create(dir)
+	if err != nil {
+		t.Fatalf("expected nil error, got %#v", err)
+	}
+
+	// Only the sources of the library are used, not its own CMake
+	// build in build/cmake.
+	for _, name := range []string{
+		"lib/lz4.c", "lib/lz4.h", "lib/lz4frame.c", "lib/lz4frame.h",
+		"lib/lz4hc.c", "lib/lz4hc.h", "lib/xxhash.c", "lib/xxhash.h",
+	} {
+		p := filepath.Join(dir, "gen", "lz4", filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatalf("expected nil error, got %#v", err)
+		}
+		if err := ioutil.WriteFile(p, nil, 0644); err != nil {
+			t.Fatalf("expected nil error, got %#v", err)
+		}
+	}
+
+	cmd := exec.Command("cmake", "-S", dir, "-B", filepath.Join(tmp, "build"))
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Errorf("expected nil error, got %#v\n%s", err, out)
+	}
+}
@@ -0,0 +1,113 @@
+package project
+
+import (
+	"io"
+
+	"github.com/phoenix-engine/phx/fs"
+	"github.com/phoenix-engine/phx/gen/cpp"
+
+	"github.com/pkg/errors"
+)
+
+// Builtin returns the files of the built-in project template, which
+// builds an executable printing a sample resource.  Its .gitignore and
+// .clang-format are those of the generated source.  It panics if a file
+// can't be created, which is a bug.
+func Builtin() fs.FS {
+	m := fs.MakeMem()
+	for name, content := range builtin() {
+		f, err := m.Create(name)
+		if err == nil {
+			_, err = io.WriteString(f, content)
+			if cerr := f.Close(); err == nil {
+				err = cerr
+			}
+		}
+		if err != nil {
+			panic(errors.Wrapf(err, "creating built-in %s", name))
+		}
+	}
+	return m
+}
+
+func builtin() map[string]string {
+	// The built-in templates of the generated source are escaped
+	// already, so they execute to themselves.
+	gitignore := mustBuiltin(cpp.TmpGitignore)
+	clangFormat := mustBuiltin(cpp.TmpClangFormat)
+
+	return map[string]string{
+		".phx.yaml.tmpl":      phxYAMLTmp,
+		".gitignore.tmpl":     gitignore + gitignoreTmp,
+		".clang-format.tmpl":  clangFormat,
+		"CMakeLists.txt.tmpl": cmakeTmp,
+		"main.cxx":            mainTmp,
+		"res/hello.txt.tmpl":  helloTmp,
+	}
+}
+
+// mustBuiltin returns the built-in template of the generated source with
+// the given ID, panicking if there is none.
+func mustBuiltin(id cpp.TemplateID) string {
+	tmp, err := cpp.Builtin(id, "")
+	if err != nil {
+		panic(errors.Wrapf(err, "reading built-in %s", id.Output()))
+	}
+	return tmp
+}
+
+var phxYAMLTmp = `
+# The settings of phx for this project.  Those of "phx gen" are named
+# like its flags, such as "codec: deflate".
+gen:
+  from: res
+  to: gen
+  codec: {{.Codec}}
+`[1:]
+
+var gitignoreTmp = `
+# Generated by "phx gen", except for its dependencies.
+/gen/*
+!/gen/lz4
+/.gen.lock
+`
+
+var cmakeTmp = `
+cmake_minimum_required(VERSION 3.11 FATAL_ERROR)
+
+project({{.Ident}} C CXX)
+
+# The Resource library is generated from res into gen by "phx gen".
+add_subdirectory(gen)
+
+add_executable({{.Ident}} main.cxx)
+target_link_libraries({{.Ident}} Resource)
+
+set_property(TARGET {{.Ident}} PROPERTY CXX_STANDARD 11)
+set_property(TARGET {{.Ident}} PROPERTY CXX_STANDARD_REQUIRED ON)
+`[1:]
+
+var mainTmp = `
+#include <iostream>
+#include <vector>
+
+#include "id.hpp"
+#include "mapper.hpp"
+
+int main() {
+    auto hello = res::Mapper::Fetch(res::ID::hello_txt);
+
+    std::vector<char> buf(hello->Len());
+    size_t            n = 0;
+    while (auto m = hello->Read(buf.data() + n, buf.size() - n)) {
+	n += m;
+    }
+
+    std::cout.write(buf.data(), n);
+    return 0;
+}
+`[1:]
+
+var helloTmp = `
+Hello from {{.Name}}!
+`[1:]